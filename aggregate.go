@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// aggregateFlushInterval is how often aggregate publishes a partial batch.
+var aggregateFlushInterval = time.Second
+
+// aggregateStats counts what an aggregate run has done so far.
+type aggregateStats struct {
+	seen       int
+	duplicates int
+	published  int
+	failed     int
+}
+
+func aggregateCommand(opts *options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return aggregate(ctx, opts)
+}
+
+// aggregate subscribes to every source relay and republishes each unique
+// event to the --aggregate target until ctx is canceled.
+func aggregate(ctx context.Context, opts *options) error {
+	relays := relayList(opts)
+	kinds := opts.kinds
+	if len(kinds) == 0 {
+		kinds = []int{nostr.KindEncryptedDirectMessage}
+	}
+
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Aggregating kinds %v from %v into %s\n", kinds, relays, opts.aggregateTo)
+	}
+
+	filter := nostr.Filter{Kinds: kinds}
+	incoming := make(chan *nostr.Event)
+	var subs sync.WaitGroup
+	for _, relay := range relays {
+		subs.Add(1)
+		go func(relay string) {
+			defer subs.Done()
+			subscribeRelay(ctx, opts, relay, nostr.Filters{filter}, incoming, nil)
+		}(relay)
+	}
+	go func() {
+		subs.Wait()
+		close(incoming)
+	}()
+
+	var stats aggregateStats
+	var target *nostr.Relay
+	defer func() {
+		if target != nil {
+			target.Close()
+		}
+		fmt.Fprintf(os.Stderr, "[ndm] Aggregated %d events: %d duplicates skipped, %d published, %d failed\n",
+			stats.seen, stats.duplicates, stats.published, stats.failed)
+	}()
+
+	// Publishing uses publishCtx, which outlives ctx for the final flush.
+	publishCtx := ctx
+	publish := func(evt *nostr.Event) error {
+		var err error
+		if target == nil || !target.IsConnected() {
+			target, err = connectRelay(publishCtx, opts, opts.aggregateTo)
+		}
+		if err == nil {
+			pubCtx, cancel := context.WithTimeout(publishCtx, opts.wait)
+			err = target.Publish(pubCtx, *evt)
+			cancel()
+		}
+		if err != nil && opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Failed to publish %s to %s: %v\n", evt.ID, opts.aggregateTo, err)
+		}
+		return err
+	}
+
+	batch := make([]*nostr.Event, 0, opts.batchSize)
+	batches := 0
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		batches++
+		failed, _ := processBatch(batch, publish)
+		stats.failed += failed
+		stats.published += len(batch) - failed
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Processed batch %d (%d seen, %d duplicates, %d published, %d failed)\n",
+				batches, stats.seen, stats.duplicates, stats.published, stats.failed)
+		}
+		batch = batch[:0]
+	}
+
+	// A partial batch is flushed once the sources go quiet, so a slow trickle
+	// of live events is not held back waiting for a full batch.
+	idle := time.NewTicker(aggregateFlushInterval)
+	defer idle.Stop()
+
+	// Sources run indefinitely, so only recent IDs are kept for spotting
+	// duplicates.
+	seen := newSeenEvents(opts.dupWindow, maxSeenEvents)
+	for {
+		select {
+		case evt, ok := <-incoming:
+			if !ok {
+				// The sources stop when ctx is canceled; the batch still
+				// held gets a short, fresh deadline to be published.
+				var cancel context.CancelFunc
+				publishCtx, cancel = context.WithTimeout(context.Background(), opts.wait)
+				defer cancel()
+				flush()
+				return nil
+			}
+			stats.seen++
+			if !seen.firstSeen(evt.ID, time.Now()) {
+				stats.duplicates++
+				continue
+			}
+			batch = append(batch, evt)
+			if len(batch) >= opts.batchSize {
+				flush()
+			}
+		case <-idle.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestAggregateDeduplicates(t *testing.T) {
+	defer func(d time.Duration) { aggregateFlushInterval = d }(aggregateFlushInterval)
+	aggregateFlushInterval = 10 * time.Millisecond
+
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	shared := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "on two relays")
+	unique := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "on one relay")
+
+	sources := []*mockRelay{newMockRelay(t, shared), newMockRelay(t, shared), newMockRelay(t, unique)}
+	target := newMockRelay(t)
+
+	opts, err := parseArgs([]string{
+		"aggregate",
+		"--aggregate", target.URL,
+		"--allow-insecure-relays", "--relays", sources[0].URL + "," + sources[1].URL + "," + sources[2].URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	captureStderr(t, func() {
+		go func() { done <- aggregate(ctx, opts) }()
+
+		subscribed := waitFor(2*time.Second, func() bool {
+			for _, s := range sources {
+				if s.Subscriptions() == 0 {
+					return false
+				}
+			}
+			return true
+		})
+		if !subscribed {
+			t.Fatal("aggregate never subscribed to every source relay")
+		}
+		if !waitFor(2*time.Second, func() bool { return len(target.Published()) >= 2 }) {
+			t.Error("target relay never received both events")
+		}
+		// Give the duplicate time to arrive before stopping.
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("aggregate: %v", err)
+		}
+	})
+
+	published := target.Published()
+	if len(published) != 2 {
+		t.Fatalf("expected 2 published events, got %d", len(published))
+	}
+	ids := map[string]bool{published[0].ID: true, published[1].ID: true}
+	if !ids[shared.ID] || !ids[unique.ID] {
+		t.Errorf("unexpected events published: %v", ids)
+	}
+}
+
+func TestAggregateFlushesOnStop(t *testing.T) {
+	defer func(d time.Duration) { aggregateFlushInterval = d }(aggregateFlushInterval)
+	aggregateFlushInterval = time.Hour
+
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	source := newMockRelay(t, newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "held in a batch"))
+	target := newMockRelay(t)
+
+	opts, err := parseArgs([]string{
+		"aggregate", "--aggregate", target.URL, "--batch-size", "100",
+		"--allow-insecure-relays", "--relays", source.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	captureStderr(t, func() {
+		go func() { done <- aggregate(ctx, opts) }()
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+			t.Fatal("aggregate never subscribed")
+		}
+		time.Sleep(100 * time.Millisecond)
+		if len(target.Published()) != 0 {
+			t.Fatal("expected the event to wait for a full batch")
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("aggregate: %v", err)
+		}
+	})
+
+	if published := target.Published(); len(published) != 1 {
+		t.Errorf("expected the partial batch to be published on stop, got %d events", len(published))
+	}
+}
+
+func TestAggregateRequiresTarget(t *testing.T) {
+	if _, err := parseArgs([]string{"aggregate"}); err == nil {
+		t.Error("expected error without --aggregate")
+	}
+	opts, err := parseArgs([]string{"aggregate", "--aggregate", "wss://x", "--kinds", "4,1059"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts.kinds) != 2 || opts.kinds[0] != 4 || opts.kinds[1] != 1059 {
+		t.Errorf("unexpected kinds: %v", opts.kinds)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// decodeBinaryContent decodes decrypted content for --content-encoding
+// base64. ok is false without the flag or when the content is not valid
+// base64, in which case it is shown as plain text.
+func decodeBinaryContent(content string, opts *options) (data []byte, ok bool) {
+	if opts.contentEnc != "base64" {
+		return nil, false
+	}
+	content = strings.Join(strings.Fields(content), "")
+	if content == "" {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(content)
+	return data, err == nil
+}
+
+// saveBinaryContent writes data to --decode-output, with {id} in the path
+// replaced by the event ID so each message can get its own file.
+func saveBinaryContent(e *nostr.Event, data []byte, opts *options) (string, error) {
+	path := strings.ReplaceAll(opts.decodeOutput, "{id}", e.ID)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write --decode-output: %w", err)
+	}
+	return path, nil
+}
+
+// fprintBinary prints the Content of a message decoded by
+// decodeBinaryContent: saved to --decode-output, as a --hex-dump, as text
+// when it is valid UTF-8, or else just its size.
+func fprintBinary(w io.Writer, e *nostr.Event, data []byte, opts *options) {
+	colors := outputColors(opts)
+	switch {
+	case opts.decodeOutput != "":
+		path, err := saveBinaryContent(e, data, opts)
+		if err != nil {
+			fmt.Fprintf(w, "    Content: %s\n", paint(colors.Error, err.Error()))
+		} else {
+			fmt.Fprintf(w, "    Content: (%d bytes saved to %s)\n", len(data), path)
+		}
+	case opts.hexDump:
+		fmt.Fprintf(w, "    Content: (%d bytes)\n", len(data))
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(hex.Dump(data), "\n"), "\n") {
+			fmt.Fprintf(w, "    %s", line)
+		}
+		fmt.Fprintln(w)
+	case utf8.Valid(data):
+		content, _ := truncateContent(displayContent(string(data), opts), opts.maxContent)
+		fmt.Fprintf(w, "    Content: %s\n", paint(colors.Content, content))
+	default:
+		fmt.Fprintf(w, "    Content: (%d bytes of binary data, use --hex-dump or --decode-output to see them)\n", len(data))
+	}
+}
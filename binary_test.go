@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestContentEncodingBase64(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	payload := []byte{0x00, 0x01, 0x02, 0x03, 0x7f, 0x80, 0xfe, 0xff, 'n', 'd', 'm', 0x10, 0x20, 0x30, 0x40, 0x50}
+	binary := newTestDM(t, sender, recipientPub, base64.StdEncoding.EncodeToString(payload))
+	path := writeEventsFile(t, binary, newTestDM(t, sender, recipientPub, "plain text, not base64!"))
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--import-event", path, "--content-encoding", "base64"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	out := read("--hex-dump")
+	if !strings.Contains(out, "Content: (16 bytes)") {
+		t.Errorf("expected the decoded size, got:\n%s", out)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(hex.Dump(payload)), "\n") {
+		if !strings.Contains(out, "    "+line+"\n") {
+			t.Errorf("expected hex dump line %q, got:\n%s", line, out)
+		}
+	}
+	if !strings.Contains(out, "Content: plain text, not base64!") {
+		t.Errorf("expected invalid base64 to be shown as text, got:\n%s", out)
+	}
+
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(read("--json")), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	decoded := 0
+	for _, m := range msgs {
+		if got, ok := m["decoded_bytes_hex"]; ok {
+			decoded++
+			if got != hex.EncodeToString(payload) {
+				t.Errorf("decoded_bytes_hex = %v, want %x", got, payload)
+			}
+		}
+	}
+	if decoded != 1 {
+		t.Errorf("expected decoded_bytes_hex on the base64 message only, got %d", decoded)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "{id}.bin")
+	out = read("--decode-output", outPath)
+	saved, err := os.ReadFile(strings.ReplaceAll(outPath, "{id}", binary.ID))
+	if err != nil {
+		t.Fatalf("expected the payload to be saved: %v\n%s", err, out)
+	}
+	if !bytes.Equal(saved, payload) {
+		t.Errorf("saved %x, want %x", saved, payload)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--hex-dump"}); err == nil {
+		t.Error("expected --hex-dump without --content-encoding to be rejected")
+	}
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--content-encoding", "hex"}); err == nil {
+		t.Error("expected an unsupported --content-encoding to be rejected")
+	}
+}
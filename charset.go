@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// charsets maps --charset names to decoders. UTF-8 needs no decoding and maps
+// to nil.
+var charsets = map[string]encoding.Encoding{
+	"utf-8":        nil,
+	"utf8":         nil,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+	"iso-8859-2":   charmap.ISO8859_2,
+	"latin2":       charmap.ISO8859_2,
+}
+
+// decodeCharset converts decrypted content from the --charset encoding to
+// UTF-8. If that fails the content is kept as UTF-8, with invalid bytes
+// replaced, and a warning is printed.
+func decodeCharset(content string, opts *options) string {
+	if opts.charset == "" && opts.charsetDetect {
+		return detectAndDecode(content, opts)
+	}
+	enc := charsets[strings.ToLower(opts.charset)]
+	if enc == nil {
+		return content
+	}
+	decoded, err := enc.NewDecoder().String(content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Warning: could not decode message as %s: %v\n", opts.charset, err)
+		return strings.ToValidUTF8(content, "\uFFFD")
+	}
+	return decoded
+}
+
+// detectCandidates are the single-byte charsets --charset-detect tries, in
+// order of preference when they score the same.
+var detectCandidates = []string{"windows-1252", "iso-8859-2"}
+
+// detectCharset guesses the encoding of content. Valid UTF-8 is taken as
+// UTF-8; otherwise each candidate is scored by the share of non-ASCII bytes
+// that decode to letters or printable punctuation. ok is false when no
+// candidate decodes at least half of them sensibly.
+func detectCharset(content string) (name string, ok bool) {
+	if utf8.ValidString(content) {
+		return "utf-8", true
+	}
+
+	high := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] >= 0x80 {
+			high++
+		}
+	}
+
+	best := 0
+	for _, candidate := range detectCandidates {
+		decoded, err := charsets[candidate].NewDecoder().String(content)
+		if err != nil {
+			continue
+		}
+		score := 0
+		for _, r := range decoded {
+			if r < 0x80 {
+				continue
+			}
+			switch {
+			case unicode.IsLetter(r):
+				score += 2
+			case unicode.IsPrint(r) && r != utf8.RuneError:
+				score++
+			}
+		}
+		if score > best {
+			name, best = candidate, score
+		}
+	}
+	return name, best >= high
+}
+
+// detectAndDecode converts content to UTF-8 from the charset detectCharset
+// picks. Low-confidence guesses leave the content as UTF-8 with invalid bytes
+// replaced.
+func detectAndDecode(content string, opts *options) string {
+	name, ok := detectCharset(content)
+	if !ok {
+		if opts.verbose {
+			fmt.Fprintln(os.Stderr, "[ndm] Could not detect charset, showing message as UTF-8")
+		}
+		return strings.ToValidUTF8(content, "\uFFFD")
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Detected charset: %s\n", name)
+	}
+	if name == "utf-8" {
+		return content
+	}
+	decoded, _ := charsets[name].NewDecoder().String(content)
+	return decoded
+}
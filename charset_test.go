@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestCharsetLatin1(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, sender, recipientPub, "caf\xe9 cr\xe8me")
+	path := writeEventsFile(t, evt)
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--charset", "latin1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if !strings.Contains(out, "café crème") {
+		t.Errorf("expected decoded Latin-1 content, got:\n%s", out)
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		input   string
+		want    string
+	}{
+		{"", "café", "café"},
+		{"utf-8", "café", "café"},
+		{"windows-1252", "\x80 5", "€ 5"},
+		{"iso-8859-2", "\xb3\xf3d\xbc", "łódź"},
+	}
+	for _, tt := range tests {
+		if got := decodeCharset(tt.input, &options{charset: tt.charset}); got != tt.want {
+			t.Errorf("decodeCharset(%q, %q) = %q, want %q", tt.input, tt.charset, got, tt.want)
+		}
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--charset", "ebcdic"}); err == nil {
+		t.Error("expected error for unsupported charset")
+	}
+}
+
+func TestCharsetDetect(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, sender, recipientPub, "caf\xe9 cr\xe8me br\xfbl\xe9e")
+	path := writeEventsFile(t, evt)
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--charset-detect", "-v"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out string
+	logs := captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	})
+	if !strings.Contains(out, "café crème brûlée") {
+		t.Errorf("expected detected Latin-1 content, got:\n%s", out)
+	}
+	if !strings.Contains(logs, "[ndm] Detected charset: windows-1252") {
+		t.Errorf("expected detected charset in verbose output, got:\n%s", logs)
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"café", "utf-8", true},
+		{"\x93quoted\x94 \x80 5", "windows-1252", true},
+		{"\x81\x8d\x8f\x90\x9d", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := detectCharset(tt.input)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("detectCharset(%q) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ColorScheme holds the ANSI SGR codes used for each part of a message in
+// human output. An empty code leaves that part uncolored.
+type ColorScheme struct {
+	Sender    string
+	Timestamp string
+	Content   string
+	Error     string
+}
+
+var (
+	// darkScheme uses bright colors that stand out on dark backgrounds.
+	darkScheme = ColorScheme{Sender: "92", Timestamp: "93", Content: "97", Error: "91"}
+	// lightScheme uses normal-intensity colors readable on light backgrounds.
+	lightScheme = ColorScheme{Sender: "32", Timestamp: "34", Content: "30", Error: "31"}
+)
+
+// colorSchemes are the --color-scheme values; auto is resolved separately.
+var colorSchemes = []string{"auto", "dark", "light"}
+
+// colorSchemeFor returns the scheme for a --color-scheme value, detecting the
+// background from COLORFGBG for auto and falling back to dark.
+func colorSchemeFor(name string) ColorScheme {
+	switch name {
+	case "light":
+		return lightScheme
+	case "auto":
+		if lightBackground(os.Getenv("COLORFGBG")) {
+			return lightScheme
+		}
+	}
+	return darkScheme
+}
+
+// lightBackground reports whether a COLORFGBG value ("fg;bg" or
+// "fg;default;bg") names a light background color.
+func lightBackground(colorfgbg string) bool {
+	parts := strings.Split(colorfgbg, ";")
+	bg, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return false
+	}
+	return bg == 7 || bg >= 9 && bg <= 15
+}
+
+// outputColors returns the scheme for human output, or no colors when stdout
+// is not a terminal.
+func outputColors(opts *options) ColorScheme {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return ColorScheme{}
+	}
+	return colorSchemeFor(opts.colorScheme)
+}
+
+// paint wraps s in the ANSI code, if any.
+func paint(code, s string) string {
+	if code == "" {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestColorSchemes(t *testing.T) {
+	dark, light := colorSchemeFor("dark"), colorSchemeFor("light")
+	roles := []struct {
+		name        string
+		dark, light string
+	}{
+		{"Sender", dark.Sender, light.Sender},
+		{"Timestamp", dark.Timestamp, light.Timestamp},
+		{"Content", dark.Content, light.Content},
+		{"Error", dark.Error, light.Error},
+	}
+	for _, r := range roles {
+		if r.dark == "" || r.light == "" || r.dark == r.light {
+			t.Errorf("%s: expected distinct codes, got dark %q and light %q", r.name, r.dark, r.light)
+		}
+	}
+}
+
+func TestColorSchemeAuto(t *testing.T) {
+	tests := []struct {
+		colorfgbg string
+		want      ColorScheme
+	}{
+		{"0;15", lightScheme},
+		{"0;default;7", lightScheme},
+		{"15;0", darkScheme},
+		{"", darkScheme},
+	}
+	for _, tt := range tests {
+		t.Setenv("COLORFGBG", tt.colorfgbg)
+		if got := colorSchemeFor("auto"); got != tt.want {
+			t.Errorf("COLORFGBG=%q: got %+v, want %+v", tt.colorfgbg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMagic prefixes zstd-compressed plaintext so the receiver knows to
+// decompress it after decrypting.
+const compressMagic = "\x00zstd\n"
+
+// defaultMinCompressSize is the smallest message --compress compresses.
+const defaultMinCompressSize = 512
+
+// maxDecompressedSize caps what a compressed message may expand to, so a
+// small zstd bomb from a sender cannot exhaust memory.
+const maxDecompressedSize = 4 << 20
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+)
+
+// compressPlaintext applies --compress to message before it is encrypted.
+// Messages under --min-compress-size are left as they are.
+func compressPlaintext(message string, opts *options) string {
+	if !opts.compress || len(message) < opts.minCompressSize {
+		return message
+	}
+	return compressMagic + string(zstdEncoder.EncodeAll([]byte(message), nil))
+}
+
+// decompressPlaintext undoes compressPlaintext on decrypted content. Content
+// without the magic prefix is returned unchanged.
+func decompressPlaintext(plaintext string) (string, error) {
+	data, ok := strings.CutPrefix(plaintext, compressMagic)
+	if !ok {
+		return plaintext, nil
+	}
+	out, err := zstdDecoder.DecodeAll([]byte(data), nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return "", fmt.Errorf("decompress: message expands to more than %d bytes", maxDecompressedSize)
+	}
+	if err != nil {
+		return "", fmt.Errorf("decompress: %w", err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestCompress(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	message := strings.Repeat(`{"type":"ping","ok":true}`, 41)
+
+	build := func(args ...string) nostr.Event {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"-k", sender, "-r", recipient, "-m", message, "--nip", "4"}, args...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		evt, err := buildDMEvent(opts, sender, recipientPub)
+		if err != nil {
+			t.Fatalf("buildDMEvent: %v", err)
+		}
+		return evt
+	}
+
+	plain := build()
+	compressed := build("--compress")
+	if len(compressed.Content) >= len(plain.Content) {
+		t.Errorf("expected compressed content to be smaller: %d >= %d", len(compressed.Content), len(plain.Content))
+	}
+
+	got, err := decryptMessage(recipient, compressed.PubKey, compressed.Content)
+	if err != nil {
+		t.Fatalf("decryptMessage: %v", err)
+	}
+	if got != message {
+		t.Errorf("round trip lost the message: got %q", got)
+	}
+
+	small := build("--compress", "--min-compress-size", "2048")
+	if len(small.Content) != len(plain.Content) {
+		t.Errorf("expected a message under --min-compress-size to be sent as is")
+	}
+}
+
+func TestDecompressBomb(t *testing.T) {
+	smallWindow, _ := zstd.NewWriter(nil, zstd.WithWindowSize(1<<20))
+	for _, enc := range []*zstd.Encoder{zstdEncoder, smallWindow} {
+		bomb := compressMagic + string(enc.EncodeAll(make([]byte, 64<<20), nil))
+		if len(bomb) > 64<<10 {
+			t.Fatalf("expected the bomb to fit in one message, got %d bytes", len(bomb))
+		}
+		if _, err := decompressPlaintext(bomb); err == nil || !strings.Contains(err.Error(), "more than") {
+			t.Errorf("expected the size cap to stop the bomb, got %v", err)
+		}
+	}
+
+	ok := strings.Repeat("a", maxDecompressedSize)
+	if got, err := decompressPlaintext(compressMagic + string(zstdEncoder.EncodeAll([]byte(ok), nil))); err != nil || got != ok {
+		t.Errorf("expected a message at the cap to decompress, got %d bytes, %v", len(got), err)
+	}
+}
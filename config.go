@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// config is the on-disk ndm configuration file.
+type config struct {
+	Relays []string `json:"relays,omitempty"`
+}
+
+// configPath returns --config if given, otherwise ~/.config/ndm/config.json
+// (or the platform equivalent).
+func configPath(opts *options) string {
+	if opts.configFile != "" {
+		return opts.configFile
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ndm", "config.json")
+}
+
+// dataPath returns name inside $XDG_DATA_HOME/ndm, defaulting to
+// ~/.local/share/ndm. State that ndm updates by itself lives there rather
+// than next to the config file.
+func dataPath(name string) string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "ndm", name)
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// saveConfigRelays replaces the relays list in the config file, keeping any
+// other settings already in it.
+func saveConfigRelays(path string, relays []string) error {
+	settings := map[string]json.RawMessage{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	encoded, err := json.Marshal(relays)
+	if err != nil {
+		return err
+	}
+	settings["relays"] = encoded
+
+	out, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o600)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestSaveRelays(t *testing.T) {
+	good := newMockRelay(t)
+	bad := newFailingRelay(t, nil)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"relays":["wss://old.example"],"theme":"dark"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{
+		key:           nostr.GeneratePrivateKey(),
+		recipient:     nostr.GeneratePrivateKey(),
+		message:       "hello",
+		relays:        bad + "," + good.URL,
+		wait:          5 * time.Second,
+		configFile:    path,
+		saveRelays:    true,
+		allowInsecure: true,
+	}
+	var sendErr error
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() { sendErr = sendMessage(opts) })
+	})
+	if sendErr != nil {
+		t.Fatalf("sendMessage: %v", sendErr)
+	}
+	if !strings.Contains(stderr, "Saved 1 relays") {
+		t.Errorf("expected confirmation, got %q", stderr)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if want := []string{good.URL}; !reflect.DeepEqual(cfg.Relays, want) {
+		t.Errorf("relays = %v, want %v", cfg.Relays, want)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"theme": "dark"`) {
+		t.Errorf("expected other settings to be preserved, got %s", data)
+	}
+}
+
+func TestRelayListFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"relays":["wss://a.example","wss://b.example"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got := relayList(&options{configFile: path})
+	if want := []string{"wss://a.example", "wss://b.example"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("relayList = %v, want %v", got, want)
+	}
+
+	got = relayList(&options{configFile: path, relays: "wss://c.example"})
+	if want := []string{"wss://c.example"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("--relays should override config, got %v", got)
+	}
+}
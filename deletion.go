@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// shownMessage is a message watch printed, remembered for --event-ttl.
+type shownMessage struct {
+	n       int
+	event   *nostr.Event
+	shownAt time.Time
+}
+
+// deletionTracker remembers the messages watch printed during the last ttl so
+// that NIP-09 deletions arriving later can be matched to them.
+type deletionTracker struct {
+	ttl   time.Duration
+	shown map[string]shownMessage
+}
+
+func newDeletionTracker(ttl time.Duration) *deletionTracker {
+	return &deletionTracker{ttl: ttl, shown: make(map[string]shownMessage)}
+}
+
+// remember records e as message n, forgetting messages older than the ttl.
+func (d *deletionTracker) remember(n int, e *nostr.Event, now time.Time) {
+	for id, m := range d.shown {
+		if now.Sub(m.shownAt) > d.ttl {
+			delete(d.shown, id)
+		}
+	}
+	d.shown[e.ID] = shownMessage{n: n, event: e, shownAt: now}
+}
+
+// deleted returns the remembered messages that deletion removes. As NIP-09
+// requires, only the original author can delete a message.
+func (d *deletionTracker) deleted(deletion *nostr.Event, now time.Time) []shownMessage {
+	var matched []shownMessage
+	for tag := range deletion.Tags.FindAll("e") {
+		m, ok := d.shown[tag[1]]
+		if !ok || m.event.PubKey != deletion.PubKey || now.Sub(m.shownAt) > d.ttl {
+			continue
+		}
+		delete(d.shown, tag[1])
+		matched = append(matched, m)
+	}
+	return matched
+}
+
+// printDeleted reprints a message that was deleted after it was shown, struck
+// through on terminals.
+func printDeleted(m shownMessage, privkey string, opts *options) {
+	if opts.jsonOutput {
+		out, _ := json.Marshal(map[string]string{"type": "deleted", "id": m.event.ID})
+		fmt.Println(string(out))
+		return
+	}
+
+	content, err := messageContent(privkey, m.event)
+	if err != nil {
+		content = "(decrypt failed)"
+	}
+	content, _ = truncateContent(displayContent(content, opts), opts.maxContent)
+	if outputColors(opts) != (ColorScheme{}) {
+		content = paint("9", content)
+	}
+	fmt.Printf("[%d] [DELETED] From: %s\n", m.n, senderDisplay(m.event.PubKey, opts))
+	fmt.Printf("    ID: %s\n", displayID(m.event.ID, opts))
+	fmt.Printf("    Content: %s\n\n", content)
+}
+
+// deletionFollower subscribes to NIP-09 deletions by the senders watch has
+// shown, rather than to every deletion on the relays. Each new sender
+// restarts the subscriptions with the longer author list; they keep the
+// original Since, so no deletion in between is missed.
+type deletionFollower struct {
+	ctx    context.Context
+	opts   *options
+	relays []string
+	since  nostr.Timestamp
+	out    chan *nostr.Event
+
+	authors []string
+	stop    context.CancelFunc
+}
+
+func newDeletionFollower(ctx context.Context, opts *options, relays []string, since nostr.Timestamp) *deletionFollower {
+	return &deletionFollower{ctx: ctx, opts: opts, relays: relays, since: since, out: make(chan *nostr.Event)}
+}
+
+// follow adds author to the senders whose deletions are followed.
+func (d *deletionFollower) follow(author string) {
+	if slices.Contains(d.authors, author) {
+		return
+	}
+	d.authors = append(d.authors, author)
+	if d.opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Following deletions by %d senders\n", len(d.authors))
+	}
+
+	d.close()
+	ctx, stop := context.WithCancel(d.ctx)
+	d.stop = stop
+	filters := nostr.Filters{{Kinds: []int{nostr.KindDeletion}, Authors: slices.Clone(d.authors), Since: &d.since}}
+	for _, relay := range d.relays {
+		go followRelay(ctx, d.opts, relay, filters, d.out)
+	}
+}
+
+// close ends the current subscriptions.
+func (d *deletionFollower) close() {
+	if d.stop != nil {
+		d.stop()
+	}
+}
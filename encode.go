@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// pubkeyEncodings is the output of encode-recipient.
+type pubkeyEncodings struct {
+	Npub     string   `json:"npub"`
+	Hex      string   `json:"hex"`
+	Nprofile string   `json:"nprofile"`
+	Relays   []string `json:"relays,omitempty"`
+}
+
+// encodeRecipientCommand prints every encoding of the pubkey given as an
+// npub, hex pubkey, nsec or nprofile. Relay hints for the nprofile come from
+// the input and the pubkey's NIP-65 inbox relays.
+func encodeRecipientCommand(opts *options) error {
+	if len(opts.args) == 0 {
+		return fmt.Errorf("usage: ndm encode-recipient <npub|hex|nsec|nprofile>")
+	}
+	pubkey, hints, err := decodePubkeyInput(opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+	for _, relay := range recipientInboxRelays(ctx, opts, relayList(opts), pubkey) {
+		if !slices.Contains(hints, relay) {
+			hints = append(hints, relay)
+		}
+	}
+
+	enc := pubkeyEncodings{Hex: pubkey, Relays: hints}
+	if enc.Npub, err = nip19.EncodePublicKey(pubkey); err != nil {
+		return fmt.Errorf("failed to encode npub: %w", err)
+	}
+	if enc.Nprofile, err = nip19.EncodeProfile(pubkey, hints); err != nil {
+		return fmt.Errorf("failed to encode nprofile: %w", err)
+	}
+
+	if opts.jsonOutput {
+		out, _ := marshalJSON(enc, opts)
+		fmt.Println(string(out))
+		return nil
+	}
+	fmt.Printf("npub:     %s\n", enc.Npub)
+	fmt.Printf("hex:      %s\n", enc.Hex)
+	fmt.Printf("nprofile: %s\n", enc.Nprofile)
+	if len(hints) > 0 {
+		fmt.Printf("relays:   %s\n", strings.Join(hints, ", "))
+	}
+	return nil
+}
+
+// decodePubkeyInput returns the pubkey and any relay hints in input. Unlike
+// resolveKey, 64 hex characters are always read as a pubkey here.
+func decodePubkeyInput(input string) (string, []string, error) {
+	input = strings.TrimSpace(input)
+	if len(input) == 64 && isHex(input) {
+		return strings.ToLower(input), nil, nil
+	}
+
+	prefix, value, err := nip19.Decode(input)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not decode %s: %w", input, err)
+	}
+	switch prefix {
+	case "npub":
+		return value.(string), nil, nil
+	case "nsec":
+		pubkey, err := derivePublicKeyFromPrivate(value.(string), false)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid nsec: %w", err)
+		}
+		return pubkey, nil, nil
+	case "nprofile":
+		profile := value.(nostr.ProfilePointer)
+		return profile.PublicKey, profile.Relays, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported input %s: want an npub, hex pubkey, nsec or nprofile", prefix)
+	}
+}
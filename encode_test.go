@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func encodeRecipient(t *testing.T, input string) pubkeyEncodings {
+	t.Helper()
+	relay := newMockRelay(t)
+	opts, err := parseArgs([]string{"encode-recipient", input, "--allow-insecure-relays", "--relays", relay.URL, "--json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := encodeRecipientCommand(opts); err != nil {
+			t.Fatalf("encode-recipient: %v", err)
+		}
+	})
+	var enc pubkeyEncodings
+	if err := json.Unmarshal([]byte(out), &enc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	return enc
+}
+
+func TestEncodeRecipient(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(priv)
+
+	enc := encodeRecipient(t, pub)
+	if enc.Hex != pub {
+		t.Errorf("hex = %s, want %s", enc.Hex, pub)
+	}
+	if prefix, value, err := nip19.Decode(enc.Npub); err != nil || prefix != "npub" || value != pub {
+		t.Errorf("npub %s decodes to %v %v (%v), want %s", enc.Npub, prefix, value, err, pub)
+	}
+	if !strings.HasPrefix(enc.Nprofile, "nprofile1") {
+		t.Errorf("expected an nprofile, got %q", enc.Nprofile)
+	}
+
+	nsec, _ := nip19.EncodePrivateKey(priv)
+	if enc := encodeRecipient(t, nsec); enc.Hex != pub {
+		t.Errorf("nsec input: hex = %s, want the derived pubkey %s", enc.Hex, pub)
+	}
+
+	nprofile, _ := nip19.EncodeProfile(pub, []string{"wss://relay.example.com"})
+	enc = encodeRecipient(t, nprofile)
+	if enc.Hex != pub || len(enc.Relays) != 1 || enc.Relays[0] != "wss://relay.example.com" {
+		t.Errorf("nprofile input: got %+v", enc)
+	}
+}
+
+func TestEncodeRecipientRelayHints(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(priv)
+	relayList := &nostr.Event{
+		Kind:      nostr.KindRelayListMetadata,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"r", "wss://inbox.example.com", "read"}},
+	}
+	if err := relayList.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t, relayList)
+
+	opts, err := parseArgs([]string{"encode-recipient", pub, "--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := encodeRecipientCommand(opts); err != nil {
+			t.Fatalf("encode-recipient: %v", err)
+		}
+	})
+	if !strings.Contains(out, "relays:   wss://inbox.example.com") {
+		t.Errorf("expected the inbox relay as a hint, got:\n%s", out)
+	}
+	_, rest, _ := strings.Cut(out, "nprofile: ")
+	nprofile, _, _ := strings.Cut(rest, "\n")
+	_, value, err := nip19.Decode(nprofile)
+	if err != nil || len(value.(nostr.ProfilePointer).Relays) != 1 {
+		t.Errorf("expected the nprofile to carry the relay hint, got %v (%v)", value, err)
+	}
+}
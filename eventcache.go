@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// eventCache keeps query results in memory for --relay-event-cache-ttl, so
+// repeated reads within one process skip the relays.
+var eventCache = &memoryCache{entries: make(map[string]cacheEntry)}
+
+type cacheEntry struct {
+	events  []*nostr.Event
+	expires time.Time
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheKey identifies a query by its relays and serialized filter.
+func cacheKey(relays []string, filter nostr.Filter) string {
+	return strings.Join(relays, ",") + " " + filter.String()
+}
+
+// get returns a copy of the cached events for the query, if they have not
+// expired.
+func (c *memoryCache) get(relays []string, filter nostr.Filter) ([]*nostr.Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey(relays, filter)
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return slices.Clone(entry.events), true
+}
+
+func (c *memoryCache) put(relays []string, filter nostr.Filter, events []*nostr.Event, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(relays, filter)] = cacheEntry{events: slices.Clone(events), expires: time.Now().Add(ttl)}
+}
+
+// queryEvents fetches the events matching filter for read, answering from
+// eventCache when --relay-event-cache-ttl is set and the query was made
+// recently.
+func queryEvents(ctx context.Context, opts *options, relays []string, filter nostr.Filter) []*nostr.Event {
+	if opts.eventCacheTTL > 0 {
+		if events, ok := eventCache.get(relays, filter); ok {
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Using %d cached events\n", len(events))
+			}
+			return events
+		}
+	}
+
+	var events []*nostr.Event
+	switch opts.timeoutStrat {
+	case "all":
+		events = fetchEventsUntilEOSE(ctx, opts, relays, filter, len(relays))
+	case "majority":
+		events = fetchEventsUntilEOSE(ctx, opts, relays, filter, len(relays)/2+1)
+	default:
+		events = fetchEvents(ctx, opts, relays, filter)
+	}
+	if opts.eventCacheTTL > 0 {
+		eventCache.put(relays, filter, events, opts.eventCacheTTL)
+	}
+	return events
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRelayEventCache(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	relay := newMockRelay(t, newTestDM(t, sender, recipientPub, "hello"))
+
+	query := func(extra ...string) []*nostr.Event {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		filter := nostr.Filter{Kinds: []int{nostr.KindEncryptedDirectMessage}, Tags: nostr.TagMap{"p": {recipientPub}}}
+		return queryEvents(context.Background(), opts, relayList(opts), filter)
+	}
+
+	for i := 0; i < 2; i++ {
+		if events := query("--relay-event-cache-ttl", "1m"); len(events) != 1 {
+			t.Fatalf("call %d: expected 1 event, got %d", i+1, len(events))
+		}
+	}
+	if got := relay.connections.Load(); got != 1 {
+		t.Errorf("expected the second read to come from the cache, got %d connections", got)
+	}
+
+	query()
+	if got := relay.connections.Load(); got != 2 {
+		t.Errorf("expected reads without a TTL to query the relay, got %d connections", got)
+	}
+}
+
+func TestMemoryCacheExpires(t *testing.T) {
+	cache := &memoryCache{entries: make(map[string]cacheEntry)}
+	relays := []string{"wss://relay.example.com"}
+	filter := nostr.Filter{Kinds: []int{nostr.KindEncryptedDirectMessage}}
+	cache.put(relays, filter, []*nostr.Event{{ID: "a"}}, time.Millisecond)
+
+	if _, ok := cache.get(relays, nostr.Filter{Kinds: []int{nostr.KindGiftWrap}}); ok {
+		t.Error("expected a different filter to miss")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.get(relays, filter); ok {
+		t.Error("expected the entry to expire")
+	}
+}
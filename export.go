@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// defaultBatchSize is how many events export and aggregate hold before
+// flushing them.
+const defaultBatchSize = 500
+
+// exportMessages writes every received DM event, undecrypted, to --output
+// (or stdout) as one JSON object per line.
+func exportMessages(opts *options) (err error) {
+	start := time.Now()
+	defer func() { writeMetrics(opts, "export", start, err) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	privkey, err := resolvePrivateKey(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	pubkey, err := derivePublicKeyFromPrivate(privkey, opts.directDerive)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.output != "" {
+		f, err := os.OpenFile(opts.output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	write := func(evt *nostr.Event) error { return enc.Encode(evt) }
+
+	batch := make([]*nostr.Event, 0, opts.batchSize)
+	batches, total := 0, 0
+	flush := func(of int) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		batches++
+		if _, err := processBatch(batch, write); err != nil {
+			return fmt.Errorf("failed to write events: %w", err)
+		}
+		total += len(batch)
+		if of > 0 {
+			fmt.Fprintf(os.Stderr, "[ndm] Processed batch %d of %d\n", batches, of)
+		} else {
+			fmt.Fprintf(os.Stderr, "[ndm] Processed batch %d (%d events)\n", batches, total)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	if opts.importFile != "" {
+		events, err := loadEvents(opts.importFile)
+		if err != nil {
+			return fmt.Errorf("failed to import events: %w", err)
+		}
+		of := (len(events) + opts.batchSize - 1) / opts.batchSize
+		for _, evt := range events {
+			batch = append(batch, evt)
+			if len(batch) == opts.batchSize {
+				if err := flush(of); err != nil {
+					return err
+				}
+			}
+		}
+		if err := flush(of); err != nil {
+			return err
+		}
+	} else {
+		relays := relayList(opts)
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Exporting from: %v\n", relays)
+		}
+
+		filter := nostr.Filter{
+			Kinds: []int{nostr.KindEncryptedDirectMessage},
+			Tags:  nostr.TagMap{"p": []string{pubkey}},
+		}
+		seen := make(map[string]struct{})
+		for _, relay := range relays {
+			opts.stats.RelaysTried++
+			rc, err := connectRelay(ctx, opts, relay)
+			if err != nil {
+				if opts.verbose {
+					fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
+				}
+				continue
+			}
+			readCtx, cancel := withReadTimeout(ctx, opts)
+			eventsCh, err := rc.QueryEvents(readCtx, filter)
+			if err != nil {
+				cancel()
+				rc.Close()
+				continue
+			}
+			opts.stats.RelaysSucceeded++
+
+			for evt := range eventsCh {
+				if _, ok := seen[evt.ID]; ok {
+					continue
+				}
+				seen[evt.ID] = struct{}{}
+				batch = append(batch, evt)
+				if len(batch) == opts.batchSize {
+					if err := flush(0); err != nil {
+						cancel()
+						rc.Close()
+						return err
+					}
+				}
+			}
+			cancel()
+			rc.Close()
+		}
+		if err := flush(0); err != nil {
+			return err
+		}
+	}
+	opts.stats.EventsFetched = total
+
+	fmt.Fprintf(os.Stderr, "[ndm] Exported %d events\n", total)
+	return nil
+}
+
+// processBatch hands each event in one chunk to handle. It returns how many
+// events handle rejected along with the first error.
+func processBatch(events []*nostr.Event, handle func(*nostr.Event) error) (int, error) {
+	failed := 0
+	var first error
+	for _, evt := range events {
+		if err := handle(evt); err != nil {
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return failed, first
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestExportBatches(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	events := make([]*nostr.Event, 1200)
+	for i := range events {
+		events[i] = newTestDM(t, sender, recipientPub, "fixture")
+	}
+	input := writeEventsFile(t, events...)
+	output := filepath.Join(t.TempDir(), "export.jsonl")
+
+	opts, err := parseArgs([]string{
+		"export", "-k", recipient,
+		"--import-event", input,
+		"-o", output,
+		"--batch-size", "500",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs := captureStderr(t, func() {
+		if err := exportMessages(opts); err != nil {
+			t.Fatalf("exportMessages: %v", err)
+		}
+	})
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rows++
+	}
+	if rows != 1200 {
+		t.Errorf("expected 1200 rows, got %d", rows)
+	}
+
+	for _, want := range []string{"Processed batch 1 of 3", "Processed batch 2 of 3", "Processed batch 3 of 3"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected %q in log, got:\n%s", want, logs)
+		}
+	}
+	if n := strings.Count(logs, "Processed batch"); n != 3 {
+		t.Errorf("expected 3 batches, got %d", n)
+	}
+}
+
+func TestExportFromRelayDeduplicates(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	a := newTestDM(t, sender, recipientPub, "one")
+	b := newTestDM(t, sender, recipientPub, "two")
+
+	first := newMockRelay(t, a, b)
+	second := newMockRelay(t, a)
+	output := filepath.Join(t.TempDir(), "export.jsonl")
+
+	opts, err := parseArgs([]string{
+		"export", "-k", recipient,
+		"--allow-insecure-relays", "--relays", first.URL + "," + second.URL,
+		"-o", output,
+		"--batch-size", "1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs := captureStderr(t, func() {
+		if err := exportMessages(opts); err != nil {
+			t.Fatalf("exportMessages: %v", err)
+		}
+	})
+
+	loaded, err := loadEvents(output)
+	if err != nil {
+		t.Fatalf("loadEvents: %v", err)
+	}
+	if len(loaded) != 2 {
+		t.Errorf("expected 2 exported events, got %d", len(loaded))
+	}
+	if n := strings.Count(logs, "Processed batch"); n != 2 {
+		t.Errorf("expected 2 batches, got %d:\n%s", n, logs)
+	}
+}
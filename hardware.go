@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// fido2Device is a connected FIDO2/CTAP authenticator holding a Nostr key.
+// The private key never leaves the device: it signs event IDs and derives
+// NIP-44 conversation keys itself, each after a touch.
+type fido2Device interface {
+	// Description names the device, e.g. its manufacturer and USB path.
+	Description() string
+	// KeyHandle is the credential ID of the Nostr key on the device.
+	KeyHandle() string
+	// PublicKey is the hex x-only public key of that credential.
+	PublicKey() string
+	// WaitForPresence blocks until the user touches the device.
+	WaitForPresence(ctx context.Context) error
+	// Sign returns a 64-byte BIP-340 signature of a 32-byte hash.
+	Sign(ctx context.Context, hash []byte) ([]byte, error)
+	// ConversationKey derives the NIP-44 conversation key with pubkey.
+	ConversationKey(ctx context.Context, pubkey string) ([32]byte, error)
+}
+
+var errNoHardwareDevice = errors.New("no FIDO2 signing device found; connect one or sign with -k")
+
+// findFIDO2Devices lists connected authenticators. No USB backend is built in
+// yet, so it finds none; tests replace it with a stub.
+var findFIDO2Devices = func() ([]fido2Device, error) {
+	return nil, nil
+}
+
+// FIDO2Signer implements nostr.Keyer on top of a hardware device.
+type FIDO2Signer struct {
+	device fido2Device
+}
+
+var _ nostr.Keyer = (*FIDO2Signer)(nil)
+
+// newFIDO2Signer uses the first connected device. It fails rather than fall
+// back to a software key when there is none.
+func newFIDO2Signer() (*FIDO2Signer, error) {
+	devices, err := findFIDO2Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list FIDO2 devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return nil, errNoHardwareDevice
+	}
+	dev := devices[0]
+	fmt.Fprintf(os.Stderr, "Using %s (key handle %s)\n", dev.Description(), dev.KeyHandle())
+	return &FIDO2Signer{device: dev}, nil
+}
+
+func (s *FIDO2Signer) GetPublicKey(ctx context.Context) (string, error) {
+	return s.device.PublicKey(), nil
+}
+
+// SignEvent fills in the event's PubKey, ID and Sig, asking for a touch first.
+func (s *FIDO2Signer) SignEvent(ctx context.Context, evt *nostr.Event) error {
+	evt.PubKey = s.device.PublicKey()
+	hash := sha256.Sum256(evt.Serialize())
+
+	if err := s.touch(ctx, "sign"); err != nil {
+		return err
+	}
+	sig, err := s.device.Sign(ctx, hash[:])
+	if err != nil {
+		return fmt.Errorf("hardware signing failed: %w", err)
+	}
+	if len(sig) != 64 {
+		return fmt.Errorf("hardware signing failed: got a %d-byte signature", len(sig))
+	}
+
+	evt.ID = hex.EncodeToString(hash[:])
+	evt.Sig = hex.EncodeToString(sig)
+	return nil
+}
+
+func (s *FIDO2Signer) Encrypt(ctx context.Context, plaintext, recipient string) (string, error) {
+	ck, err := s.conversationKey(ctx, recipient)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Encrypt(plaintext, ck)
+}
+
+func (s *FIDO2Signer) Decrypt(ctx context.Context, ciphertext, sender string) (string, error) {
+	ck, err := s.conversationKey(ctx, sender)
+	if err != nil {
+		return "", err
+	}
+	return nip44.Decrypt(ciphertext, ck)
+}
+
+func (s *FIDO2Signer) conversationKey(ctx context.Context, pubkey string) ([32]byte, error) {
+	if err := s.touch(ctx, "encrypt"); err != nil {
+		return [32]byte{}, err
+	}
+	ck, err := s.device.ConversationKey(ctx, pubkey)
+	if err != nil {
+		return ck, fmt.Errorf("hardware key agreement failed: %w", err)
+	}
+	return ck, nil
+}
+
+func (s *FIDO2Signer) touch(ctx context.Context, action string) error {
+	fmt.Fprintf(os.Stderr, "Touch your security key to %s...\n", action)
+	if err := s.device.WaitForPresence(ctx); err != nil {
+		return fmt.Errorf("no user presence: %w", err)
+	}
+	return nil
+}
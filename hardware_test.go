@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// stubDevice simulates an authenticator holding privkey. touches counts how
+// many times user presence was requested.
+type stubDevice struct {
+	privkey string
+	touches int
+	absent  bool
+}
+
+func (d *stubDevice) Description() string { return "Stub Key" }
+func (d *stubDevice) KeyHandle() string   { return "c0ffee" }
+
+func (d *stubDevice) PublicKey() string {
+	pk, _ := nostr.GetPublicKey(d.privkey)
+	return pk
+}
+
+func (d *stubDevice) WaitForPresence(ctx context.Context) error {
+	d.touches++
+	if d.absent {
+		return errors.New("timed out waiting for touch")
+	}
+	return nil
+}
+
+func (d *stubDevice) Sign(ctx context.Context, hash []byte) ([]byte, error) {
+	raw, _ := hex.DecodeString(d.privkey)
+	sk, _ := btcec.PrivKeyFromBytes(raw)
+	sig, err := schnorr.Sign(sk, hash)
+	if err != nil {
+		return nil, err
+	}
+	return sig.Serialize(), nil
+}
+
+func (d *stubDevice) ConversationKey(ctx context.Context, pubkey string) ([32]byte, error) {
+	return nip44.GenerateConversationKey(pubkey, d.privkey)
+}
+
+func useStubDevice(t *testing.T, devices ...fido2Device) {
+	t.Helper()
+	orig := findFIDO2Devices
+	findFIDO2Devices = func() ([]fido2Device, error) { return devices, nil }
+	t.Cleanup(func() { findFIDO2Devices = orig })
+}
+
+func TestSignWithHardware(t *testing.T) {
+	device := &stubDevice{privkey: nostr.GeneratePrivateKey()}
+	useStubDevice(t, device)
+
+	relay := newMockRelay(t)
+	recipient := nostr.GeneratePrivateKey()
+	opts, err := parseArgs([]string{
+		"-r", recipient,
+		"-m", "signed on a key",
+		"--allow-insecure-relays", "--relays", relay.URL,
+		"--sign-with-hardware", "--nip", "4",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() {
+			if err := sendMessage(opts); err != nil {
+				t.Fatalf("sendMessage: %v", err)
+			}
+		})
+	})
+	if !strings.Contains(stderr, "key handle c0ffee") || !strings.Contains(stderr, "Touch your security key") {
+		t.Errorf("expected device and touch prompts, got:\n%s", stderr)
+	}
+	if device.touches != 2 {
+		t.Errorf("expected a touch to encrypt and one to sign, got %d", device.touches)
+	}
+
+	published := relay.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 published event, got %d", len(published))
+	}
+	evt := published[0]
+	if evt.PubKey != device.PublicKey() {
+		t.Errorf("expected event from the device key, got %s", evt.PubKey)
+	}
+	if ok, _ := evt.CheckSignature(); !ok {
+		t.Error("expected a valid signature")
+	}
+	if got, err := decryptMessage(recipient, evt.PubKey, evt.Content); err != nil || got != "signed on a key" {
+		t.Errorf("recipient could not decrypt: %q, %v", got, err)
+	}
+}
+
+func TestSignWithHardwareErrors(t *testing.T) {
+	opts := &options{
+		recipient:    nostr.GeneratePrivateKey(),
+		message:      "hi",
+		relays:       "ws://127.0.0.1:1",
+		wait:         time.Second,
+		hardwareSign: true,
+	}
+
+	useStubDevice(t)
+	if err := sendMessage(opts); !errors.Is(err, errNoHardwareDevice) {
+		t.Errorf("expected errNoHardwareDevice, got %v", err)
+	}
+
+	useStubDevice(t, &stubDevice{privkey: nostr.GeneratePrivateKey(), absent: true})
+	captureStderr(t, func() {
+		if err := sendMessage(opts); err == nil || !strings.Contains(err.Error(), "no user presence") {
+			t.Errorf("expected a user presence error, got %v", err)
+		}
+	})
+}
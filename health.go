@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// defaultMaxRelayErrors is how many failures in a row blacklist a relay.
+const defaultMaxRelayErrors = 3
+
+var errRelayBlacklisted = errors.New("relay blacklisted for this run after repeated errors")
+
+// relayHealth counts consecutive failures per relay for --max-relay-errors
+// and blacklists a relay for the rest of the run once it reaches max. A nil
+// relayHealth, or a max of 0, never blacklists.
+type relayHealth struct {
+	mu          sync.Mutex
+	max         int
+	failures    map[string]int
+	blacklisted map[string]bool
+}
+
+func newRelayHealth(max int) *relayHealth {
+	return &relayHealth{max: max, failures: make(map[string]int), blacklisted: make(map[string]bool)}
+}
+
+// blocked reports whether relay has been blacklisted.
+func (h *relayHealth) blocked(relay string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.blacklisted[relay]
+}
+
+// record notes the outcome of an operation on relay: success resets its
+// failure count, and the max-th failure in a row blacklists it.
+func (h *relayHealth) record(opts *options, relay string, err error) {
+	if h == nil || h.max <= 0 || errors.Is(err, errRelayBlacklisted) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		delete(h.failures, relay)
+		return
+	}
+	h.failures[relay]++
+	if h.failures[relay] >= h.max && !h.blacklisted[relay] {
+		h.blacklisted[relay] = true
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Skipping %s for the rest of this run after %d errors in a row\n", relay, h.failures[relay])
+		}
+	}
+}
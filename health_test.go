@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMaxRelayErrors(t *testing.T) {
+	var attempts atomic.Int32
+	bad := newFailingRelay(t, &attempts)
+	opts, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--allow-insecure-relays", "--relays", bad,
+		"--max-relay-errors", "2", "-v"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+
+	logs := captureStderr(t, func() {
+		captureStdout(t, func() {
+			for range 3 {
+				if err := readMessages(opts); err != nil {
+					t.Fatalf("readMessages: %v", err)
+				}
+			}
+		})
+	})
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("expected the relay to be skipped after 2 attempts, got %d", n)
+	}
+	if !strings.Contains(logs, "Skipping "+bad) {
+		t.Errorf("expected the blacklisting to be logged, got:\n%s", logs)
+	}
+}
+
+func TestRelayHealthReset(t *testing.T) {
+	errRelayTest := errors.New("boom")
+	health := newRelayHealth(2)
+	opts := &options{}
+	health.record(opts, "wss://a", errRelayTest)
+	health.record(opts, "wss://a", nil)
+	health.record(opts, "wss://a", errRelayTest)
+	if health.blocked("wss://a") {
+		t.Error("expected a success to reset the error count")
+	}
+	health.record(opts, "wss://a", errRelayTest)
+	if !health.blocked("wss://a") {
+		t.Error("expected two errors in a row to blacklist the relay")
+	}
+
+	var none *relayHealth
+	none.record(opts, "wss://a", errRelayTest)
+	if none.blocked("wss://a") || newRelayHealth(0).blocked("wss://a") {
+		t.Error("expected no blacklisting without a limit")
+	}
+}
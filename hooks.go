@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// runHook runs a user hook command with sh -c and extra environment
+// variables. Its output only reaches stderr in verbose mode, and a failing
+// hook is reported as a warning without affecting the command's result.
+func runHook(opts *options, flag, command string, env ...string) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = io.Discard
+	if opts.verbose {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Warning: %s command failed: %v\n", flag, err)
+	}
+}
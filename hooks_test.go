@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestOnSendSuccess(t *testing.T) {
+	relay := newMockRelay(t)
+	out := filepath.Join(t.TempDir(), "hook.txt")
+
+	send := func(hook string) error {
+		t.Helper()
+		opts, err := parseArgs([]string{
+			"-k", nostr.GeneratePrivateKey(),
+			"-r", nostr.GeneratePrivateKey(),
+			"-m", "hooked",
+			"--allow-insecure-relays", "--relays", relay.URL,
+			"--on-send-success", hook,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var sendErr error
+		captureStderr(t, func() {
+			captureStdout(t, func() { sendErr = sendMessage(opts) })
+		})
+		return sendErr
+	}
+
+	if err := send(`echo "$NDM_EVENT_ID $NDM_RELAYS_COUNT" > ` + out); err != nil {
+		t.Fatalf("sendMessage: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	published := relay.Published()
+	want := published[len(published)-1].ID + " 1"
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("hook wrote %q, want %q", got, want)
+	}
+
+	if err := send("exit 3"); err != nil {
+		t.Errorf("expected a failing hook not to fail the send, got %v", err)
+	}
+}
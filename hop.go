@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// hopRelays orders the relays for a --hop-via send: the hop relay first, then
+// the recipient's NIP-65 inbox relays if they publish any, else relays. The
+// hop relay is trusted to propagate the event to targets ndm cannot reach.
+func hopRelays(ctx context.Context, opts *options, relays []string, recipientPubkey string) []string {
+	targets := relays
+	if inbox := recipientInboxRelays(ctx, opts, relays, recipientPubkey); len(inbox) > 0 {
+		targets = inbox
+	}
+
+	path := []string{opts.hopVia}
+	for _, r := range targets {
+		if r != opts.hopVia {
+			path = append(path, r)
+		}
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Hop path: %s -> %v\n", opts.hopVia, path[1:])
+	}
+	return path
+}
+
+// recipientInboxRelays returns the read relays from the recipient's newest
+// kind-10002 relay list found on relays.
+func recipientInboxRelays(ctx context.Context, opts *options, relays []string, pubkey string) []string {
+	filter := nostr.Filter{
+		Kinds:   []int{nostr.KindRelayListMetadata},
+		Authors: []string{pubkey},
+		Limit:   1,
+	}
+	var latest *nostr.Event
+	for _, relay := range relays {
+		rc, err := connectRelay(ctx, opts, relay)
+		if err != nil {
+			continue
+		}
+		readCtx, cancel := withReadTimeout(ctx, opts)
+		if eventsCh, err := rc.QueryEvents(readCtx, filter); err == nil {
+			for evt := range eventsCh {
+				if latest == nil || evt.CreatedAt > latest.CreatedAt {
+					latest = evt
+				}
+			}
+		}
+		cancel()
+		rc.Close()
+	}
+	if latest == nil {
+		return nil
+	}
+
+	var inbox []string
+	for tag := range latest.Tags.FindAll("r") {
+		if len(tag) == 2 || tag[2] == "read" {
+			inbox = append(inbox, tag[1])
+		}
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Recipient inbox relays: %v\n", inbox)
+	}
+	return inbox
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestHopVia(t *testing.T) {
+	hop := newMockRelay(t)
+	target := newFailingRelay(t, nil)
+
+	opts, err := parseArgs([]string{
+		"-k", nostr.GeneratePrivateKey(),
+		"-r", nostr.GeneratePrivateKey(),
+		"-m", "through the hop",
+		"--allow-insecure-relays", "--relays", target,
+		"--hop-via", hop.URL,
+		"-v",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() {
+			if err := sendMessage(opts); err != nil {
+				t.Fatalf("sendMessage: %v", err)
+			}
+		})
+	})
+	if got := len(hop.Published()); got != 1 {
+		t.Errorf("expected the event on the hop relay, got %d events", got)
+	}
+	if !strings.Contains(stderr, "Hop path: "+hop.URL) {
+		t.Errorf("expected hop path in verbose log, got:\n%s", stderr)
+	}
+}
+
+func TestHopViaRecipientInboxRelays(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+
+	unreachable := newFailingRelay(t, nil)
+	alternative := newMockRelay(t)
+	outboxOnly := newMockRelay(t)
+
+	relayList := &nostr.Event{
+		Kind:      nostr.KindRelayListMetadata,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"r", unreachable, "read"},
+			{"r", alternative.URL},
+			{"r", outboxOnly.URL, "write"},
+		},
+	}
+	if err := relayList.Sign(recipient); err != nil {
+		t.Fatal(err)
+	}
+	hop := newMockRelay(t, relayList)
+
+	opts := &options{
+		key:           nostr.GeneratePrivateKey(),
+		recipient:     recipient,
+		message:       "find me",
+		relays:        hop.URL,
+		hopVia:        hop.URL,
+		wait:          5 * time.Second,
+		allowInsecure: true,
+	}
+	captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+
+	if got := len(hop.Published()); got != 1 {
+		t.Errorf("expected 1 event on the hop relay, got %d", got)
+	}
+	if got := len(alternative.Published()); got != 1 {
+		t.Errorf("expected the reachable inbox relay to get the event, got %d", got)
+	}
+	if got := len(outboxOnly.Published()); got != 0 {
+		t.Errorf("expected write-only relay to be skipped, got %d", got)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// bech32Charset holds the characters that can appear in an npub.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func keygenCommand(opts *options) error {
+	privkey := nostr.GeneratePrivateKey()
+	if opts.vanityPrefix != "" {
+		var err error
+		if privkey, err = mineVanityKey(opts); err != nil {
+			return err
+		}
+	}
+	pubkey, err := nostr.GetPublicKey(privkey)
+	if err != nil {
+		return fmt.Errorf("failed to derive public key: %w", err)
+	}
+	npub, err := nip19.EncodePublicKey(pubkey)
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	// With --public-key-only the private key goes out of scope here without
+	// ever being encoded or written anywhere.
+	if opts.publicKeyOnly {
+		if opts.jsonOutput {
+			out, _ := marshalJSON(map[string]string{"npub": npub, "pubkey": pubkey}, opts)
+			fmt.Println(string(out))
+		} else {
+			fmt.Println(npub)
+		}
+		fmt.Fprintln(os.Stderr, "Note: the private key was not retained. Messages sent to this pubkey cannot be read.")
+		return nil
+	}
+
+	nsec, err := nip19.EncodePrivateKey(privkey)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	if opts.jsonOutput {
+		out, _ := marshalJSON(map[string]string{"nsec": nsec, "npub": npub, "pubkey": pubkey}, opts)
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("nsec: %s\n", nsec)
+		fmt.Printf("npub: %s\n", npub)
+	}
+	return nil
+}
+
+// mineVanityKey generates keys on every CPU until one's npub starts with
+// npub1<--vanity-key>, or --vanity-timeout runs out.
+func mineVanityKey(opts *options) (string, error) {
+	ctx := context.Background()
+	if opts.vanityTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.vanityTimeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	want := "npub1" + opts.vanityPrefix
+	workers := runtime.NumCPU()
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Searching for %s... with %d workers\n", want, workers)
+	}
+
+	start := time.Now()
+	var attempts atomic.Int64
+	found := make(chan string, 1)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				privkey := nostr.GeneratePrivateKey()
+				pubkey, _ := nostr.GetPublicKey(privkey)
+				npub, _ := nip19.EncodePublicKey(pubkey)
+				attempts.Add(1)
+				if strings.HasPrefix(npub, want) {
+					select {
+					case found <- privkey:
+					default:
+					}
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case privkey := <-found:
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Found a match after %d attempts in %v\n", attempts.Load(), time.Since(start).Round(time.Millisecond))
+		}
+		return privkey, nil
+	default:
+		return "", fmt.Errorf("no npub starting with %s found within --vanity-timeout %v (%d attempts)", want, opts.vanityTimeout, attempts.Load())
+	}
+}
+
+// validVanityPrefix reports whether every character of prefix can appear in
+// an npub.
+func validVanityPrefix(prefix string) bool {
+	for _, c := range prefix {
+		if !strings.ContainsRune(bech32Charset, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestKeygenPublicKeyOnly(t *testing.T) {
+	for _, jsonOut := range []bool{false, true} {
+		args := []string{"keygen", "--public-key-only"}
+		if jsonOut {
+			args = append(args, "--json")
+		}
+		opts, err := parseArgs(args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var out string
+		stderr := captureStderr(t, func() {
+			out = captureStdout(t, func() {
+				if err := keygenCommand(opts); err != nil {
+					t.Fatalf("keygen: %v", err)
+				}
+			})
+		})
+
+		if strings.Contains(out, "nsec") {
+			t.Errorf("output must not contain a private key: %q", out)
+		}
+		if !strings.Contains(stderr, "not retained") {
+			t.Errorf("expected a notice on stderr, got %q", stderr)
+		}
+		if !jsonOut {
+			npub := strings.TrimSpace(out)
+			if prefix, _, err := nip19.Decode(npub); err != nil || prefix != "npub" {
+				t.Errorf("expected a single npub, got %q", out)
+			}
+		}
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	opts, err := parseArgs([]string{"keygen"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := keygenCommand(opts); err != nil {
+			t.Fatalf("keygen: %v", err)
+		}
+	})
+	if !strings.Contains(out, "nsec: nsec1") || !strings.Contains(out, "npub: npub1") {
+		t.Errorf("expected nsec and npub, got %q", out)
+	}
+}
+
+func TestKeygenVanityKey(t *testing.T) {
+	opts, err := parseArgs([]string{"keygen", "--vanity-key", "a", "--vanity-timeout", "30s", "-v"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out string
+	stderr := captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			if err := keygenCommand(opts); err != nil {
+				t.Fatalf("keygen: %v", err)
+			}
+		})
+	})
+
+	var nsec, npub string
+	for _, line := range strings.Split(out, "\n") {
+		if v, ok := strings.CutPrefix(line, "nsec: "); ok {
+			nsec = v
+		}
+		if v, ok := strings.CutPrefix(line, "npub: "); ok {
+			npub = v
+		}
+	}
+	if !strings.HasPrefix(npub, "npub1a") {
+		t.Fatalf("expected an npub starting with npub1a, got:\n%s", out)
+	}
+	pubkey, err := resolveKey(nsec)
+	if err != nil {
+		t.Fatalf("invalid nsec %q: %v", nsec, err)
+	}
+	if derived, _ := nip19.EncodePublicKey(pubkey); derived != npub {
+		t.Errorf("nsec belongs to %s, not %s", derived, npub)
+	}
+	if !strings.Contains(stderr, "attempts") {
+		t.Errorf("expected the attempt count in verbose output, got %q", stderr)
+	}
+
+	for _, bad := range []string{"b", "1", "I"} {
+		if _, err := parseArgs([]string{"keygen", "--vanity-key", bad}); err == nil {
+			t.Errorf("expected --vanity-key %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMineVanityKeyTimeout(t *testing.T) {
+	opts := &options{vanityPrefix: "qqqqqqqqqqqq", vanityTimeout: 50 * time.Millisecond}
+	if _, err := mineVanityKey(opts); err == nil || !strings.Contains(err.Error(), "--vanity-timeout") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39/wordlists"
+)
+
+var (
+	nsecPattern   = regexp.MustCompile(`nsec1[a-z0-9]{58}`)
+	hexKeyPattern = regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`)
+	wordPattern   = regexp.MustCompile(`[a-zA-Z]+`)
+
+	mnemonicWords = func() map[string]struct{} {
+		words := make(map[string]struct{}, len(wordlists.English))
+		for _, w := range wordlists.English {
+			words[w] = struct{}{}
+		}
+		return words
+	}()
+)
+
+// scanForKeys reports which kinds of secret key material appear in text.
+func scanForKeys(text string) []string {
+	var found []string
+	if nsecPattern.MatchString(text) {
+		found = append(found, "nsec private key")
+	}
+	if hexKeyPattern.MatchString(text) {
+		found = append(found, "64-character hex key")
+	}
+
+	run := 0
+	for _, w := range wordPattern.FindAllString(text, -1) {
+		if _, ok := mnemonicWords[strings.ToLower(w)]; !ok {
+			run = 0
+			continue
+		}
+		run++
+		if run == 12 {
+			found = append(found, "mnemonic seed phrase")
+			break
+		}
+	}
+	return found
+}
+
+// checkMessageForKeys warns on stderr when the message looks like it
+// contains a private key and refuses to continue unless --force is set.
+func checkMessageForKeys(opts *options) error {
+	found := scanForKeys(opts.message)
+	if len(found) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: the message appears to contain secret key material:\n")
+	for _, f := range found {
+		fmt.Fprintf(os.Stderr, "  - %s\n", f)
+	}
+	if opts.force {
+		fmt.Fprintf(os.Stderr, "Continuing because --force was given.\n")
+		return nil
+	}
+	return fmt.Errorf("refusing to send a message that may contain a private key (use --force to send anyway)")
+}
+
+// keyscanCommand scans -m, the positional arguments or stdin for keys.
+func keyscanCommand(opts *options) error {
+	text := opts.message
+	if text == "" && len(opts.args) > 0 {
+		text = strings.Join(opts.args, " ")
+	}
+	if text == "" {
+		data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		text = string(data)
+	}
+
+	found := scanForKeys(text)
+	if len(found) == 0 {
+		fmt.Println("No keys detected")
+		return nil
+	}
+	for _, f := range found {
+		fmt.Printf("Detected: %s\n", f)
+	}
+	return fmt.Errorf("secret key material detected")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestScanForKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"plain text", "see you at lunch tomorrow", ""},
+		{"nsec", "my key is nsec1" + strings.Repeat("q", 58) + " oops", "nsec private key"},
+		{"hex key", "key: " + strings.Repeat("ab", 32), "64-character hex key"},
+		{"mnemonic", "abandon ability able about above absent absorb abstract absurd abuse access accident", "mnemonic seed phrase"},
+		{"short word run", "abandon ability able about above absent", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := scanForKeys(tt.message)
+			if tt.want == "" {
+				if len(found) != 0 {
+					t.Errorf("expected nothing, got %v", found)
+				}
+				return
+			}
+			if len(found) != 1 || found[0] != tt.want {
+				t.Errorf("expected [%s], got %v", tt.want, found)
+			}
+		})
+	}
+}
+
+func TestSendRefusesPastedKey(t *testing.T) {
+	relay := newMockRelay(t)
+	args := []string{
+		"-k", nostr.GeneratePrivateKey(),
+		"-r", nostr.GeneratePrivateKey(),
+		"-m", "here you go nsec1" + strings.Repeat("q", 58),
+		"--allow-insecure-relays", "--relays", relay.URL,
+		"--dry-run",
+	}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var sendErr error
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() { sendErr = sendMessage(opts) })
+	})
+	if sendErr == nil || !strings.Contains(sendErr.Error(), "--force") {
+		t.Errorf("expected refusal mentioning --force, got %v", sendErr)
+	}
+	if !strings.Contains(stderr, "WARNING") || !strings.Contains(stderr, "nsec private key") {
+		t.Errorf("expected warning on stderr, got %q", stderr)
+	}
+
+	opts, err = parseArgs(append(args, "--force"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out string
+	captureStderr(t, func() {
+		out = captureStdout(t, func() { sendErr = sendMessage(opts) })
+	})
+	if sendErr != nil {
+		t.Errorf("expected --force to continue, got %v", sendErr)
+	}
+	if !strings.Contains(out, `"sig"`) {
+		t.Errorf("expected signed event output, got %q", out)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// keyShareCommand handles key-share split and key-share combine.
+func keyShareCommand(opts *options) error {
+	usage := "usage: ndm key-share split -k <key> --shares <n> --threshold <k> | ndm key-share combine [--shares <s1,s2,...> | <file>]"
+	if len(opts.args) == 0 {
+		return errors.New(usage)
+	}
+	switch opts.args[0] {
+	case "split":
+		return keyShareSplit(opts)
+	case "combine":
+		return keyShareCombine(opts)
+	default:
+		return fmt.Errorf("unknown key-share command: %s (want split or combine)", opts.args[0])
+	}
+}
+
+// keyShareSplit prints the shares of the -k key, one base64 line each.
+func keyShareSplit(opts *options) error {
+	if opts.key == "" {
+		return fmt.Errorf("missing required flag: -k/--key (the key to split)")
+	}
+	n, err := strconv.Atoi(opts.shares)
+	if err != nil || n < 2 || n > 255 {
+		return fmt.Errorf("invalid --shares: %q (want a number of shares from 2 to 255)", opts.shares)
+	}
+	if opts.threshold < 2 || opts.threshold > n {
+		return fmt.Errorf("invalid --threshold: %d (want 2 to --shares)", opts.threshold)
+	}
+	privkey, err := resolvePrivateKey(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	secret, _ := hex.DecodeString(privkey)
+
+	shares, err := splitSecret(secret, n, opts.threshold)
+	if err != nil {
+		return err
+	}
+	for _, share := range shares {
+		fmt.Println(base64.StdEncoding.EncodeToString(share))
+	}
+	fmt.Fprintf(os.Stderr, "Note: any %d of these %d shares recover the key; store them apart.\n", opts.threshold, n)
+	return nil
+}
+
+// keyShareCombine rebuilds an nsec from shares given with --shares, in a
+// file, or on stdin.
+func keyShareCombine(opts *options) error {
+	var lines []string
+	switch {
+	case opts.shares != "":
+		lines = strings.Split(opts.shares, ",")
+	case len(opts.args) > 1:
+		f, err := os.Open(opts.args[1])
+		if err != nil {
+			return fmt.Errorf("failed to read shares: %w", err)
+		}
+		defer f.Close()
+		lines = readShareLines(f)
+	default:
+		lines = readShareLines(os.Stdin)
+	}
+
+	var shares [][]byte
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		share, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return fmt.Errorf("invalid share %q: %w", line, err)
+		}
+		shares = append(shares, share)
+	}
+
+	secret, err := combineShares(shares)
+	if err != nil {
+		return err
+	}
+	nsec, err := nip19.EncodePrivateKey(hex.EncodeToString(secret))
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	fmt.Println(nsec)
+	return nil
+}
+
+func readShareLines(r io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// splitSecret splits secret into n Shamir shares over GF(256), any
+// threshold of which recover it. Each share is the threshold, its x
+// coordinate and one y byte per secret byte.
+func splitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, 2, 2+len(secret))
+		shares[i][0] = byte(threshold)
+		shares[i][1] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for _, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate shares: %w", err)
+		}
+		for i := range shares {
+			shares[i] = append(shares[i], evalPolynomial(coeffs, shares[i][1]))
+		}
+	}
+	return shares, nil
+}
+
+// combineShares recovers the secret from at least threshold shares made by
+// splitSecret.
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	threshold, size := int(shares[0][0]), len(shares[0])
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) < 3 || len(share) != size || int(share[0]) != threshold {
+			return nil, errors.New("shares do not belong to the same split")
+		}
+		if share[1] == 0 || seen[share[1]] {
+			return nil, errors.New("duplicate or invalid share")
+		}
+		seen[share[1]] = true
+	}
+	if len(shares) < threshold {
+		return nil, fmt.Errorf("need %d shares to recover the key, got %d", threshold, len(shares))
+	}
+	shares = shares[:threshold]
+
+	// Lagrange interpolation at x = 0, byte by byte.
+	secret := make([]byte, size-2)
+	for i := range secret {
+		var value byte
+		for j, sj := range shares {
+			basis := byte(1)
+			for m, sm := range shares {
+				if m != j {
+					basis = gfMul(basis, gfDiv(sm[1], sm[1]^sj[1]))
+				}
+			}
+			value ^= gfMul(sj[2+i], basis)
+		}
+		secret[i] = value
+	}
+	return secret, nil
+}
+
+// evalPolynomial evaluates the polynomial with coefficients coeffs (constant
+// term first) at x in GF(256).
+func evalPolynomial(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial x^8+x^4+x^3+x+1.
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gfDiv divides in GF(256); b must not be 0. The inverse of b is b^254.
+func gfDiv(a, b byte) byte {
+	inv := byte(1)
+	for range 254 {
+		inv = gfMul(inv, b)
+	}
+	return gfMul(a, inv)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestKeyShare(t *testing.T) {
+	privkey := nostr.GeneratePrivateKey()
+	nsec, _ := nip19.EncodePrivateKey(privkey)
+
+	opts, err := parseArgs([]string{"key-share", "split", "-k", nsec, "--shares", "5", "--threshold", "3"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	var out string
+	captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			if err := keyShareCommand(opts); err != nil {
+				t.Fatalf("split: %v", err)
+			}
+		})
+	})
+	shares := strings.Fields(out)
+	if len(shares) != 5 {
+		t.Fatalf("expected 5 shares, got %d:\n%s", len(shares), out)
+	}
+
+	combine := func(picked ...string) (string, error) {
+		t.Helper()
+		opts, err := parseArgs([]string{"key-share", "combine", "--shares", strings.Join(picked, ",")})
+		if err != nil {
+			t.Fatalf("parseArgs: %v", err)
+		}
+		var combineErr error
+		out := captureStdout(t, func() {
+			combineErr = keyShareCommand(opts)
+		})
+		return strings.TrimSpace(out), combineErr
+	}
+
+	for _, picked := range [][]string{
+		{shares[0], shares[1], shares[2]},
+		{shares[4], shares[2], shares[0]},
+		{shares[1], shares[3], shares[4], shares[0]},
+	} {
+		got, err := combine(picked...)
+		if err != nil {
+			t.Fatalf("combine: %v", err)
+		}
+		if got != nsec {
+			t.Errorf("expected %s, got %s", nsec, got)
+		}
+	}
+
+	if _, err := combine(shares[0], shares[3]); err == nil {
+		t.Error("expected two shares of a 3-of-5 split to fail")
+	}
+	if _, err := combine(shares[0], shares[0], shares[1]); err == nil {
+		t.Error("expected duplicate shares to fail")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// lastReadPath returns the state file holding, per pubkey, the timestamp of
+// the newest message already read.
+func lastReadPath() string {
+	return dataPath("last_read.json")
+}
+
+func loadLastRead(pubkey string) (nostr.Timestamp, error) {
+	state, err := loadLastReadState()
+	if err != nil {
+		return 0, err
+	}
+	return state[pubkey], nil
+}
+
+func loadLastReadState() (map[string]nostr.Timestamp, error) {
+	state := make(map[string]nostr.Timestamp)
+	data, err := os.ReadFile(lastReadPath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid last-read state: %w", err)
+	}
+	return state, nil
+}
+
+// saveLastRead records ts for pubkey, keeping other pubkeys' entries.
+func saveLastRead(pubkey string, ts nostr.Timestamp) error {
+	state, err := loadLastReadState()
+	if err != nil {
+		return err
+	}
+	state[pubkey] = ts
+
+	out, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := lastReadPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o600)
+}
+
+// newestTimestamp returns the latest CreatedAt among events, or 0.
+func newestTimestamp(events []*nostr.Event) nostr.Timestamp {
+	var newest nostr.Timestamp
+	for _, e := range events {
+		if e.CreatedAt > newest {
+			newest = e.CreatedAt
+		}
+	}
+	return newest
+}
+
+// newestEvent returns the most recent of events, which must not be empty.
+func newestEvent(events []*nostr.Event) *nostr.Event {
+	newest := events[0]
+	for _, e := range events[1:] {
+		if e.CreatedAt > newest.CreatedAt {
+			newest = e
+		}
+	}
+	return newest
+}
+
+// inboxZeroCommand marks every message received so far as read.
+func inboxZeroCommand(opts *options) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	privkey, err := resolvePrivateKey(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	pubkey, err := derivePublicKeyFromPrivate(privkey, opts.directDerive)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	lastRead, err := loadLastRead(pubkey)
+	if err != nil {
+		return err
+	}
+
+	filter := nostr.Filter{
+		Kinds: []int{nostr.KindEncryptedDirectMessage, nostr.KindGiftWrap},
+		Tags:  nostr.TagMap{"p": []string{pubkey}},
+	}
+	if lastRead > 0 {
+		setSince(&filter, lastRead+1)
+	}
+
+	seen := make(map[string]struct{})
+	var events []*nostr.Event
+	for _, e := range fetchEvents(ctx, opts, relayList(opts), filter) {
+		if _, ok := seen[e.ID]; !ok {
+			seen[e.ID] = struct{}{}
+			events = append(events, e)
+		}
+	}
+	// A wrap's own time is randomized; the rumor inside has the real one.
+	events = slices.DeleteFunc(unwrapGiftWraps(events, privkey, opts), func(e *nostr.Event) bool {
+		return e.Kind == nostr.KindGiftWrap
+	})
+	events = dropBefore(events, lastRead+1)
+
+	newest := newestTimestamp(events)
+	if newest <= lastRead {
+		fmt.Println("Inbox already at zero")
+		return nil
+	}
+
+	when := time.Unix(int64(newest), 0).Format(time.RFC3339)
+	if opts.dryRun {
+		fmt.Printf("Would mark %d messages as read (last read: %d, %s)\n", len(events), newest, when)
+		return nil
+	}
+	if err := saveLastRead(pubkey, newest); err != nil {
+		return fmt.Errorf("failed to save last-read state: %w", err)
+	}
+	fmt.Printf("Marked %d messages as read (last read: %d, %s)\n", len(events), newest, when)
+	return nil
+}
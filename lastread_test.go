@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/nip59"
+)
+
+// newTestWrap gift-wraps a kind-14 message sent at sentAt in a wrap dated
+// wrappedAt.
+func newTestWrap(t *testing.T, senderPriv, recipientPub, msg string, sentAt, wrappedAt nostr.Timestamp) *nostr.Event {
+	t.Helper()
+	senderPub, _ := nostr.GetPublicKey(senderPriv)
+	rumor := nostr.Event{Kind: nostr.KindDirectMessage, PubKey: senderPub, CreatedAt: sentAt, Tags: nostr.Tags{{"p", recipientPub}}, Content: msg}
+	rumor.ID = rumor.GetID()
+	wrap, err := nip59.GiftWrap(rumor, recipientPub,
+		func(plaintext string) (string, error) {
+			key, err := nip44.GenerateConversationKey(recipientPub, senderPriv)
+			if err != nil {
+				return "", err
+			}
+			return nip44.Encrypt(plaintext, key)
+		},
+		func(seal *nostr.Event) error { return seal.Sign(senderPriv) },
+		func(wrap *nostr.Event) { wrap.CreatedAt = wrappedAt },
+	)
+	if err != nil {
+		t.Fatalf("GiftWrap: %v", err)
+	}
+	return &wrap
+}
+
+func TestInboxZero(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	var events []*nostr.Event
+	for _, ts := range []nostr.Timestamp{100, 200, 300} {
+		evt := newTestDM(t, sender, recipientPub, "old news")
+		evt.CreatedAt = ts
+		if err := evt.Sign(sender); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, evt)
+	}
+	// The newest message sits in a wrap dated before all the others.
+	events = append(events, newTestWrap(t, sender, recipientPub, "wrapped news", 400, 50))
+	relay := newMockRelay(t, events...)
+
+	ndm := func(args ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append(args, "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			var err error
+			if opts.command == "inbox-zero" {
+				err = inboxZeroCommand(opts)
+			} else {
+				err = readMessages(opts)
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", opts.command, err)
+			}
+		})
+	}
+
+	out := ndm("inbox-zero", "--dry-run")
+	if !strings.Contains(out, "Would mark 4 messages") {
+		t.Errorf("unexpected dry-run output: %q", out)
+	}
+	if ts, _ := loadLastRead(recipientPub); ts != 0 {
+		t.Errorf("dry run wrote state: %d", ts)
+	}
+
+	out = ndm("inbox-zero")
+	if !strings.Contains(out, "Marked 4 messages") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	ts, err := loadLastRead(recipientPub)
+	if err != nil {
+		t.Fatalf("loadLastRead: %v", err)
+	}
+	if ts != 400 {
+		t.Errorf("last read = %d, want 400", ts)
+	}
+
+	if out = ndm("read", "--since-last-read"); !strings.Contains(out, "No messages found") {
+		t.Errorf("expected no messages after inbox-zero, got:\n%s", out)
+	}
+}
+
+func TestSinceEvent(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	dm := func(msg string, at nostr.Timestamp) *nostr.Event {
+		evt := newTestDM(t, sender, recipientPub, msg)
+		evt.CreatedAt = at
+		if err := evt.Sign(sender); err != nil {
+			t.Fatal(err)
+		}
+		return evt
+	}
+	older := dm("older", 1000)
+	anchor := dm("anchor", 2000)
+	newer := dm("newer", 3000)
+	newest := dm("newest", 4000)
+	relay := newMockRelay(t, older, anchor, newer, newest)
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL,
+		"--since-event", anchor.ID, "--json"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+
+	var sinces []nostr.Timestamp
+	for _, filters := range relay.Requests() {
+		if since := filters[0].Since; since != nil {
+			sinces = append(sinces, *since)
+		}
+	}
+	if want := anchor.CreatedAt - nostr.Timestamp(giftWrapWindow.Seconds()); len(sinces) != 1 || sinces[0] != want {
+		t.Errorf("expected one query since %d, got %v", want, sinces)
+	}
+
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(msgs) != 3 || msgs[0]["content"] == "older" || msgs[0]["content"] == "anchor" || msgs[1]["content"] == "anchor" {
+		t.Fatalf("expected the two newer messages and a cursor, got:\n%s", out)
+	}
+	if cursor := msgs[2]; cursor["type"] != "cursor" || cursor["prev_cursor"] != newest.ID {
+		t.Errorf("expected a cursor at %s, got %v", newest.ID, cursor)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--since-event", anchor.ID, "--max-age", "1h"}); err == nil {
+		t.Error("expected error combining --since-event with --max-age")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// pingRelay measures how long relay takes to connect and answer an empty
+// subscription with EOSE.
+func pingRelay(ctx context.Context, opts *options, relay string) (time.Duration, error) {
+	ctx, cancel := withReadTimeout(ctx, opts)
+	defer cancel()
+
+	began := time.Now()
+	rc, err := connectRelay(ctx, opts, relay)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	events, err := rc.QueryEvents(ctx, nostr.Filter{Kinds: []int{nostr.KindEncryptedDirectMessage}, LimitZero: true})
+	if err != nil {
+		return 0, err
+	}
+	for range events {
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return time.Since(began), nil
+}
+
+// sortRelaysByLatency pings every relay in parallel and returns them fastest
+// first for --relay-latency-sort. Relays that fail the ping keep their order
+// at the end.
+func sortRelaysByLatency(opts *options, relays []string) []string {
+	latencies := make([]time.Duration, len(relays))
+	failed := make([]bool, len(relays))
+
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := pingRelay(context.Background(), opts, relay)
+			latencies[i], failed[i] = latency, err != nil
+		}()
+	}
+	wg.Wait()
+
+	order := make([]int, len(relays))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if failed[i] != failed[j] {
+			return !failed[i]
+		}
+		return !failed[i] && latencies[i] < latencies[j]
+	})
+
+	sorted := make([]string, len(relays))
+	for k, i := range order {
+		sorted[k] = relays[i]
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Relays by latency:\n")
+		for _, i := range order {
+			if failed[i] {
+				fmt.Fprintf(os.Stderr, "[ndm]   %s (unreachable)\n", relays[i])
+			} else {
+				fmt.Fprintf(os.Stderr, "[ndm]   %s (%dms)\n", relays[i], latencies[i].Milliseconds())
+			}
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelayLatencySort(t *testing.T) {
+	medium := newMockRelay(t)
+	medium.delay = 10 * time.Millisecond
+	slow := newMockRelay(t)
+	slow.delay = 50 * time.Millisecond
+	fast := newMockRelay(t)
+	fast.delay = 5 * time.Millisecond
+	dead := newFailingRelay(t, nil)
+
+	opts, err := parseArgs([]string{
+		"read", "-k", "k",
+		"--allow-insecure-relays", "--relays", strings.Join([]string{dead, medium.URL, slow.URL, fast.URL}, ","),
+		"--relay-latency-sort",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := relayList(opts)
+	want := []string{fast.URL, medium.URL, slow.URL, dead}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("relayList() = %v, want %v", got, want)
+	}
+}
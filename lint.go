@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// maxContentLength is the content size most relays accept.
+const maxContentLength = 64 * 1024
+
+// maxClockSkew is how far created_at may be from now before lint-event
+// flags it.
+const maxClockSkew = 2 * time.Hour
+
+// knownKinds are the event kinds defined by NIPs that lint-event accepts.
+var knownKinds = map[int]bool{
+	0: true, 1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true,
+	8: true, 9: true, 10: true, 11: true, 12: true, 13: true, 14: true, 15: true,
+	16: true, 40: true, 41: true, 42: true, 43: true, 44: true, 1018: true,
+	1021: true, 1022: true, 1059: true, 1063: true, 1068: true, 1111: true,
+	1311: true, 1984: true, 1985: true, 4550: true, 9041: true, 9734: true,
+	9735: true, 9802: true, 10000: true, 10001: true, 10002: true, 10003: true,
+	10004: true, 10005: true, 10006: true, 10007: true, 10015: true, 10030: true,
+	10050: true, 10063: true, 13194: true, 22242: true, 23194: true, 23195: true,
+	24133: true, 27235: true, 30000: true, 30002: true, 30003: true, 30004: true,
+	30008: true, 30009: true, 30015: true, 30017: true, 30018: true, 30023: true,
+	30024: true, 30030: true, 30078: true, 30311: true, 30315: true, 30402: true,
+	30403: true, 31922: true, 31923: true, 31924: true, 31925: true, 31989: true,
+	31990: true, 34550: true,
+}
+
+// lintCheck is one line of the lint-event checklist. Warnings are shown but
+// do not fail the run.
+type lintCheck struct {
+	name    string
+	ok      bool
+	warning bool
+	detail  string
+}
+
+// lintEvent runs every check against e. With strict it also warns about DM
+// content that does not look encrypted.
+func lintEvent(e *nostr.Event, strict bool, now time.Time) []lintCheck {
+	var checks []lintCheck
+	add := func(name string, ok bool, detail string) {
+		checks = append(checks, lintCheck{name: name, ok: ok, detail: detail})
+	}
+
+	add("id matches the event hash", e.CheckID(), "expected "+e.GetID())
+
+	sigOK, err := e.CheckSignature()
+	detail := "signature does not verify"
+	if err != nil {
+		detail = err.Error()
+	}
+	add("signature is valid", sigOK, detail)
+
+	skew := now.Sub(e.CreatedAt.Time())
+	add("created_at within 2 hours of now", skew.Abs() <= maxClockSkew,
+		fmt.Sprintf("off by %s", skew.Round(time.Second)))
+
+	add("kind is defined by a NIP", knownKinds[e.Kind], fmt.Sprintf("unknown kind %d", e.Kind))
+
+	for _, name := range []string{"p", "e"} {
+		var bad []string
+		for tag := range e.Tags.FindAll(name) {
+			if len(tag[1]) != 64 || !isHex(tag[1]) {
+				bad = append(bad, tag[1])
+			}
+		}
+		add(fmt.Sprintf("%s tags are 64-char hex", name), len(bad) == 0, "bad values: "+strings.Join(bad, ", "))
+	}
+
+	add("content within 64KB", len(e.Content) <= maxContentLength,
+		fmt.Sprintf("content is %d bytes", len(e.Content)))
+
+	if tag := e.Tags.Find("expiration"); tag != nil {
+		exp, err := strconv.ParseInt(tag[1], 10, 64)
+		add("expiration is in the future", err == nil && exp > now.Unix(), "expiration "+tag[1])
+	}
+
+	if strict && e.Kind == nostr.KindEncryptedDirectMessage && !looksEncrypted(e.Content) {
+		checks = append(checks, lintCheck{
+			name:    "DM content is encrypted",
+			warning: true,
+			detail:  "content does not look like NIP-04 or NIP-44 ciphertext",
+		})
+	}
+	return checks
+}
+
+// looksEncrypted reports whether content has the shape of NIP-04
+// ("<base64>?iv=<base64>") or NIP-44 (versioned base64) ciphertext.
+func looksEncrypted(content string) bool {
+	if strings.Contains(content, "?iv=") {
+		return true
+	}
+	return len(content) >= 132 && !strings.ContainsAny(content, " \n")
+}
+
+// lintEventCommand checks the event in opts.args[0] and prints a checklist.
+func lintEventCommand(opts *options) error {
+	if len(opts.args) == 0 {
+		return fmt.Errorf("usage: ndm lint-event <json-file>")
+	}
+	data, err := os.ReadFile(opts.args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read event: %w", err)
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("invalid event JSON: %w", err)
+	}
+
+	failed := 0
+	for _, c := range lintEvent(&event, opts.strict, time.Now()) {
+		switch {
+		case c.warning:
+			fmt.Printf("! %s: %s\n", c.name, c.detail)
+		case c.ok:
+			fmt.Printf("✓ %s\n", c.name)
+		default:
+			fmt.Printf("✗ %s: %s\n", c.name, c.detail)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d lint checks failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func lintFixture(t *testing.T) *nostr.Event {
+	t.Helper()
+	priv := nostr.GeneratePrivateKey()
+	recipient, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	e := &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"p", recipient},
+			{"e", strings.Repeat("ab", 32)},
+			{"expiration", "9999999999"},
+		},
+		Content: "hello",
+	}
+	if err := e.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func failedChecks(checks []lintCheck) []string {
+	var failed []string
+	for _, c := range checks {
+		if !c.ok && !c.warning {
+			failed = append(failed, c.name)
+		}
+	}
+	return failed
+}
+
+func TestLintEvent(t *testing.T) {
+	good := lintFixture(t)
+	if failed := failedChecks(lintEvent(good, false, time.Now())); len(failed) != 0 {
+		t.Errorf("expected all checks to pass, failed: %v", failed)
+	}
+
+	bad := lintFixture(t)
+	bad.Sig = strings.Repeat("0", 128)
+	failed := failedChecks(lintEvent(bad, false, time.Now()))
+	if len(failed) != 1 || failed[0] != "signature is valid" {
+		t.Errorf("expected only the signature check to fail, failed: %v", failed)
+	}
+
+	old := lintEvent(good, false, time.Now().Add(3*time.Hour))
+	if failed := failedChecks(old); len(failed) != 1 || failed[0] != "created_at within 2 hours of now" {
+		t.Errorf("expected only created_at to fail three hours from now, failed: %v", failed)
+	}
+}
+
+func TestLintEventStrict(t *testing.T) {
+	dm := lintFixture(t)
+	dm.Kind = nostr.KindEncryptedDirectMessage
+	if err := dm.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	warned := func(strict bool) bool {
+		for _, c := range lintEvent(dm, strict, time.Now()) {
+			if c.warning {
+				return true
+			}
+		}
+		return false
+	}
+	if warned(false) {
+		t.Error("expected no warning without --strict")
+	}
+	if !warned(true) {
+		t.Error("expected a warning for plaintext DM content with --strict")
+	}
+}
+
+func TestLintEventCommand(t *testing.T) {
+	path, _ := writeEventFile(t, func(e *nostr.Event) { e.Sig = strings.Repeat("0", 128) })
+	opts, err := parseArgs([]string{"lint-event", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var runErr error
+	out := captureStdout(t, func() { runErr = lintEventCommand(opts) })
+	if runErr == nil {
+		t.Fatal("expected an error for a bad signature")
+	}
+	if !strings.Contains(out, "✗ signature is valid") || !strings.Contains(out, "✓ id matches the event hash") {
+		t.Errorf("unexpected checklist:\n%s", out)
+	}
+}
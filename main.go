@@ -1,53 +1,460 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"text/tabwriter"
+	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip05"
 	"github.com/nbd-wtf/go-nostr/nip19"
 	"github.com/nbd-wtf/go-nostr/nip44"
+	"golang.org/x/term"
+	"golang.org/x/time/rate"
 )
 
 var version = "0.3.0"
 
 type options struct {
-	key        string
-	recipient  string
-	message    string
-	relays     string
-	wait       time.Duration
-	verbose    bool
-	jsonOutput bool
-	count      int
-	read       bool
+	command       string
+	args          []string
+	key           string
+	decryptKey    string
+	recipient     string
+	fromFile      string
+	message       string
+	subject       string
+	label         string
+	contentType   string
+	language      string
+	extraTags     nostr.Tags
+	shares        string
+	threshold     int
+	contentHash   bool
+	topic         string
+	relays        string
+	wait          time.Duration
+	verbose       bool
+	jsonOutput    bool
+	jsonSchema    bool
+	bech32IDs     bool
+	idFormat      string
+	jsonIndent    int
+	format        string
+	formatTmpl    string
+	templateFile  string
+	tmpl          *template.Template
+	groupByDay    bool
+	onDecryptErr  string
+	maxContent    int
+	noFullContent bool
+	count         int
+	since         time.Time
+	maxAge        time.Duration
+	sinceLastRead bool
+	sinceEvent    string
+	read          bool
+	maxRelays     int
+	writeProof    int
+	autoSelect    int
+	dryRun        bool
+	signOnly      bool
+	noSign        bool
+	nip           int
+	force         bool
+	ephemeralKey  bool
+	hardwareSign  bool
+	publicKeyOnly bool
+	vanityPrefix  string
+	vanityTimeout time.Duration
+	// directDerive derives pubkeys without signing (--no-derive-pubkey).
+	directDerive  bool
+	timeFormat    string
+	redactions    []redaction
+	charset       string
+	pipeTo        string
+	onSendSuccess string
+	compress      bool
+	onReceive     string
+	queueHooks    bool
+	waitForEOSE   bool
+	timeoutStrat  string
+	trustedOnly   bool
+	limitFollows  bool
+	unfollowed    []string
+	requirePTag   bool
+	anonymizeFrom bool
+	pubkeyDisplay string
+	exclude       []string
+	allowInsecure bool
+	charsetDetect bool
+	contentEnc    string
+	decodeOutput  string
+	hexDump       bool
+	conversation  string
+	latencySort   bool
+	privateRelay  string
+	allowPrivate  bool
+	reactions     bool
+	truncateID    int
+	colorScheme   string
+	omitFields    []string
+	strict        bool
+	nip05From     bool
+	verifyNIP05   bool
+	parseMentions bool
+	configFile    string
+	saveRelays    bool
+	showQR        bool
+	randomDelay   time.Duration
+	hopVia        string
+	output        string
+	importFile    string
+	fromStdin     bool
+	inputFile     string
+	eventCacheTTL time.Duration
+
+	checkTimeout time.Duration
+	readTimeout  time.Duration
+	eventTTL     time.Duration
+	maxRelayErrs int
+	dupWindow    time.Duration
+	suppressDups bool
+	heartbeat    time.Duration
+	// heartbeatMax ends watch after this many quiet heartbeats; 0 never does.
+	heartbeatMax int
+	forwardTo    string
+	toRelays     string
+	aggregateTo  string
+	kinds        []int
+	eventKind    int
+	kind4Only    bool
+	kind1059Only bool
+	batchSize    int
+	poolSize     int
+	// maxPendingHooks caps concurrent --on-receive commands; 0 means no cap.
+	maxPendingHooks int
+	minCompressSize int
+	metricsFile     string
+	// relayInfoFile gets the NIP-11 document of each relay in connected.
+	relayInfoFile string
+	connected     *relaySet
+	responseLimit int64
+	health        *relayHealth
+	// relayStatsFile gets one JSON line per relay operation.
+	relayStatsFile string
+	// connectLimiter paces relay connections for --relay-connect-rate; nil
+	// means no limit.
+	connectLimiter *rate.Limiter
+	connectRate    float64
+	connectBurst   int
+	// eventRelays maps event IDs to the relay that first delivered them,
+	// for --bech32-event-ids relay hints.
+	eventRelays map[string]string
+	// relayChallenge is sent as a bearer token when connecting to relays.
+	relayChallenge string
+	// relayProxies maps relay URLs to the SOCKS5 proxy that dials them.
+	relayProxies map[string]relayProxy
+	// With --relay-reconnect, watch subscribes again to a relay that dropped
+	// after reconnectDelay, at most maxReconnects times (0 for no limit).
+	reconnect      bool
+	reconnectDelay time.Duration
+	maxReconnects  int
+
+	// stats is filled in while a command runs, for --metrics-file.
+	stats runStats
+	// nip05Names caches sender NIP-05 identifiers for --nip05-from.
+	nip05Names map[string]string
+	// trace records the steps of a send for the trace command.
+	trace *sendTrace
+	// unwrapped holds the IDs of NIP-17 rumors taken out of a gift wrap
+	// whose seal signature verified.
+	unwrapped map[string]bool
 }
 
+// errSignedOnly is returned by sendMessage when --sign-only produced a signed
+// event without publishing it.
+var errSignedOnly = errors.New("event signed but not published")
+
 func printHelp() {
 	fmt.Fprintf(os.Stderr, `ndm (%s) - Send and Read Nostr Direct Messages (NIP-17)
 
 USAGE:
   ndm send -k <key> -r <recipient> -m <message>
   ndm read -k <key> [-n <count>]
+  ndm watch -k <key>
+  ndm aggregate --aggregate <url> [--kinds <k1,k2>]
+  ndm export -k <key> [-o <file>] [--batch-size <n>]
+  ndm trust add|remove <npub>
+  ndm trust list
+  ndm relay publish-raw <json-file>
+  ndm rebroadcast <event-id> --to-relays <urls>
+  ndm event-seen-by <event-id> --relay <url>
+  ndm relay-scores list
+  ndm lint-event [--strict] <json-file>
+  ndm pretty-json [--file <path>]
+  ndm encode-recipient <npub|hex|nsec|nprofile>
+  ndm inbox-zero -k <key> [--dry-run]
+  ndm reply-all -k <key> -m <message> --max-age <duration> [--exclude <npub>]
+  ndm trace send -k <key> -r <recipient> -m <message>
+  ndm keygen [--public-key-only] [--vanity-key <prefix>]
+  ndm key-share split -k <key> --shares <n> --threshold <k>
+  ndm key-share combine [--shares <s1,s2,...> | <file>]
+  ndm keyscan [-m <text>]
+  ndm version check
 
 COMMANDS:
-  send    Send a direct message (default)
-  read    Read received messages
-  inbox   Same as read
+  send           Send a direct message (default)
+  read           Read received messages
+  inbox          Same as read
+  watch          Print incoming messages as they arrive (Ctrl-C to stop)
+  export         Write received DM events as JSONL, undecrypted
+  aggregate      Mirror events from all relays into one relay (Ctrl-C to stop)
+  inbox-zero     Mark every received message as read for --since-last-read
+  reply-all      Send the same message to everyone who messaged you recently
+  trace send     Send a message and show how long each step took
+  trust          Manage the allowlist used by --trusted-only
+  relay publish-raw  Publish a pre-signed event from a file as is
+  rebroadcast    Copy an existing event from your relays to other relays
+  event-seen-by  Check whether a relay has an event
+  relay-scores   Show how reliable each relay has been for send
+  lint-event     Check a raw event for NIP compliance and common mistakes
+  pretty-json    Indent JSON or relay EVENT frames from stdin for reading
+  encode-recipient  Print a pubkey as npub, hex and nprofile
+  keygen         Generate a new keypair
+  key-share      Split a key into Shamir shares, or combine shares back into it
+  keyscan        Check text (or stdin) for accidentally pasted private keys
+  version        Print the version number
+  version check  Check GitHub for a newer release
 
 OPTIONS:
   -k, --key <nsec>         Your private key (nsec or hex) [required for send]
+  --decrypt-with-key <nsec>
+                          When reading, decrypt with this key instead; --key only
+                          selects whose messages are fetched
   -r, --recipient <pubkey> Recipient's public key (npub, hex, or nsec) [required for send]
+  --from-file <path>      Send to every recipient listed in this file (one npub, hex
+                          pubkey or NIP-05 identifier per line; # starts a comment)
   -m, --message <text>    The message to send [required for send]
+  --subject <text>        Add a NIP-14 subject tag to the message
+  --content-type <mime>   Tag the message with a MIME type, e.g. text/markdown
+  --tag <key>=<value>     Add a custom tag to the event (repeatable)
+  --content-language <lang>
+                          Tag the message with its language, e.g. en or pt-BR
+  --content-hash          Tag the message with the SHA-256 of its text, checked on read
+  --label <label>         Add a NIP-32 label (ndm/label namespace) to the message
+  --topic <label>         Only show messages with this label; * shows every label
+  --conversation-id <id> Only show replies in the NIP-10 thread rooted at this event
   -n, --count <num>       Number of messages to read (default: 10)
-  -relay, --relays <urls> Comma-separated relay URLs (default: uses well-known relays)
+  --since <time>          Only read messages after a unix timestamp or RFC 3339 time
+  --max-age <duration>    Only read messages newer than this, e.g. 24h, 7d or 2w
+  --since-last-read       Only read messages newer than the last ones read this way
+  --since-event <id>      Only read messages newer than this event; --json ends with
+                          a cursor holding the newest ID to pass next time
+  --on-decrypt-error <mode>
+                          skip, show-raw or abort (default: show-raw, skip with --json)
+  --max-content-length <n>
+                          Truncate displayed messages to n characters
+  --no-full-content       With --json, omit full_content for truncated messages
+  --timestamp-format <layout>
+                          Go time layout, or rfc3339, unix or relative
+  --redact <regex>=<text> Replace matches in displayed messages (repeatable)
+  --redact-cards          Mask credit card numbers as [CARD]
+  --redact-keys           Mask private keys and common API keys as [KEY]
+  --charset <name>        Decode messages from utf-8 (default), latin1, windows-1252
+                          or iso-8859-2
+  --charset-detect        Guess each message's charset and convert it to UTF-8
+  --content-encoding base64
+                          Decode received messages as base64 binary data; content that
+                          is not valid base64 is shown as text
+  --decode-output <path>  With --content-encoding, save decoded data to a file ({id} in
+                          the path becomes the event ID)
+  --hex-dump              With --content-encoding, show decoded data as a hex dump
+  --pipe-to <command>     Show each message as transformed by a shell command
+                          (the message is written to its stdin)
+  --group-by-day          Sort messages by time and separate them by day
+  --color-scheme <name>   Colors for terminal output: dark, light or auto (from
+                          COLORFGBG) (default: dark)
+  --truncate-id <n>       Characters of event IDs to show, 0 for all (default: 16)
+  --anonymize-from        Show only the first 8 characters of sender pubkeys
+  --pubkey-display <mode> Show From and To pubkeys as short (16 hex characters), full
+                          (64 hex characters) or npub
+  --nip05-from            Show senders by their NIP-05 identifier when they have one
+  --parse-mentions        Show nostr:npub and nostr:nevent mentions in messages as
+                          @<nip05> and <event id...>
+  --omit-fields <f1,f2>   Leave these keys out of JSON messages, e.g. raw_event,signature_valid
+  --exclude <npub>        Skip this sender in reply-all (repeatable)
+  --strict                With lint-event, also warn about unencrypted DM content
+  --require-p-tag-match   Drop received events that do not tag your pubkey
+  --trusted-only          Only show messages from trusted pubkeys and the pubkeys
+                          they follow
+  --limit-to-follows      Only show messages from pubkeys in your NIP-02 follow list
+  --include-unfollowed-from <npub>
+                          With --limit-to-follows, also show messages from this
+                          pubkey (repeatable)
+  --wait-for-eose         Wait for every relay to finish sending stored events
+  --relay-timeout-strategy <first|all|majority>
+                          When reading, stop after the first relays give --count
+                          events (first, the default), query all relays at once and
+                          wait for each (all, like --wait-for-eose), or for more
+                          than half of them (majority)
+  --relay-event-cache-ttl <dur>
+                          Reuse the results of an identical read made in the same
+                          process within this long instead of querying relays again
+  --import-event <file>   Read events from a JSON array or JSONL file instead of relays
+  --from-stdin-json       Read a JSON array (or JSONL) of events from stdin instead
+                          of relays
+  --file <path>           With pretty-json, read from this file instead of stdin
+  -relay, --relays <urls> Comma-separated relay URLs (default: uses well-known relays);
+                          --relay is the same flag
+  --allow-insecure-relays Allow ws:// relays without TLS, e.g. for local testing
+  --hop-via <url>         Publish through this relay first, then to the recipient's
+                          NIP-65 inbox relays, skipping any that are unreachable
+  --random-delay <ms>     Wait a random 0..ms before publishing, for timing privacy
+  --config <file>         Config file (default: ~/.config/ndm/config.json)
+  --show-event-id-qr      After sending, print a QR code of the nostr:nevent URI
+  --save-relays           After sending, save the relays that accepted the event to the config
+  --compress              Compress long messages with zstd before encrypting (the
+                          recipient needs an ndm that understands it)
+  --min-compress-size <bytes>
+                          Only compress messages at least this long (default: 512)
+  --on-send-success <command>
+                          After sending, run a shell command with NDM_EVENT_ID,
+                          NDM_RECIPIENT and NDM_RELAYS_COUNT set
+  --event-ttl <duration>  With watch, mark messages deleted (NIP-09) within this long
+                          after they were shown, e.g. 1h
+  --heartbeat <duration>  With watch, print a status line after each quiet interval
+  --heartbeat-exit-after <n>
+                          With --heartbeat, exit with an error after n quiet intervals
+  --relay-reconnect       With watch, subscribe again when a relay drops the connection
+  --relay-reconnect-delay <duration>
+                          How long to wait before reconnecting (default: 5s)
+  --relay-max-reconnects <n>
+                          Give up on a relay after n reconnects (default: no limit)
+  --allow-duplicates      With watch, show an event again each time another relay
+                          delivers it (by default it is shown once)
+  --duplicate-window <duration>
+                          How long watch and aggregate remember an event to skip
+                          its copies (default: 1h)
+  --on-receive <command>  With watch, run a shell command per message with NDM_FROM,
+                          NDM_CONTENT, NDM_EVENT_ID and NDM_TIMESTAMP set
+  --max-pending-hooks <n> Run at most n --on-receive commands at once; further
+                          messages skip the hook (default: 10)
+  --queue-hooks           With --max-pending-hooks, wait for a free slot instead of
+                          skipping the hook
+  --auto-select-relays <n>
+                          Use the n best relays by past send results
+  --max-relays <n>        Use at most n relays from the relay list (default: no cap)
+  --relay-write-proof <n> Only report success when at least n relays accepted the
+                          event (default: 1)
+  --relay-latency-sort    Ping the relays first and use the fastest ones first
+  --private-relay <url>   Always use this relay first; a send fails if it does not
+                          accept the event
+  --allow-private-relay-failure
+                          Fall back to the public relays when --private-relay fails
   -t, --timeout <sec>    How long to wait for publish confirmation (default: 30)
+  --read-timeout <ms>     How long to wait for each relay's events when reading
+                          (default: 10000)
+  --dry-run               Print the signed event JSON without publishing (reply-all,
+                          --from-file: list the recipients)
+  --sign-only             Like --dry-run, but exit with status 2 (offline signing)
+  --nip <17|4>            Send as a NIP-17 gift-wrapped DM (kind 1059, default) or as a
+                          kind-4 DM for legacy clients
+  --no-sign               With --dry-run or --sign-only, print the event unsigned,
+                          with empty id and sig, for signing elsewhere (needs --nip 4)
+  -o, --output <file>     Also write the signed event JSON to a file; with export,
+                          write events there instead of stdout
+  --ephemeral-key         Sign with a one-time key so the message is not linked to
+                          you (the recipient cannot reply)
+  --sign-with-hardware    Encrypt and sign on a FIDO2 security key instead of -k:
+                          ndm shows the device and key handle, then asks you to
+                          touch it to encrypt and again to sign; fails if no
+                          device is connected
+  --verify-nip05          When -r is a NIP-05 identifier, check that the nip05 in the
+                          recipient's profile resolves to the same pubkey before sending
+  --force                 Send even if the message looks like it contains a key or
+                          fails --verify-nip05; with relay publish-raw, publish an
+                          event that fails verification
+  --to-relays <urls>      With rebroadcast, comma-separated relays to publish to
+  --subscribe-and-forward <url>
+                          Republish every watched event to another relay
+  --aggregate <url>       With aggregate, the relay that receives every unique event
+  --kinds <k1,k2>         With aggregate, event kinds to mirror (default: 4)
+  --include-reaction      With read, also show reactions (kind 7) to your notes
+  --event-kind <n>        With read, the event kind to fetch; kinds other than 4 and
+                          1059 are shown as plain text (default: 4, plus 1059 gift
+                          wraps)
+  --read-kind4-only       With read, fetch only legacy kind 4 DMs, not gift wraps
+  --read-kind1059-only    With read, fetch only NIP-59 gift-wrapped DMs (kind 1059)
+  --batch-size <n>        With export and aggregate, events handled per chunk (default: 500)
+  --relay-pool-size <n>   With watch, relays subscribed to at once; the rest wait for
+                          a free slot (default: 10)
+  --relay-response-limit <bytes>
+                          Close a relay connection once it sends more than this
+                          for one query, or for one event in watch; 0 for no limit
+                          (default: 10485760)
+  --max-relay-errors <n>  Skip a relay for the rest of the run after n errors in a
+                          row; 0 never skips (default: 3)
+  --relay-connect-rate <n>
+                          Open at most n relay connections per second
+  --relay-connect-burst <n>
+                          Connections allowed at once before --relay-connect-rate
+                          applies (default: 1)
+  --check-timeout <sec>   How long version check waits for GitHub (default: 5)
+  --shares <n|list>       With key-share split, how many shares to make; with combine,
+                          comma-separated shares (default: read a file or stdin)
+  --threshold <k>         With key-share split, how many shares recover the key
+  --public-key-only       With keygen, print only a pubkey and discard the private key
+  --vanity-key <prefix>   With keygen, search for a key whose npub starts with
+                          npub1<prefix> (each extra character is ~32x slower)
+  --vanity-timeout <dur>  Give up the --vanity-key search after this long, e.g. 10m
+  --metrics-file <file>   Append per-run metrics as a JSON line to a file
+  --relay-challenge <token>
+                          Send "Authorization: Bearer <token>" when connecting to relays
+  --relay-proxy <url>=<proxy>
+                          Reach this relay through a SOCKS5 proxy (host:port), e.g. to
+                          send only .onion relays through Tor (repeatable)
+  --relay-info-file <file>
+                          Append the NIP-11 info of each relay used as JSON lines
+  --relay-stats-file <file>
+                          Append the latency and outcome of each relay operation as
+                          JSON lines
   -v, --verbose           Print verbose output
-  -j, --json              Output result as JSON
+  -j, --json              Output result as JSON (same as --output-format json)
+  --json-schema           Print the JSON Schema of the command's --json output
+  --bech32-event-ids      Show event IDs as nevent with the delivering relay as hint
+  --event-id-format <fmt> Event IDs in JSON output: hex (default), bech32 (nevent with
+                          relay hint) or short (first 12 characters)
+  --format-json-pretty    JSON output indented by two spaces (same as --json)
+  --format-json-compact   JSON output on a single line
+  --format-json-indent <n>
+                          JSON output indented by n spaces
+  --output-format <fmt>   Output format for read: text, json or table (default: text)
+  --format <template>     With read and watch, print each message with a Go template,
+                          e.g. '{{.From}}: {{.Content}}'
+  --output-template-file <path>
+                          Like --format, with the template read from a file (watch
+                          reloads it on SIGHUP)
   -h, --help              Show help
   --version               Show version number
 
@@ -57,16 +464,39 @@ EXAMPLES:
   ndm read -k <nsec> -n 5
 
 NOTES:
+  - Without --relays, the relays listed in the config file are used, then the
+    built-in defaults
+  - Relays given as wss+tor://host or with a .onion host are reached through
+    the Tor SOCKS5 proxy at 127.0.0.1:9050 (requires a running Tor daemon)
   - Recipient can be an npub, nsec (will derive pubkey), or hex pubkey
   - If you use your own nsec as recipient, it sends to yourself
+  - send refuses messages that look like they contain an nsec, hex key or
+    seed phrase unless --force is given
 
 `, version)
 }
 
 func parseArgs(args []string) (*options, error) {
 	opts := &options{
-		wait:  30 * time.Second,
-		count: 10,
+		wait:            30 * time.Second,
+		count:           10,
+		checkTimeout:    5 * time.Second,
+		readTimeout:     10 * time.Second,
+		jsonIndent:      2,
+		batchSize:       defaultBatchSize,
+		poolSize:        defaultPoolSize,
+		maxPendingHooks: defaultMaxPendingHooks,
+		minCompressSize: defaultMinCompressSize,
+		eventKind:       nostr.KindEncryptedDirectMessage,
+		truncateID:      16,
+		colorScheme:     "dark",
+		dupWindow:       time.Hour,
+		suppressDups:    true,
+		writeProof:      1,
+		nip:             17,
+		reconnectDelay:  5 * time.Second,
+		maxRelayErrs:    defaultMaxRelayErrors,
+		responseLimit:   defaultResponseLimit,
 	}
 
 	// Check for command
@@ -76,6 +506,7 @@ func parseArgs(args []string) (*options, error) {
 		args = args[1:]
 	}
 
+	opts.command = command
 	if command == "read" || command == "inbox" {
 		opts.read = true
 	}
@@ -96,18 +527,121 @@ func parseArgs(args []string) (*options, error) {
 			}
 			opts.key = args[i+1]
 			i++
+		case "--decrypt-with-key":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --decrypt-with-key")
+			}
+			opts.decryptKey = args[i+1]
+			i++
 		case "-r", "--recipient":
 			if i+1 >= len(args) {
 				return nil, fmt.Errorf("missing value for -r")
 			}
 			opts.recipient = args[i+1]
 			i++
+		case "--from-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --from-file")
+			}
+			opts.fromFile = args[i+1]
+			i++
 		case "-m", "--message":
 			if i+1 >= len(args) {
 				return nil, fmt.Errorf("missing value for -m")
 			}
 			opts.message = args[i+1]
 			i++
+		case "--content-hash":
+			opts.contentHash = true
+		case "--content-type":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --content-type")
+			}
+			opts.contentType = args[i+1]
+			i++
+		case "--shares":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --shares")
+			}
+			opts.shares = args[i+1]
+			i++
+		case "--threshold":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --threshold")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.threshold); err != nil {
+				return nil, fmt.Errorf("invalid --threshold: %s", args[i+1])
+			}
+			i++
+		case "--tag":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --tag")
+			}
+			tag, err := parseCustomTag(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			opts.extraTags = append(opts.extraTags, tag)
+			i++
+		case "--content-language":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --content-language")
+			}
+			if !languagePattern.MatchString(args[i+1]) {
+				return nil, fmt.Errorf("invalid --content-language %q: want a language tag like en or pt-BR", args[i+1])
+			}
+			opts.language = args[i+1]
+			i++
+		case "--label":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --label")
+			}
+			opts.label = args[i+1]
+			i++
+		case "--topic":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --topic")
+			}
+			opts.topic = args[i+1]
+			i++
+		case "--since":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --since")
+			}
+			since, err := parseSince(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			opts.since = since
+			i++
+		case "--since-last-read":
+			opts.sinceLastRead = true
+		case "--since-event":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --since-event")
+			}
+			id, err := decodeEventID(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --since-event: %w", err)
+			}
+			opts.sinceEvent = id
+			i++
+		case "--max-age":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --max-age")
+			}
+			age, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			opts.maxAge = age
+			i++
+		case "--subject":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --subject")
+			}
+			opts.subject = args[i+1]
+			i++
 		case "-n", "--count":
 			if i+1 >= len(args) {
 				return nil, fmt.Errorf("missing value for -n")
@@ -116,12 +650,307 @@ func parseArgs(args []string) (*options, error) {
 				return nil, fmt.Errorf("invalid count: %w", err)
 			}
 			i++
-		case "-relay", "--relays":
+		case "--on-decrypt-error":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --on-decrypt-error")
+			}
+			switch args[i+1] {
+			case "skip", "show-raw", "abort":
+				opts.onDecryptErr = args[i+1]
+			default:
+				return nil, fmt.Errorf("invalid --on-decrypt-error mode: %s (want skip, show-raw or abort)", args[i+1])
+			}
+			i++
+		case "--max-content-length":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --max-content-length")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.maxContent); err != nil {
+				return nil, fmt.Errorf("invalid max content length: %w", err)
+			}
+			i++
+		case "--no-full-content":
+			opts.noFullContent = true
+		case "--timestamp-format":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --timestamp-format")
+			}
+			opts.timeFormat = args[i+1]
+			i++
+		case "--group-by-day":
+			opts.groupByDay = true
+		case "--import-event":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --import-event")
+			}
+			opts.importFile = args[i+1]
+			i++
+		case "--from-stdin-json":
+			opts.fromStdin = true
+		case "--color-scheme":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --color-scheme")
+			}
+			if !slices.Contains(colorSchemes, args[i+1]) {
+				return nil, fmt.Errorf("invalid color scheme: %s (want light, dark or auto)", args[i+1])
+			}
+			opts.colorScheme = args[i+1]
+			i++
+		case "--truncate-id":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --truncate-id")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.truncateID); err != nil || opts.truncateID < 0 {
+				return nil, fmt.Errorf("invalid --truncate-id: %s", args[i+1])
+			}
+			i++
+		case "--compress":
+			opts.compress = true
+		case "--min-compress-size":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --min-compress-size")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.minCompressSize); err != nil || opts.minCompressSize < 0 {
+				return nil, fmt.Errorf("invalid --min-compress-size: %s", args[i+1])
+			}
+			i++
+		case "--on-send-success":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --on-send-success")
+			}
+			opts.onSendSuccess = args[i+1]
+			i++
+		case "--on-receive":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --on-receive")
+			}
+			opts.onReceive = args[i+1]
+			i++
+		case "--max-pending-hooks":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --max-pending-hooks")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.maxPendingHooks); err != nil {
+				return nil, fmt.Errorf("invalid max pending hooks: %w", err)
+			}
+			if opts.maxPendingHooks < 1 {
+				return nil, fmt.Errorf("invalid max pending hooks: must be at least 1")
+			}
+			i++
+		case "--queue-hooks":
+			opts.queueHooks = true
+		case "--include-reaction":
+			opts.reactions = true
+		case "--private-relay":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --private-relay")
+			}
+			opts.privateRelay = normalizeRelayURL(strings.TrimSpace(args[i+1]))
+			i++
+		case "--allow-private-relay-failure":
+			opts.allowPrivate = true
+		case "--relay-latency-sort":
+			opts.latencySort = true
+		case "--allow-insecure-relays":
+			opts.allowInsecure = true
+		case "-relay", "--relay", "--relays":
 			if i+1 >= len(args) {
 				return nil, fmt.Errorf("missing value for --relays")
 			}
 			opts.relays = args[i+1]
 			i++
+		case "--hop-via":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --hop-via")
+			}
+			opts.hopVia = args[i+1]
+			i++
+		case "--random-delay":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --random-delay")
+			}
+			var ms int
+			if _, err := fmt.Sscanf(args[i+1], "%d", &ms); err != nil {
+				return nil, fmt.Errorf("invalid random delay: %w", err)
+			}
+			opts.randomDelay = time.Duration(ms) * time.Millisecond
+			i++
+		case "--redact":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --redact")
+			}
+			r, err := parseRedaction(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			opts.redactions = append(opts.redactions, r)
+			i++
+		case "--redact-cards":
+			opts.redactions = append(opts.redactions, cardRedactions...)
+		case "--redact-keys":
+			opts.redactions = append(opts.redactions, keyRedactions...)
+		case "--pipe-to":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --pipe-to")
+			}
+			opts.pipeTo = args[i+1]
+			i++
+		case "--conversation-id":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --conversation-id")
+			}
+			if !nostr.IsValid32ByteHex(args[i+1]) {
+				return nil, fmt.Errorf("invalid --conversation-id: %s (want a hex event ID)", args[i+1])
+			}
+			opts.conversation = args[i+1]
+			i++
+		case "--bech32-event-ids":
+			opts.bech32IDs = true
+			opts.eventRelays = make(map[string]string)
+		case "--event-id-format":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --event-id-format")
+			}
+			switch args[i+1] {
+			case "hex", "bech32", "short":
+				opts.idFormat = args[i+1]
+			default:
+				return nil, fmt.Errorf("invalid --event-id-format: %s (want hex, bech32 or short)", args[i+1])
+			}
+			if opts.idFormat == "bech32" && opts.eventRelays == nil {
+				opts.eventRelays = make(map[string]string)
+			}
+			i++
+		case "--json-schema":
+			opts.jsonSchema = true
+		case "--charset-detect":
+			opts.charsetDetect = true
+		case "--content-encoding":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --content-encoding")
+			}
+			if args[i+1] != "base64" {
+				return nil, fmt.Errorf("invalid --content-encoding %q: only base64 is supported", args[i+1])
+			}
+			opts.contentEnc = args[i+1]
+			i++
+		case "--decode-output":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --decode-output")
+			}
+			opts.decodeOutput = args[i+1]
+			i++
+		case "--hex-dump":
+			opts.hexDump = true
+		case "--charset":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --charset")
+			}
+			if _, ok := charsets[strings.ToLower(args[i+1])]; !ok {
+				return nil, fmt.Errorf("unsupported charset: %s (want utf-8, latin1, windows-1252 or iso-8859-2)", args[i+1])
+			}
+			opts.charset = args[i+1]
+			i++
+		case "--sign-with-hardware":
+			opts.hardwareSign = true
+		case "--ephemeral-key":
+			opts.ephemeralKey = true
+		case "--trusted-only":
+			opts.trustedOnly = true
+		case "--limit-to-follows":
+			opts.limitFollows = true
+		case "--include-unfollowed-from":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --include-unfollowed-from")
+			}
+			opts.unfollowed = append(opts.unfollowed, args[i+1])
+			i++
+		case "--require-p-tag-match":
+			opts.requirePTag = true
+		case "--pubkey-display":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --pubkey-display")
+			}
+			switch args[i+1] {
+			case "short", "full", "npub":
+				opts.pubkeyDisplay = args[i+1]
+			default:
+				return nil, fmt.Errorf("invalid --pubkey-display: %s (want short, full or npub)", args[i+1])
+			}
+			i++
+		case "--anonymize-from":
+			opts.anonymizeFrom = true
+		case "--nip05-from":
+			opts.nip05From = true
+		case "--verify-nip05":
+			opts.verifyNIP05 = true
+		case "--parse-mentions":
+			opts.parseMentions = true
+		case "--strict":
+			opts.strict = true
+		case "--omit-fields":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --omit-fields")
+			}
+			for _, f := range strings.Split(args[i+1], ",") {
+				f = strings.TrimSpace(f)
+				if !jsonFields[f] {
+					return nil, fmt.Errorf("unknown field for --omit-fields: %q", f)
+				}
+				opts.omitFields = append(opts.omitFields, f)
+			}
+			i++
+		case "--exclude":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --exclude")
+			}
+			opts.exclude = append(opts.exclude, args[i+1])
+			i++
+		case "--wait-for-eose":
+			opts.waitForEOSE = true
+		case "--relay-timeout-strategy":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-timeout-strategy")
+			}
+			if !slices.Contains(timeoutStrategies, args[i+1]) {
+				return nil, fmt.Errorf("invalid --relay-timeout-strategy %q: want first, all or majority", args[i+1])
+			}
+			opts.timeoutStrat = args[i+1]
+			i++
+		case "--config":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --config")
+			}
+			opts.configFile = args[i+1]
+			i++
+		case "--show-event-id-qr":
+			opts.showQR = true
+		case "--save-relays":
+			opts.saveRelays = true
+		case "--auto-select-relays":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --auto-select-relays")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.autoSelect); err != nil {
+				return nil, fmt.Errorf("invalid relay count: %w", err)
+			}
+			i++
+		case "--max-relays":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --max-relays")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.maxRelays); err != nil {
+				return nil, fmt.Errorf("invalid max relays: %w", err)
+			}
+			i++
+		case "--relay-write-proof":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-write-proof")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.writeProof); err != nil || opts.writeProof < 1 {
+				return nil, fmt.Errorf("invalid --relay-write-proof %q: want a number of relays, at least 1", args[i+1])
+			}
+			i++
 		case "-t", "--timeout":
 			if i+1 >= len(args) {
 				return nil, fmt.Errorf("missing value for -t")
@@ -132,346 +961,2096 @@ func parseArgs(args []string) (*options, error) {
 			}
 			opts.wait = time.Duration(t) * time.Second
 			i++
-		case "-v", "--verbose":
-			opts.verbose = true
-		case "-j", "--json":
-			opts.jsonOutput = true
-		}
-	}
-
-	if opts.read {
-		if opts.key == "" {
-			return nil, fmt.Errorf("missing required flag: -k/--key (your private key)")
-		}
-	} else {
-		if opts.key == "" {
-			return nil, fmt.Errorf("missing required flag: -k/--key (your private key)")
-		}
-		if opts.recipient == "" {
-			return nil, fmt.Errorf("missing required flag: -r/--recipient (recipient's public key)")
-		}
-		if opts.message == "" {
-			return nil, fmt.Errorf("missing required flag: -m/--message (the message to send)")
-		}
-	}
+		case "--heartbeat":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --heartbeat")
+			}
+			interval, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --heartbeat %q: want a duration like 30s or 5m", args[i+1])
+			}
+			opts.heartbeat = interval
+			i++
+		case "--heartbeat-exit-after":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --heartbeat-exit-after")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.heartbeatMax); err != nil || opts.heartbeatMax < 1 {
+				return nil, fmt.Errorf("invalid --heartbeat-exit-after: %s (want at least 1)", args[i+1])
+			}
+			i++
+		case "--relay-reconnect":
+			opts.reconnect = true
+		case "--relay-reconnect-delay":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-reconnect-delay")
+			}
+			delay, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --relay-reconnect-delay %q: want a duration like 500ms, 5s or 1m", args[i+1])
+			}
+			opts.reconnectDelay = delay
+			i++
+		case "--relay-max-reconnects":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-max-reconnects")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.maxReconnects); err != nil || opts.maxReconnects < 0 {
+				return nil, fmt.Errorf("invalid --relay-max-reconnects: %s", args[i+1])
+			}
+			i++
+		case "--suppress-duplicates":
+			opts.suppressDups = true
+		case "--allow-duplicates":
+			opts.suppressDups = false
+		case "--duplicate-window":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --duplicate-window")
+			}
+			window, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --duplicate-window %q: want a duration like 10m, 1h or 1d", args[i+1])
+			}
+			opts.dupWindow = window
+			i++
+		case "--event-ttl":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --event-ttl")
+			}
+			ttl, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --event-ttl %q: want a duration like 10m, 24h or 7d", args[i+1])
+			}
+			opts.eventTTL = ttl
+			i++
+		case "--relay-event-cache-ttl":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-event-cache-ttl")
+			}
+			ttl, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --relay-event-cache-ttl %q: want a duration like 30s, 5m or 1h", args[i+1])
+			}
+			opts.eventCacheTTL = ttl
+			i++
+		case "--read-timeout":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --read-timeout")
+			}
+			var ms int
+			if _, err := fmt.Sscanf(args[i+1], "%d", &ms); err != nil {
+				return nil, fmt.Errorf("invalid read timeout: %w", err)
+			}
+			opts.readTimeout = time.Duration(ms) * time.Millisecond
+			i++
+		case "--no-sign":
+			opts.noSign = true
+		case "--nip":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --nip")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.nip); err != nil || (opts.nip != 17 && opts.nip != 4) {
+				return nil, fmt.Errorf("invalid --nip %q: want 17 or 4", args[i+1])
+			}
+			i++
+		case "--dry-run":
+			opts.dryRun = true
+		case "--sign-only":
+			opts.signOnly = true
+		case "--to-relays":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --to-relays")
+			}
+			opts.toRelays = args[i+1]
+			i++
+		case "--force":
+			opts.force = true
+		case "-o", "--output":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --output")
+			}
+			opts.output = args[i+1]
+			i++
+		case "--aggregate":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --aggregate")
+			}
+			opts.aggregateTo = args[i+1]
+			i++
+		case "--kinds":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --kinds")
+			}
+			for _, k := range strings.Split(args[i+1], ",") {
+				var kind int
+				if _, err := fmt.Sscanf(strings.TrimSpace(k), "%d", &kind); err != nil {
+					return nil, fmt.Errorf("invalid kind %q: %w", k, err)
+				}
+				opts.kinds = append(opts.kinds, kind)
+			}
+			i++
+		case "--event-kind":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --event-kind")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.eventKind); err != nil || opts.eventKind < 0 {
+				return nil, fmt.Errorf("invalid event kind: %s", args[i+1])
+			}
+			i++
+		case "--read-kind4-only":
+			opts.kind4Only = true
+		case "--read-kind1059-only":
+			opts.kind1059Only = true
+		case "--relay-response-limit":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-response-limit")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.responseLimit); err != nil || opts.responseLimit < 0 {
+				return nil, fmt.Errorf("invalid --relay-response-limit: %s (want a number of bytes, 0 for no limit)", args[i+1])
+			}
+			i++
+		case "--max-relay-errors":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --max-relay-errors")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.maxRelayErrs); err != nil || opts.maxRelayErrs < 0 {
+				return nil, fmt.Errorf("invalid --max-relay-errors: %s (want 0 or more)", args[i+1])
+			}
+			i++
+		case "--relay-connect-rate":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-connect-rate")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%g", &opts.connectRate); err != nil || opts.connectRate <= 0 {
+				return nil, fmt.Errorf("invalid --relay-connect-rate: %s (want connections per second > 0)", args[i+1])
+			}
+			i++
+		case "--relay-connect-burst":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-connect-burst")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.connectBurst); err != nil || opts.connectBurst < 1 {
+				return nil, fmt.Errorf("invalid --relay-connect-burst: %s (want at least 1)", args[i+1])
+			}
+			i++
+		case "--batch-size":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --batch-size")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.batchSize); err != nil {
+				return nil, fmt.Errorf("invalid batch size: %w", err)
+			}
+			if opts.batchSize < 1 {
+				return nil, fmt.Errorf("invalid batch size: must be at least 1")
+			}
+			i++
+		case "--relay-pool-size":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-pool-size")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.poolSize); err != nil {
+				return nil, fmt.Errorf("invalid relay pool size: %w", err)
+			}
+			if opts.poolSize < 1 {
+				return nil, fmt.Errorf("invalid relay pool size: must be at least 1")
+			}
+			i++
+		case "--subscribe-and-forward":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --subscribe-and-forward")
+			}
+			opts.forwardTo = args[i+1]
+			i++
+		case "--check-timeout":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --check-timeout")
+			}
+			var t int
+			if _, err := fmt.Sscanf(args[i+1], "%d", &t); err != nil {
+				return nil, fmt.Errorf("invalid check timeout: %w", err)
+			}
+			opts.checkTimeout = time.Duration(t) * time.Second
+			i++
+		case "--public-key-only":
+			opts.publicKeyOnly = true
+		case "--vanity-key":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --vanity-key")
+			}
+			prefix := strings.ToLower(strings.TrimPrefix(args[i+1], "npub1"))
+			if prefix == "" || !validVanityPrefix(prefix) {
+				return nil, fmt.Errorf("invalid --vanity-key %q: npubs only contain the characters %s", args[i+1], bech32Charset)
+			}
+			opts.vanityPrefix = prefix
+			i++
+		case "--vanity-timeout":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --vanity-timeout")
+			}
+			timeout, err := parseAge(args[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --vanity-timeout %q: want a duration like 30s, 10m or 1h", args[i+1])
+			}
+			opts.vanityTimeout = timeout
+			i++
+		case "--no-derive-pubkey":
+			// Internal: derive pubkeys without signing, for benchmarking.
+			opts.directDerive = true
+		case "--metrics-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --metrics-file")
+			}
+			opts.metricsFile = args[i+1]
+			i++
+		case "--relay-challenge":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-challenge")
+			}
+			opts.relayChallenge = args[i+1]
+			i++
+		case "--relay-proxy":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-proxy")
+			}
+			relay, proxyAddr, err := parseRelayProxy(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if opts.relayProxies == nil {
+				opts.relayProxies = make(map[string]relayProxy)
+			}
+			opts.relayProxies[relay] = relayProxy{addr: proxyAddr}
+			i++
+		case "--relay-info-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-info-file")
+			}
+			opts.relayInfoFile = args[i+1]
+			opts.connected = &relaySet{}
+			i++
+		case "--relay-stats-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --relay-stats-file")
+			}
+			opts.relayStatsFile = args[i+1]
+			i++
+		case "--file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --file")
+			}
+			opts.inputFile = args[i+1]
+			i++
+		case "-v", "--verbose":
+			opts.verbose = true
+		case "-j", "--json", "--format-json-pretty":
+			opts.jsonOutput = true
+			opts.format = "json"
+			opts.jsonIndent = 2
+		case "--format-json-compact":
+			opts.jsonOutput = true
+			opts.format = "json"
+			opts.jsonIndent = 0
+		case "--format-json-indent":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --format-json-indent")
+			}
+			if _, err := fmt.Sscanf(args[i+1], "%d", &opts.jsonIndent); err != nil || opts.jsonIndent < 0 {
+				return nil, fmt.Errorf("invalid JSON indent: %s", args[i+1])
+			}
+			opts.jsonOutput = true
+			opts.format = "json"
+			i++
+		case "--format":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --format")
+			}
+			opts.formatTmpl = args[i+1]
+			i++
+		case "--output-template-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --output-template-file")
+			}
+			opts.templateFile = args[i+1]
+			i++
+		case "--output-format":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for --output-format")
+			}
+			switch args[i+1] {
+			case "text", "table":
+				opts.format = args[i+1]
+				opts.jsonOutput = false
+			case "json":
+				opts.format = args[i+1]
+				opts.jsonOutput = true
+			default:
+				return nil, fmt.Errorf("invalid output format: %s (want text, json or table)", args[i+1])
+			}
+			i++
+		default:
+			if !strings.HasPrefix(arg, "-") {
+				opts.args = append(opts.args, arg)
+			}
+		}
+	}
+
+	opts.health = newRelayHealth(opts.maxRelayErrs)
+	if opts.connectRate > 0 {
+		opts.connectLimiter = rate.NewLimiter(rate.Limit(opts.connectRate), max(opts.connectBurst, 1))
+	} else if opts.connectBurst > 0 {
+		return nil, fmt.Errorf("--relay-connect-burst needs --relay-connect-rate")
+	}
+
+	if opts.relays != "" {
+		configured := strings.Split(opts.relays, ",")
+		if opts.privateRelay != "" && !slices.Contains(configured, opts.privateRelay) {
+			configured = append(configured, opts.privateRelay)
+		}
+		if opts.maxRelays > 0 {
+			configured = configured[:min(len(configured), opts.maxRelays)]
+		}
+		if opts.writeProof > len(configured) {
+			return nil, fmt.Errorf("--relay-write-proof %d needs at least that many relays, but only %d are configured", opts.writeProof, len(configured))
+		}
+	}
+
+	// connectRelay refuses ws:// relays from any source; checking the flags
+	// here as well fails before anything is signed.
+	if !opts.allowInsecure {
+		for _, relay := range strings.Split(opts.relays+","+opts.privateRelay+","+opts.toRelays, ",") {
+			if isInsecureRelay(normalizeRelayURL(strings.TrimSpace(relay))) {
+				return nil, fmt.Errorf("relay %s is not encrypted: use wss:// or pass --allow-insecure-relays", strings.TrimSpace(relay))
+			}
+		}
+	}
+
+	if !opts.since.IsZero() && opts.maxAge > 0 {
+		return nil, fmt.Errorf("--since and --max-age cannot be combined")
+	}
+	if opts.sinceLastRead && (!opts.since.IsZero() || opts.maxAge > 0) {
+		return nil, fmt.Errorf("--since-last-read cannot be combined with --since or --max-age")
+	}
+	if (opts.decodeOutput != "" || opts.hexDump) && opts.contentEnc == "" {
+		return nil, fmt.Errorf("--decode-output and --hex-dump need --content-encoding base64")
+	}
+	// --wait-for-eose is the all strategy; first would contradict it.
+	if opts.waitForEOSE {
+		if opts.timeoutStrat == "first" {
+			return nil, fmt.Errorf("--wait-for-eose cannot be combined with --relay-timeout-strategy first")
+		}
+		if opts.timeoutStrat == "" {
+			opts.timeoutStrat = "all"
+		}
+	}
+	if opts.fromStdin && opts.importFile != "" {
+		return nil, fmt.Errorf("--from-stdin-json and --import-event cannot be combined")
+	}
+	if opts.formatTmpl != "" && opts.templateFile != "" {
+		return nil, fmt.Errorf("--format and --output-template-file cannot be combined")
+	}
+	if opts.formatTmpl != "" {
+		tmpl, err := parseMessageTemplate(opts.formatTmpl)
+		if err != nil {
+			return nil, fmt.Errorf("--format: %w", err)
+		}
+		opts.tmpl = tmpl
+	} else if opts.templateFile != "" {
+		tmpl, err := loadTemplateFile(opts.templateFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.tmpl = tmpl
+	}
+	if opts.kind4Only && opts.kind1059Only {
+		return nil, fmt.Errorf("--read-kind4-only and --read-kind1059-only cannot be combined")
+	}
+	if opts.kind4Only {
+		opts.eventKind = nostr.KindEncryptedDirectMessage
+	} else if opts.kind1059Only {
+		opts.eventKind = nostr.KindGiftWrap
+	}
+	if opts.noSign && !opts.dryRun && !opts.signOnly {
+		return nil, fmt.Errorf("--no-sign only works with --dry-run or --sign-only")
+	}
+	if opts.noSign && opts.nip == 17 {
+		// The seal must be signed before it is wrapped.
+		return nil, fmt.Errorf("--no-sign needs --nip 4: a NIP-17 gift wrap cannot be built from an unsigned event")
+	}
+	if opts.sinceEvent != "" && (!opts.since.IsZero() || opts.maxAge > 0 || opts.sinceLastRead) {
+		return nil, fmt.Errorf("--since-event cannot be combined with --since, --max-age or --since-last-read")
+	}
+
+	if opts.jsonSchema || command == "version" || command == "keyscan" || command == "keygen" || command == "trust" || command == "relay-scores" || command == "relay" || command == "rebroadcast" || command == "event-seen-by" || command == "key-share" || command == "lint-event" || command == "pretty-json" || command == "encode-recipient" {
+		return opts, nil
+	}
+
+	if command == "aggregate" {
+		if opts.aggregateTo == "" {
+			return nil, fmt.Errorf("missing required flag: --aggregate (target relay URL)")
+		}
+		return opts, nil
+	}
+
+	if opts.read || command == "watch" || command == "export" || command == "inbox-zero" {
+		if opts.key == "" {
+			return nil, fmt.Errorf("missing required flag: -k/--key (your private key)")
+		}
+	} else if command == "reply-all" {
+		if opts.key == "" {
+			return nil, fmt.Errorf("missing required flag: -k/--key (your private key)")
+		}
+		if opts.message == "" {
+			return nil, fmt.Errorf("missing required flag: -m/--message (the message to send)")
+		}
+		if opts.maxAge == 0 {
+			return nil, fmt.Errorf("missing required flag: --max-age (how far back to look for senders)")
+		}
+	} else {
+		if opts.key == "" && !opts.ephemeralKey && !opts.hardwareSign {
+			return nil, fmt.Errorf("missing required flag: -k/--key (your private key)")
+		}
+		if opts.recipient == "" && opts.fromFile == "" {
+			return nil, fmt.Errorf("missing required flag: -r/--recipient (recipient's public key)")
+		}
+		if opts.message == "" {
+			return nil, fmt.Errorf("missing required flag: -m/--message (the message to send)")
+		}
+	}
+
+	return opts, nil
+}
+
+func resolveKey(input string) (string, error) {
+	input = strings.TrimSpace(input)
+
+	if len(input) == 64 && isHex(input) {
+		_, err := derivePublicKeyFromPrivate(input, false)
+		if err == nil {
+			return derivePublicKeyFromPrivate(input, false)
+		}
+		return input, nil
+	}
+
+	if strings.HasPrefix(input, "nsec") {
+		prefix, value, _ := nip19.Decode(input)
+		if prefix == "nsec" {
+			secret, ok := value.(string)
+			if ok {
+				return derivePublicKeyFromPrivate(secret, false)
+			}
+		}
+	}
+
+	if strings.HasPrefix(input, "npub") {
+		prefix, value, _ := nip19.Decode(input)
+		if prefix == "npub" {
+			pubkey, ok := value.(string)
+			if ok {
+				return pubkey, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("could not resolve key: %s", input)
+}
+
+func resolvePrivateKey(input string) (string, error) {
+	input = strings.TrimSpace(input)
+
+	if len(input) == 64 && isHex(input) {
+		return input, nil
+	}
+
+	if strings.HasPrefix(input, "nsec") {
+		prefix, value, _ := nip19.Decode(input)
+		if prefix == "nsec" {
+			secret, ok := value.(string)
+			if !ok {
+				return "", fmt.Errorf("invalid secret value")
+			}
+			return secret, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid private key format")
+}
+
+// derivePublicKeyFromPrivate returns the pubkey for privkeyHex. With direct,
+// as set by the internal --no-derive-pubkey flag, it uses DerivePublicKey
+// instead of signing a throwaway event.
+func derivePublicKeyFromPrivate(privkeyHex string, direct bool) (string, error) {
+	if direct {
+		return DerivePublicKey(privkeyHex)
+	}
+	return derivePublicKeyBySigning(privkeyHex)
+}
+
+// DerivePublicKey returns the hex public key for a hex private key, computed
+// directly on the curve without producing a signature.
+func DerivePublicKey(hexPriv string) (string, error) {
+	if len(hexPriv) != 64 || !isHex(hexPriv) {
+		return "", fmt.Errorf("invalid private key: want 64 hex characters")
+	}
+	return nostr.GetPublicKey(hexPriv)
+}
+
+// derivePublicKeyBySigning signs a throwaway event to learn its pubkey.
+func derivePublicKeyBySigning(privkeyHex string) (string, error) {
+	evt := &nostr.Event{
+		Kind:      1,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Content:   "temp",
+	}
+	err := evt.Sign(privkeyHex)
+	if err != nil {
+		return "", err
+	}
+	return evt.PubKey, nil
+}
+
+// isEncryptedKind reports whether events of kind carry encrypted content.
+func isEncryptedKind(kind int) bool {
+	return kind == nostr.KindEncryptedDirectMessage || kind == nostr.KindGiftWrap
+}
+
+// messageContent returns the readable content of e: decrypted for DM kinds
+// and as-is for everything else.
+func messageContent(privkey string, e *nostr.Event) (string, error) {
+	if e.Kind == nostr.KindDirectMessage {
+		// A NIP-17 rumor, already unwrapped.
+		return decompressPlaintext(e.Content)
+	}
+	if !isEncryptedKind(e.Kind) {
+		return e.Content, nil
+	}
+	if e.Kind == nostr.KindGiftWrap {
+		rumor, err := unwrapGiftWrap(privkey, e)
+		if err != nil {
+			return "", err
+		}
+		return decompressPlaintext(rumor.Content)
+	}
+	return decryptMessage(privkey, e.PubKey, e.Content)
+}
+
+func decryptMessage(privkey, pubkey, content string) (string, error) {
+	if content == "" {
+		return "", fmt.Errorf("empty content")
+	}
+	key, err := nip44.GenerateConversationKey(pubkey, privkey)
+	if err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	plaintext, err := nip44.Decrypt(content, key)
+	if err != nil {
+		return "", err
+	}
+	return decompressPlaintext(plaintext)
+}
+
+func relayList(opts *options) []string {
+	relays := []string{
+		"wss://relay.damus.io",
+		"wss://relay.nostr.band",
+		"wss://nos.lol",
+	}
+
+	var ranked []string
+	if opts.autoSelect > 0 {
+		if scores, err := loadRelayScores(relayScoresPath()); err == nil && len(scores) > 0 {
+			ranked = rankedRelays(scores)
+			if len(ranked) > opts.autoSelect {
+				ranked = ranked[:opts.autoSelect]
+			}
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Auto-selected relays: %v\n", ranked)
+			}
+		} else if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] No relay scores yet, using the relay list\n")
+		}
+	}
+
+	// --max-relays, --relay-latency-sort and --private-relay apply to
+	// auto-selected relays as much as to a listed one.
+	if len(ranked) > 0 {
+		relays = ranked
+	} else if opts.relays != "" {
+		relays = strings.Split(opts.relays, ",")
+		for i := range relays {
+			relays[i] = normalizeRelayURL(strings.TrimSpace(relays[i]))
+		}
+	} else if path := configPath(opts); path != "" {
+		cfg, err := loadConfig(path)
+		if err == nil && len(cfg.Relays) > 0 {
+			relays = cfg.Relays
+		} else if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "[ndm] Ignoring config: %v\n", err)
+		}
+	}
+
+	if opts.maxRelays > 0 && len(relays) > opts.maxRelays {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Capping relay list from %d to %d\n", len(relays), opts.maxRelays)
+		}
+		relays = relays[:opts.maxRelays]
+	}
+
+	if opts.latencySort {
+		relays = sortRelaysByLatency(opts, relays)
+	}
+	if opts.privateRelay != "" {
+		relays = append([]string{opts.privateRelay}, slices.DeleteFunc(relays, func(r string) bool {
+			return r == opts.privateRelay
+		})...)
+	}
+	return relays
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		printHelp()
+		return nil
+	}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if opts.jsonSchema {
+		return jsonSchemaCommand(opts)
+	}
+	if opts.command == "version" {
+		return versionCommand(opts)
+	}
+	if opts.command == "keygen" {
+		return keygenCommand(opts)
+	}
+	if opts.command == "relay" {
+		return relayCommand(opts)
+	}
+	if opts.command == "relay-scores" {
+		return relayScoresCommand(opts)
+	}
+	if opts.command == "trust" {
+		return trustCommand(opts)
+	}
+	if opts.command == "keyscan" {
+		return keyscanCommand(opts)
+	}
+	if opts.command == "aggregate" {
+		return aggregateCommand(opts)
+	}
+	if opts.command == "encode-recipient" {
+		return encodeRecipientCommand(opts)
+	}
+	if opts.command == "key-share" {
+		return keyShareCommand(opts)
+	}
+	if opts.command == "rebroadcast" {
+		return rebroadcastCommand(opts)
+	}
+	if opts.command == "event-seen-by" {
+		return eventSeenByCommand(opts)
+	}
+	if opts.command == "pretty-json" {
+		return prettyJSONCommand(opts)
+	}
+	if opts.command == "lint-event" {
+		return lintEventCommand(opts)
+	}
+	if opts.command == "reply-all" {
+		return replyAllCommand(opts)
+	}
+	if opts.command == "trace" {
+		return traceCommand(opts)
+	}
+	if opts.command == "inbox-zero" {
+		return inboxZeroCommand(opts)
+	}
+	if opts.command == "export" {
+		return exportMessages(opts)
+	}
+	if opts.command == "watch" {
+		return watchMessages(opts)
+	}
+	if opts.read {
+		return readMessages(opts)
+	}
+	if opts.fromFile != "" {
+		return sendToRecipients(opts)
+	}
+	return sendMessage(opts)
+}
+
+func sendMessage(opts *options) (err error) {
+	start := time.Now()
+	defer func() { writeMetrics(opts, "send", start, err) }()
+	defer writeRelayInfo(opts)
+
+	if err := checkMessageForKeys(opts); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	var signer nostr.Keyer
+	if opts.hardwareSign {
+		signer, err = newFIDO2Signer()
+		if err != nil {
+			return err
+		}
+	} else {
+		var privkey string
+		if opts.ephemeralKey {
+			// The key only lives for this send and is never written anywhere.
+			privkey = nostr.GeneratePrivateKey()
+			fmt.Fprintln(os.Stderr, "Warning: sending with a one-time key; the recipient cannot reply to it")
+		} else {
+			privkey, err = resolvePrivateKey(opts.key)
+			if err != nil {
+				return fmt.Errorf("invalid private key: %w", err)
+			}
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Using key: %s...\n", privkey[:20])
+			}
+		}
+		if signer, err = newKeySigner(privkey); err != nil {
+			return err
+		}
+	}
+	opts.trace.step("Key resolved", "")
+
+	var recipientPubkey string
+	viaNIP05 := nip05.IsValidIdentifier(opts.recipient)
+	if viaNIP05 {
+		recipientPubkey, err = resolveRecipient(ctx, opts.recipient)
+	} else {
+		recipientPubkey, err = resolveKey(opts.recipient)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	opts.trace.step("Recipient resolved", recipientPubkey)
+
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Sending to: %s\n", recipientPubkey)
+	}
+
+	event, err := signDMEvent(ctx, opts, signer, recipientPubkey)
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun || opts.signOnly {
+		if opts.ephemeralKey {
+			ephemeralNpub, _ := nip19.EncodePublicKey(event.PubKey)
+			fmt.Fprintf(os.Stderr, "Ephemeral pubkey: %s\n", ephemeralNpub)
+		}
+		var printed any = event
+		if opts.noSign {
+			printed = eventTemplate{Kind: event.Kind, PubKey: event.PubKey, CreatedAt: event.CreatedAt, Tags: event.Tags, Content: event.Content}
+		}
+		out, err := marshalJSON(printed, opts)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		fmt.Println(string(out))
+		if opts.output != "" {
+			if err := os.WriteFile(opts.output, append(out, '\n'), 0o600); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+		}
+		if opts.signOnly {
+			return errSignedOnly
+		}
+		return nil
+	}
+
+	// Everything from here on may talk to relays, which --dry-run and
+	// --sign-only never do. The delay comes first, so no relay sees a
+	// connection at the moment of sending either.
+	if opts.randomDelay > 0 {
+		delay, err := randomDuration(opts.randomDelay)
+		if err != nil {
+			return fmt.Errorf("failed to pick random delay: %w", err)
+		}
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Waiting %v before publishing\n", delay)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	relays := relayList(opts)
+	if viaNIP05 && opts.verifyNIP05 {
+		if err := verifyRecipientNIP05(ctx, opts, relays, recipientPubkey); err != nil {
+			return fmt.Errorf("invalid recipient: %w", err)
+		}
+	}
+	if opts.writeProof > len(relays) {
+		return fmt.Errorf("--relay-write-proof %d needs at least that many relays, but only %d are configured", opts.writeProof, len(relays))
+	}
+
+	if opts.hopVia != "" {
+		relays = hopRelays(ctx, opts, relays, recipientPubkey)
+	}
+
+	var accepted []string
+	var attempts []relayAttempt
+	for _, relay := range relays {
+		if opts.health.blocked(relay) {
+			continue
+		}
+		opts.stats.RelaysTried++
+		began := time.Now()
+		opts.trace.step("Connecting", relay)
+		rc, err := connectRelay(ctx, opts, relay)
+		if err == nil {
+			opts.trace.step("Connected", relay)
+			err = rc.Publish(ctx, event)
+			rc.Close()
+		}
+		opts.health.record(opts, relay, err)
+		attempts = append(attempts, relayAttempt{relay: relay, ok: err == nil, latency: time.Since(began)})
+		if err == nil {
+			opts.trace.step("Published", relay+": OK")
+			writeRelayStat(opts, "send", relay, began, 1, nil)
+			accepted = append(accepted, relay)
+			continue
+		}
+		opts.trace.step("Relay failed", relay+": "+err.Error())
+		writeRelayStat(opts, "send", relay, began, 0, err)
+		if relay == opts.privateRelay {
+			if !opts.allowPrivate {
+				updateRelayScores(opts, attempts)
+				return fmt.Errorf("private relay %s failed: %w (use --allow-private-relay-failure to fall back to public relays)", relay, err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: private relay %s failed, falling back to public relays: %v\n", relay, err)
+		}
+	}
+	updateRelayScores(opts, attempts)
+	published := len(accepted)
+	opts.stats.RelaysSucceeded = published
+
+	if published == 0 {
+		return fmt.Errorf("failed to publish to any relay")
+	}
+	if published < opts.writeProof {
+		return fmt.Errorf("only %d of %d relays accepted the event, --relay-write-proof needs %d", published, len(relays), opts.writeProof)
+	}
+
+	recipientNpub, _ := nip19.EncodePublicKey(recipientPubkey)
+
+	if opts.trace != nil {
+		opts.trace.step("Done", fmt.Sprintf("accepted by %d of %d relays", published, len(relays)))
+	} else if opts.jsonOutput {
+		out, _ := marshalJSON(sendResult{true, encodeEventID(event.ID, accepted[0], event.PubKey, opts.idFormat), event.ID, recipientNpub, published}, opts)
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("✓ DM sent successfully\n")
+		fmt.Printf("  Message ID: %s\n", event.ID)
+		to := recipientNpub
+		if opts.pubkeyDisplay != "" {
+			to = formatPubkey(recipientPubkey, opts.pubkeyDisplay)
+		}
+		fmt.Printf("  To: %s\n", to)
+		fmt.Printf("  Relays: %d\n", published)
+	}
+
+	if opts.onSendSuccess != "" {
+		runHook(opts, "--on-send-success", opts.onSendSuccess,
+			"NDM_EVENT_ID="+event.ID,
+			"NDM_RECIPIENT="+recipientNpub,
+			fmt.Sprintf("NDM_RELAYS_COUNT=%d", published),
+		)
+	}
+
+	if opts.showQR {
+		// Keep stdout valid JSON when --json is set.
+		w := os.Stdout
+		if opts.jsonOutput {
+			w = os.Stderr
+		}
+		if err := printEventQR(w, event.ID, accepted[0], event.PubKey); err != nil {
+			return err
+		}
+	}
+
+	if opts.saveRelays {
+		path := configPath(opts)
+		if path == "" {
+			return fmt.Errorf("could not determine config file location")
+		}
+		if err := saveConfigRelays(path, accepted); err != nil {
+			return fmt.Errorf("failed to save relays: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Saved %d relays to %s\n", len(accepted), path)
+	}
+
+	return nil
+}
+
+// randomDuration returns a uniformly random duration in [0, max], drawn from
+// crypto/rand so the delay cannot be predicted.
+func randomDuration(max time.Duration) (time.Duration, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)+1))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n.Int64()), nil
+}
+
+// buildDMEvent encrypts opts.message for the recipient and returns the
+// DM event signed with privkey.
+func buildDMEvent(opts *options, privkey, recipientPubkey string) (nostr.Event, error) {
+	signer, err := newKeySigner(privkey)
+	if err != nil {
+		return nostr.Event{}, err
+	}
+	return signDMEvent(context.Background(), opts, signer, recipientPubkey)
+}
+
+// newKeySigner wraps a private key held in memory.
+func newKeySigner(privkey string) (nostr.Keyer, error) {
+	signer, err := keyer.NewPlainKeySigner(privkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return signer, nil
+}
+
+// signDMEvent is buildDMEvent for any signer, such as a hardware key. With
+// --nip 17 the event is a NIP-17 gift wrap, otherwise a kind-4 DM.
+func signDMEvent(ctx context.Context, opts *options, signer nostr.Keyer, recipientPubkey string) (nostr.Event, error) {
+	tags := nostr.Tags{{"p", recipientPubkey}}
+	if opts.subject != "" {
+		tags = append(tags, nostr.Tag{"subject", opts.subject})
+	}
+	if opts.contentType != "" {
+		tags = append(tags, nostr.Tag{"content-type", opts.contentType})
+	}
+	if opts.language != "" {
+		tags = append(tags, nostr.Tag{"content-language", opts.language})
+	}
+	if opts.contentHash {
+		tags = append(tags, nostr.Tag{"content-hash", contentHash(opts.message)})
+	}
+	if opts.label != "" {
+		tags = append(tags, nostr.Tag{"L", labelNamespace}, nostr.Tag{"l", opts.label, labelNamespace})
+	}
+	tags = append(tags, opts.extraTags...)
+
+	if opts.nip == 17 {
+		return giftWrapDM(ctx, opts, signer, recipientPubkey, tags)
+	}
+
+	encryptedContent, err := signer.Encrypt(ctx, compressPlaintext(opts.message, opts), recipientPubkey)
+	if err != nil {
+		return nostr.Event{}, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	opts.trace.step("Encrypted", "")
+
+	event := nostr.Event{
+		Kind:      nostr.KindEncryptedDirectMessage,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   encryptedContent,
+	}
+
+	// With --no-sign the event is a template for signing elsewhere: it
+	// carries the pubkey but no id or signature.
+	if opts.noSign {
+		event.PubKey, err = signer.GetPublicKey(ctx)
+		if err != nil {
+			return nostr.Event{}, fmt.Errorf("failed to get public key: %w", err)
+		}
+		return event, nil
+	}
+	if err := signer.SignEvent(ctx, &event); err != nil {
+		return nostr.Event{}, fmt.Errorf("failed to sign event: %w", err)
+	}
+	opts.trace.step("Signed", "id: "+event.ID)
+	return event, nil
+}
+
+// eventTemplate is an unsigned event as printed with --no-sign. Unlike
+// nostr.Event it keeps the empty id and sig in its JSON.
+type eventTemplate struct {
+	ID        string          `json:"id"`
+	PubKey    string          `json:"pubkey"`
+	CreatedAt nostr.Timestamp `json:"created_at"`
+	Kind      int             `json:"kind"`
+	Tags      nostr.Tags      `json:"tags"`
+	Content   string          `json:"content"`
+	Sig       string          `json:"sig"`
+}
+
+// contentHash returns the hex SHA-256 of plaintext, as used by --content-hash.
+func contentHash(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyContentHash reports whether the event has a content-hash tag and, if
+// so, whether it matches the decrypted plaintext.
+func verifyContentHash(e *nostr.Event, plaintext string) (tagged, ok bool) {
+	want := tagValue(e, "content-hash")
+	if want == "" {
+		return false, false
+	}
+	return true, strings.EqualFold(want, contentHash(plaintext))
+}
+
+// labelNamespace is the NIP-32 namespace used by --label and --topic.
+const labelNamespace = "ndm/label"
+
+// eventLabels returns the event's labels in the ndm/label namespace.
+func eventLabels(e *nostr.Event) []string {
+	var labels []string
+	for _, tag := range e.Tags {
+		if len(tag) >= 3 && tag[0] == "l" && tag[2] == labelNamespace {
+			labels = append(labels, tag[1])
+		}
+	}
+	return labels
+}
+
+// filterByTopic keeps the events labeled topic. "*" keeps every event.
+func filterByTopic(events []*nostr.Event, topic string) []*nostr.Event {
+	if topic == "" || topic == "*" {
+		return events
+	}
+	var kept []*nostr.Event
+	for _, e := range events {
+		if slices.Contains(eventLabels(e), topic) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// filterByPTag keeps the events with a p tag for pubkey, for
+// --require-p-tag-match. A relay should never send others, but a
+// misconfigured or hostile one might.
+func filterByPTag(events []*nostr.Event, pubkey string, opts *options) []*nostr.Event {
+	var kept []*nostr.Event
+	for _, e := range events {
+		if e.Tags.FindWithValue("p", pubkey) != nil {
+			kept = append(kept, e)
+		} else if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Dropping event %s: it does not tag your pubkey\n", e.ID)
+		}
+	}
+	return kept
+}
+
+// tagValue returns the value of the first tag named key, or "".
+func tagValue(e *nostr.Event, key string) string {
+	tag := e.Tags.Find(key)
+	if len(tag) < 2 {
+		return ""
+	}
+	return tag[1]
+}
+
+func readMessages(opts *options) (err error) {
+	start := time.Now()
+	defer func() { writeMetrics(opts, "read", start, err) }()
+	defer writeRelayInfo(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	privkey, err := resolvePrivateKey(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	pubkey, err := derivePublicKeyFromPrivate(privkey, opts.directDerive)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	relays := relayList(opts)
+
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Using key: %s...\n", privkey[:20])
+		fmt.Fprintf(os.Stderr, "[ndm] Pubkey: %s\n", pubkey)
+		fmt.Fprintf(os.Stderr, "[ndm] Fetching from: %v\n", relays)
+		if !isEncryptedKind(opts.eventKind) {
+			fmt.Fprintf(os.Stderr, "[ndm] Kind %d is not a DM kind; content is shown without decryption\n", opts.eventKind)
+		}
+	}
+
+	if opts.decryptKey != "" {
+		// The inbox is still picked by --key; only decryption uses this key.
+		if privkey, err = resolvePrivateKey(opts.decryptKey); err != nil {
+			return fmt.Errorf("invalid --decrypt-with-key: %w", err)
+		}
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Decrypting with key: %s...\n", privkey[:20])
+		}
+	}
+
+	filter := readFilter(opts, pubkey)
+	since := readSince(opts)
+	var lastRead nostr.Timestamp
+	if opts.sinceLastRead {
+		lastRead, err = loadLastRead(pubkey)
+		if err != nil {
+			return err
+		}
+		if lastRead > 0 {
+			since = lastRead + 1
+			setSince(&filter, since)
+		}
+	}
+	if opts.sinceEvent != "" {
+		anchor, _ := fetchEventByID(ctx, opts, relays, opts.sinceEvent)
+		if anchor == nil {
+			return fmt.Errorf("--since-event %s not found on any relay", opts.sinceEvent)
+		}
+		since = anchor.CreatedAt
+		setSince(&filter, since)
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Reading messages since %s (%d)\n", opts.sinceEvent, anchor.CreatedAt)
+		}
+	}
+
+	var events []*nostr.Event
+	if opts.importFile != "" {
+		events, err = loadEvents(opts.importFile)
+		if err != nil {
+			return fmt.Errorf("failed to import events: %w", err)
+		}
+		if len(events) > opts.count {
+			events = events[:opts.count]
+		}
+	} else if opts.fromStdin {
+		events, err = readStdinEvents(os.Stdin, filter, opts.count)
+		if err != nil {
+			return err
+		}
+	} else {
+		events = queryEvents(ctx, opts, relays, filter)
+	}
+	events = deduplicateEvents(events)
+	opts.stats.EventsFetched = len(events)
+	events = dropBefore(unwrapGiftWraps(events, privkey, opts), since)
+	if opts.requirePTag {
+		events = filterByPTag(events, pubkey, opts)
+	}
+
+	events, err = handleDecryptErrors(events, privkey, opts)
+	if err != nil {
+		return err
+	}
+	if opts.trustedOnly {
+		events, err = filterTrusted(ctx, opts, relays, events)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.limitFollows {
+		events, err = filterFollows(ctx, opts, relays, pubkey, events)
+		if err != nil {
+			return err
+		}
+	}
+	events = filterByTopic(events, opts.topic)
+	if opts.sinceEvent != "" {
+		// Since is inclusive; the anchor itself was already seen.
+		events = slices.DeleteFunc(events, func(e *nostr.Event) bool { return e.ID == opts.sinceEvent })
+	}
+	if opts.conversation != "" {
+		events = filterByConversation(events, opts.conversation)
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No messages found")
+		return nil
+	}
+
+	if opts.nip05From {
+		resolveNIP05Names(ctx, opts, relays, events)
+	}
+	if opts.parseMentions {
+		resolveMentions(ctx, opts, relays, events, privkey)
+	}
+
+	if opts.groupByDay {
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].CreatedAt < events[j].CreatedAt
+		})
+	}
+
+	if opts.jsonOutput {
+		var msgs []any
+		for i, e := range events {
+			if opts.groupByDay && i > 0 && eventDay(e) != eventDay(events[i-1]) {
+				msgs = append(msgs, map[string]string{"type": "date_separator", "date": eventDay(e)})
+			}
+			msgs = append(msgs, omitFields(newJSONMessage(e, privkey, opts), opts))
+		}
+		if opts.sinceEvent != "" {
+			msgs = append(msgs, map[string]string{"type": "cursor", "prev_cursor": newestEvent(events).ID})
+		}
+		out, _ := marshalJSON(msgs, opts)
+		fmt.Println(string(out))
+	} else if opts.tmpl != nil {
+		for _, e := range events {
+			if err := fprintTemplate(os.Stdout, e, privkey, opts); err != nil {
+				return err
+			}
+		}
+	} else if opts.format == "table" {
+		printTable(events, privkey, opts)
+	} else {
+		fmt.Printf("Found %d messages:\n\n", len(events))
+		depths := threadDepths(events, opts.conversation)
+		for i, e := range events {
+			if opts.groupByDay && i > 0 && eventDay(e) != eventDay(events[i-1]) {
+				fmt.Printf("--- %s ---\n\n", eventDay(e))
+			}
+			if depth := depths[e.ID]; depth > 0 {
+				printIndented(i+1, e, privkey, opts, depth)
+			} else {
+				printMessage(i+1, e, privkey, opts)
+			}
+		}
+	}
+
+	if newest := newestTimestamp(events); opts.sinceLastRead && newest > lastRead {
+		if err := saveLastRead(pubkey, newest); err != nil {
+			return fmt.Errorf("failed to save last-read state: %w", err)
+		}
+	}
+	return nil
+}
+
+// readFilter returns the relay filter for --event-kind events (DMs by
+// default) to pubkey, plus reactions with --include-reaction, limited by
+// --count and --since or --max-age. Gift wraps are asked for from further
+// back, so the results still need dropBefore(readSince(opts)).
+func readFilter(opts *options, pubkey string) nostr.Filter {
+	kinds := []int{opts.eventKind}
+	if opts.eventKind == nostr.KindEncryptedDirectMessage && !opts.kind4Only {
+		// NIP-17 messages arrive as gift wraps.
+		kinds = append(kinds, nostr.KindGiftWrap)
+	}
+	if opts.reactions {
+		kinds = append(kinds, nostr.KindReaction)
+	}
+	filter := nostr.Filter{
+		Kinds: kinds,
+		Tags:  nostr.TagMap{"p": []string{pubkey}},
+		Limit: opts.count,
+	}
+	if since := readSince(opts); since > 0 {
+		setSince(&filter, since)
+	}
+	return filter
+}
+
+// readSince returns the time set by --max-age or --since, or 0 for none.
+func readSince(opts *options) nostr.Timestamp {
+	if opts.maxAge > 0 {
+		return nostr.Timestamp(time.Now().Add(-opts.maxAge).Unix())
+	}
+	if !opts.since.IsZero() {
+		return nostr.Timestamp(opts.since.Unix())
+	}
+	return 0
+}
+
+// parseSince accepts a unix timestamp or an RFC 3339 time.
+func parseSince(s string) (time.Time, error) {
+	var unix int64
+	if _, err := fmt.Sscanf(s, "%d", &unix); err == nil && isDigits(s) {
+		return time.Unix(unix, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q: want a unix timestamp or RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// parseAge is time.ParseDuration extended with d (days) and w (weeks).
+func parseAge(s string) (time.Duration, error) {
+	expanded := ageUnitPattern.ReplaceAllStringFunc(s, func(m string) string {
+		var n float64
+		fmt.Sscanf(m[:len(m)-1], "%g", &n)
+		hours := n * 24
+		if m[len(m)-1] == 'w' {
+			hours *= 7
+		}
+		return fmt.Sprintf("%gh", hours)
+	})
+	d, err := time.ParseDuration(expanded)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid --max-age %q: want a duration like 24h, 7d or 2w", s)
+	}
+	return d, nil
+}
+
+// languagePattern is the subset of BCP 47 accepted by --content-language: a
+// language code with an optional region.
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// tagKeyPattern is what --tag accepts as a tag name.
+var tagKeyPattern = regexp.MustCompile(`^[a-z]+$`)
 
-	return opts, nil
+// parseCustomTag parses a --tag value of the form <key>=<value>, split at
+// the first '='. The p and e tags carry the recipient and thread, so they
+// cannot be set this way.
+func parseCustomTag(spec string) (nostr.Tag, error) {
+	key, value, ok := strings.Cut(spec, "=")
+	if !ok || !tagKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("invalid tag %q: expected <key>=<value> with a lowercase key", spec)
+	}
+	if key == "p" || key == "e" {
+		return nil, fmt.Errorf("invalid tag %q: the %s tag is reserved", spec, key)
+	}
+	return nostr.Tag{key, value}, nil
 }
 
-func resolveKey(input string) (string, error) {
-	input = strings.TrimSpace(input)
+var ageUnitPattern = regexp.MustCompile(`[0-9.]+[dw]`)
 
-	if len(input) == 64 && isHex(input) {
-		_, err := derivePublicKeyFromPrivate(input)
-		if err == nil {
-			return derivePublicKeyFromPrivate(input)
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
 		}
-		return input, nil
 	}
+	return s != ""
+}
 
-	if strings.HasPrefix(input, "nsec") {
-		prefix, value, _ := nip19.Decode(input)
-		if prefix == "nsec" {
-			secret, ok := value.(string)
-			if ok {
-				return derivePublicKeyFromPrivate(secret)
-			}
+// handleDecryptErrors applies the --on-decrypt-error policy to events that
+// cannot be decrypted. Without an explicit mode, JSON output skips them and
+// text output shows the raw content.
+func handleDecryptErrors(events []*nostr.Event, privkey string, opts *options) ([]*nostr.Event, error) {
+	mode := opts.onDecryptErr
+	if mode == "" {
+		mode = "show-raw"
+		if opts.jsonOutput {
+			mode = "skip"
 		}
 	}
 
-	if strings.HasPrefix(input, "npub") {
-		prefix, value, _ := nip19.Decode(input)
-		if prefix == "npub" {
-			pubkey, ok := value.(string)
-			if ok {
-				return pubkey, nil
+	kept := events[:0:0]
+	for _, e := range events {
+		if _, err := messageContent(privkey, e); err != nil {
+			opts.stats.EventsFailed++
+			switch mode {
+			case "abort":
+				return nil, fmt.Errorf("failed to decrypt event %s: %w", e.ID, err)
+			case "skip":
+				if opts.verbose {
+					fmt.Fprintf(os.Stderr, "[ndm] Skipping undecryptable event %s: %v\n", e.ID, err)
+				}
+				continue
 			}
+		} else {
+			opts.stats.EventsDecrypted++
 		}
+		kept = append(kept, e)
 	}
+	return kept, nil
+}
 
-	return "", fmt.Errorf("could not resolve key: %s", input)
+// eventDay returns the local calendar date of an event as YYYY-MM-DD.
+func eventDay(e *nostr.Event) string {
+	return time.Unix(int64(e.CreatedAt), 0).Format("2006-01-02")
 }
 
-func resolvePrivateKey(input string) (string, error) {
-	input = strings.TrimSpace(input)
+// formatTimestamp renders ts using a --timestamp-format value: a Go time
+// layout or one of the aliases rfc3339, unix and relative. An empty format
+// uses fallback.
+func formatTimestamp(ts nostr.Timestamp, format, fallback string) string {
+	t := time.Unix(int64(ts), 0)
+	switch format {
+	case "":
+		return t.Format(fallback)
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return fmt.Sprintf("%d", ts)
+	case "relative":
+		return relativeTime(time.Since(t))
+	default:
+		return t.Format(format)
+	}
+}
 
-	if len(input) == 64 && isHex(input) {
-		return input, nil
+// relativeTime describes a duration in the past in the largest whole unit,
+// e.g. "3 minutes ago".
+func relativeTime(d time.Duration) string {
+	if d < 0 {
+		return "in the future"
 	}
 
-	if strings.HasPrefix(input, "nsec") {
-		prefix, value, _ := nip19.Decode(input)
-		if prefix == "nsec" {
-			secret, ok := value.(string)
-			if !ok {
-				return "", fmt.Errorf("invalid secret value")
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	for _, u := range units {
+		if n := int(d / u.size); n > 0 {
+			if n == 1 {
+				return fmt.Sprintf("1 %s ago", u.name)
 			}
-			return secret, nil
+			return fmt.Sprintf("%d %ss ago", n, u.name)
 		}
 	}
+	return "just now"
+}
 
-	return "", fmt.Errorf("invalid private key format")
+// jsonMessage is the JSON representation of a received message.
+type jsonMessage struct {
+	ID        string       `json:"id" desc:"Event ID, as set by --event-id-format (hex by default)"`
+	From      string       `json:"from" desc:"Sender public key in hex, only its first 8 characters with --anonymize-from"`
+	FromNIP05 any          `json:"from_nip05,omitempty" desc:"Sender NIP-05 identifier with --nip05-from, null when unverified"`
+	Subject   string       `json:"subject,omitempty" desc:"Value of the subject tag"`
+	Topics    []string     `json:"topics,omitempty" desc:"NIP-32 labels (l tags) in the ndm/label namespace, as added with --label"`
+	Content   string       `json:"content" desc:"Decrypted message, possibly truncated"`
+	Raw       string       `json:"raw,omitempty" desc:"Undecrypted content when decryption failed"`
+	Truncated bool         `json:"truncated,omitempty" desc:"Whether content was cut by --max-content-length"`
+	Full      string       `json:"full_content,omitempty" desc:"Untruncated message when content was truncated"`
+	HashOK    *bool        `json:"hash_verified,omitempty" desc:"Whether the content matched its hash tag, when present"`
+	CreatedAt int64        `json:"created_at" desc:"Event creation time (Unix seconds)"`
+	SigValid  bool         `json:"signature_valid" desc:"Whether the event signature verified"`
+	RawEvent  *nostr.Event `json:"raw_event" desc:"The event as received from the relay"`
+	Type      string       `json:"type,omitempty" desc:"reaction for NIP-25 reactions, empty for messages"`
+	ReactedTo string       `json:"reacted_to,omitempty" desc:"ID of the event a reaction is for"`
+	IDBech32  string       `json:"event_id_bech32,omitempty" desc:"Event ID as an nevent with a relay hint, with --bech32-event-ids"`
+	Mentions  []mention    `json:"mentions,omitempty" desc:"nostr: URIs found in the message, with --parse-mentions"`
+	Decoded   string       `json:"decoded_bytes_hex,omitempty" desc:"Hex of the base64-decoded content, with --content-encoding base64"`
 }
 
-func derivePublicKeyFromPrivate(privkeyHex string) (string, error) {
-	evt := &nostr.Event{
-		Kind:      1,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
-		Content:   "temp",
-	}
-	err := evt.Sign(privkeyHex)
-	if err != nil {
-		return "", err
-	}
-	return evt.PubKey, nil
+// sendResult is the --json output of a successful send.
+type sendResult struct {
+	Success     bool   `json:"success" desc:"Always true; failed sends exit with an error"`
+	ID          string `json:"id" desc:"ID of the published event, as set by --event-id-format"`
+	MessageID   string `json:"message_id" desc:"Hex ID of the published event, kept for older scripts"`
+	EncryptedTo string `json:"encrypted_to" desc:"Recipient npub"`
+	Relays      int    `json:"relays" desc:"Number of relays that accepted the event"`
 }
 
-func decryptMessage(privkey, pubkey, content string) (string, error) {
-	if content == "" {
-		return "", fmt.Errorf("empty content")
-	}
-	key, err := nip44.GenerateConversationKey(pubkey, privkey)
-	if err != nil {
-		return "", fmt.Errorf("generate key: %w", err)
+// jsonFields holds the JSON keys of jsonMessage, the names --omit-fields
+// accepts.
+var jsonFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(jsonMessage{})
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
 	}
-	return nip44.Decrypt(content, key)
-}
+	return fields
+}()
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// omitFields drops the --omit-fields keys from msg. Without any it returns
+// msg unchanged so the field order is kept.
+func omitFields(msg jsonMessage, opts *options) any {
+	if len(opts.omitFields) == 0 {
+		return msg
 	}
-	return b
+	data, _ := json.Marshal(msg)
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	for _, name := range opts.omitFields {
+		delete(fields, name)
+	}
+	return fields
 }
 
-func isHex(s string) bool {
-	for _, c := range s {
-		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
-			return false
-		}
+// marshalJSON encodes v for output, indented by --format-json-indent spaces
+// or on one line when that is 0.
+func marshalJSON(v any, opts *options) ([]byte, error) {
+	if opts.jsonIndent <= 0 {
+		return json.Marshal(v)
 	}
-	return true
+	return json.MarshalIndent(v, "", strings.Repeat(" ", opts.jsonIndent))
 }
 
-func run(args []string) error {
-	if len(args) == 0 {
-		printHelp()
-		return nil
+func newJSONMessage(e *nostr.Event, privkey string, opts *options) jsonMessage {
+	msg := jsonMessage{
+		ID:        encodeEventID(e.ID, opts.eventRelays[e.ID], e.PubKey, opts.idFormat),
+		From:      e.PubKey,
+		Subject:   tagValue(e, "subject"),
+		Topics:    eventLabels(e),
+		CreatedAt: int64(e.CreatedAt),
+		RawEvent:  e,
 	}
-
-	opts, err := parseArgs(args)
+	msg.SigValid, _ = e.CheckSignature()
+	if opts.unwrapped[e.ID] {
+		// NIP-17 rumors are never signed; the seal around it was.
+		msg.SigValid = true
+	}
+	if opts.bech32IDs {
+		msg.IDBech32 = eventBech32(e, opts)
+	}
+	if e.Kind == nostr.KindReaction {
+		msg.Type = "reaction"
+		msg.ReactedTo = reactionTarget(e)
+	}
+	if opts.anonymizeFrom {
+		msg.From = anonymizePubkey(e.PubKey)
+	}
+	if opts.nip05From {
+		// A typed nil is written as null; without the flag the field is left out.
+		var name *string
+		if n := opts.nip05Names[e.PubKey]; n != "" {
+			name = &n
+		}
+		msg.FromNIP05 = name
+	}
+	decrypted, err := messageContent(privkey, e)
 	if err != nil {
-		return err
+		msg.Raw = e.Content
+		return msg
 	}
-
-	if opts.read {
-		return readMessages(opts)
+	if tagged, ok := verifyContentHash(e, decrypted); tagged {
+		msg.HashOK = &ok
 	}
-	return sendMessage(opts)
-}
-
-func sendMessage(opts *options) error {
-	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
-	defer cancel()
+	if opts.parseMentions {
+		msg.Mentions = findMentions(decrypted, opts)
+	}
+	if data, ok := decodeBinaryContent(decrypted, opts); ok {
+		msg.Decoded = hex.EncodeToString(data)
+		if opts.decodeOutput != "" {
+			if _, err := saveBinaryContent(e, data, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "[ndm] Warning: %v\n", err)
+			}
+		}
+	}
+	decrypted = displayContent(decrypted, opts)
 
-	privkey, err := resolvePrivateKey(opts.key)
-	if err != nil {
-		return fmt.Errorf("invalid private key: %w", err)
+	msg.Content, msg.Truncated = truncateContent(decrypted, opts.maxContent)
+	if msg.Truncated && !opts.noFullContent {
+		msg.Full = decrypted
 	}
+	return msg
+}
 
-	recipientPubkey, err := resolveKey(opts.recipient)
-	if err != nil {
-		return fmt.Errorf("invalid recipient: %w", err)
+// displayContent prepares decrypted content for output: --charset, then
+// --parse-mentions, then --pipe-to, then --redact. The event itself is never
+// changed.
+func displayContent(content string, opts *options) string {
+	content = decodeCharset(content, opts)
+	if opts.parseMentions {
+		content = replaceMentions(content, opts)
 	}
+	return redact(pipeContent(content, opts), opts.redactions)
+}
 
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://nos.lol",
+// truncateContent shortens s to at most n runes plus an ellipsis, cutting at
+// the last word boundary when there is one. n <= 0 means no limit.
+func truncateContent(s string, n int) (string, bool) {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s, false
 	}
 
-	if opts.relays != "" {
-		relays = strings.Split(opts.relays, ",")
-		for i := range relays {
-			relays[i] = strings.TrimSpace(relays[i])
+	cut := n
+	if !unicode.IsSpace(r[n]) {
+		for i := n - 1; i > 0; i-- {
+			if unicode.IsSpace(r[i]) {
+				cut = i
+				break
+			}
 		}
 	}
+	return strings.TrimRightFunc(string(r[:cut]), unicode.IsSpace) + "…", true
+}
 
-	if opts.verbose {
-		fmt.Fprintf(os.Stderr, "[ndm] Using key: %s...\n", privkey[:20])
-		fmt.Fprintf(os.Stderr, "[ndm] Sending to: %s\n", recipientPubkey)
+// senderDisplay returns how a sender is shown in human output: the pubkey
+// formatted for --pubkey-display, their NIP-05 identifier with --nip05-from,
+// or just the start of the hex pubkey with --anonymize-from.
+func senderDisplay(pubkey string, opts *options) string {
+	if opts.anonymizeFrom {
+		return anonymizePubkey(pubkey)
+	}
+	if name := opts.nip05Names[pubkey]; name != "" {
+		return name
 	}
+	return formatPubkey(pubkey, opts.pubkeyDisplay)
+}
 
-	// Encrypt the message
-	conversationKey, err := nip44.GenerateConversationKey(recipientPubkey, privkey)
-	if err != nil {
-		return fmt.Errorf("failed to generate conversation key: %w", err)
+// formatPubkey shows a hex pubkey for --pubkey-display: short is the first
+// 16 hex characters, full the whole hex key and npub the whole npub. The
+// default, "", is the start of the npub.
+func formatPubkey(pubkey, mode string) string {
+	switch mode {
+	case "full":
+		return pubkey
+	case "npub":
+		if npub, err := nip19.EncodePublicKey(pubkey); err == nil {
+			return npub
+		}
+		return pubkey
+	case "short":
+		return pubkey[:min(16, len(pubkey))] + "..."
 	}
-	encryptedContent, err := nip44.Encrypt(opts.message, conversationKey)
+	npub, err := nip19.EncodePublicKey(pubkey)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt: %w", err)
+		return pubkey[:min(16, len(pubkey))] + "..."
 	}
+	return npub[:20] + "..."
+}
 
-	event := nostr.Event{
-		Kind:      nostr.KindEncryptedDirectMessage,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
-		Tags:      nostr.Tags{{"p", recipientPubkey}},
-		Content:   encryptedContent,
+// reactionTarget returns the ID of the event a NIP-25 reaction is for: the
+// last e tag.
+func reactionTarget(e *nostr.Event) string {
+	if tag := e.Tags.FindLast("e"); tag != nil {
+		return tag[1]
 	}
+	return ""
+}
 
-	err = event.Sign(privkey)
-	if err != nil {
-		return fmt.Errorf("failed to sign event: %w", err)
+// displayID shortens an event ID to --truncate-id characters; 0 or anything
+// at least as long as the ID shows it in full.
+func displayID(id string, opts *options) string {
+	if opts.truncateID <= 0 || opts.truncateID >= len(id) {
+		return id
 	}
+	return id[:opts.truncateID] + "..."
+}
 
-	published := 0
-	for _, relay := range relays {
-		rc, err := nostr.RelayConnect(ctx, relay)
-		if err != nil {
-			continue
-		}
+// messageID is how an event's own ID is shown: as an nevent with
+// --bech32-event-ids, otherwise as displayID shows it.
+func messageID(e *nostr.Event, opts *options) string {
+	if opts.bech32IDs {
+		return eventBech32(e, opts)
+	}
+	return displayID(e.ID, opts)
+}
 
-		err = rc.Publish(ctx, event)
-		rc.Close()
-		if err == nil {
-			published++
+// eventBech32 encodes e's ID as an nevent, with the relay that delivered it
+// as hint when known.
+func eventBech32(e *nostr.Event, opts *options) string {
+	return encodeEventID(e.ID, opts.eventRelays[e.ID], e.PubKey, "bech32")
+}
+
+// encodeEventID formats an event ID for --event-id-format: bech32 is an
+// nevent with relayURL (if any) as hint, short the first 12 hex characters
+// and anything else the full hex ID.
+func encodeEventID(id, relayURL, pubkey, format string) string {
+	switch format {
+	case "bech32":
+		var hints []string
+		if relayURL != "" {
+			hints = []string{relayURL}
+		}
+		if nevent, err := nip19.EncodeEvent(id, hints, pubkey); err == nil {
+			return nevent
 		}
+	case "short":
+		return id[:min(12, len(id))]
 	}
+	return id
+}
 
-	if published == 0 {
-		return fmt.Errorf("failed to publish to any relay")
+// recordEventRelay remembers relay as the source of id unless another relay
+// delivered it first. It does nothing without --bech32-event-ids.
+func recordEventRelay(opts *options, id, relay string) {
+	if opts.eventRelays == nil {
+		return
 	}
-
-	recipientNpub, _ := nip19.EncodePublicKey(recipientPubkey)
-
-	if opts.jsonOutput {
-		fmt.Printf(`{"success":true,"message_id":"%s","encrypted_to":"%s","relays":%d}`, event.ID, recipientNpub, published)
-	} else {
-		fmt.Printf("✓ DM sent successfully\n")
-		fmt.Printf("  Message ID: %s\n", event.ID)
-		fmt.Printf("  To: %s\n", recipientNpub)
-		fmt.Printf("  Relays: %d\n", published)
+	if _, ok := opts.eventRelays[id]; !ok {
+		opts.eventRelays[id] = relay
 	}
+}
 
-	return nil
+// anonymizePubkey keeps only the first 8 hex characters of pubkey.
+func anonymizePubkey(pubkey string) string {
+	return pubkey[:min(8, len(pubkey))] + "..."
 }
 
-func readMessages(opts *options) error {
-	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
-	defer cancel()
+// printMessage prints a single event in the human-readable format.
+func printMessage(n int, e *nostr.Event, privkey string, opts *options) {
+	fprintMessage(os.Stdout, n, e, privkey, opts)
+}
 
-	privkey, err := resolvePrivateKey(opts.key)
+// fprintMessage is printMessage writing to w.
+func fprintMessage(w io.Writer, n int, e *nostr.Event, privkey string, opts *options) {
+	colors := outputColors(opts)
+	decrypted, err := messageContent(privkey, e)
 	if err != nil {
-		return fmt.Errorf("invalid private key: %w", err)
+		from := formatPubkey(e.PubKey, cmp.Or(opts.pubkeyDisplay, "short"))
+		if opts.anonymizeFrom {
+			from = anonymizePubkey(e.PubKey)
+		}
+		fmt.Fprintf(w, "[%d] From: %s\n", n, paint(colors.Sender, from))
+		fmt.Fprintf(w, "    ID: %s\n", messageID(e, opts))
+		fmt.Fprintf(w, "    Content: %s\n", paint(colors.Error, fmt.Sprintf("(decrypt failed: %v)", err)))
+		fmt.Fprintf(w, "    Raw: %s\n\n", e.Content[:min(50, len(e.Content))]+"...")
+		return
 	}
 
-	pubkey, err := derivePublicKeyFromPrivate(privkey)
-	if err != nil {
-		return fmt.Errorf("invalid key: %w", err)
+	fmt.Fprintf(w, "[%d] From: %s\n", n, paint(colors.Sender, senderDisplay(e.PubKey, opts)))
+	fmt.Fprintf(w, "    ID: %s\n", messageID(e, opts))
+	fmt.Fprintf(w, "    Time: %s\n", paint(colors.Timestamp, formatTimestamp(e.CreatedAt, opts.timeFormat, "2006-01-02 15:04:05")))
+	if e.Kind == nostr.KindReaction {
+		fmt.Fprintf(w, "    Reaction: %s to event %s\n\n", decrypted, displayID(reactionTarget(e), opts))
+		return
 	}
-
-	relays := []string{
-		"wss://relay.damus.io",
-		"wss://relay.nostr.band",
-		"wss://nos.lol",
+	if subject := tagValue(e, "subject"); subject != "" {
+		fmt.Fprintf(w, "    Subject: %s\n", subject)
+	}
+	if labels := eventLabels(e); opts.topic != "" && len(labels) > 0 {
+		fmt.Fprintf(w, "    Topic: %s\n", strings.Join(labels, ", "))
+	}
+	contentType := tagValue(e, "content-type")
+	if opts.verbose && contentType != "" {
+		fmt.Fprintf(w, "    Type: %s\n", contentType)
+	}
+	if language := tagValue(e, "content-language"); opts.verbose && language != "" {
+		fmt.Fprintf(w, "    Language: %s\n", language)
+	}
+	if data, ok := decodeBinaryContent(decrypted, opts); ok {
+		fprintBinary(w, e, data, opts)
+	} else {
+		content, _ := truncateContent(displayContent(decrypted, opts), opts.maxContent)
+		if contentType == "text/markdown" && term.IsTerminal(int(os.Stdout.Fd())) {
+			content = renderMarkdown(content)
+		}
+		fmt.Fprintf(w, "    Content: %s\n", paint(colors.Content, content))
+	}
+	if tagged, ok := verifyContentHash(e, decrypted); tagged {
+		if ok {
+			fmt.Fprintln(w, "    ✓ hash verified")
+		} else {
+			fmt.Fprintln(w, "    "+paint(colors.Error, "✗ hash mismatch"))
+		}
 	}
+	fmt.Fprintln(w)
+}
 
-	if opts.relays != "" {
-		relays = strings.Split(opts.relays, ",")
-		for i := range relays {
-			relays[i] = strings.TrimSpace(relays[i])
+// printTable prints events as an aligned table, fitting the content preview
+// to the terminal width when stdout is a terminal.
+func printTable(events []*nostr.Event, privkey string, opts *options) {
+	preview := 50
+	if fd := int(os.Stdout.Fd()); term.IsTerminal(fd) {
+		if width, _, err := term.GetSize(fd); err == nil {
+			// #, from, time and subject columns take roughly 70 columns.
+			preview = max(20, width-70)
 		}
 	}
 
-	if opts.verbose {
-		fmt.Fprintf(os.Stderr, "[ndm] Using key: %s...\n", privkey[:20])
-		fmt.Fprintf(os.Stderr, "[ndm] Pubkey: %s\n", pubkey)
-		fmt.Fprintf(os.Stderr, "[ndm] Fetching from: %v\n", relays)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tFROM\tTIME\tSUBJECT\tCONTENT")
+	for i, e := range events {
+		from := senderDisplay(e.PubKey, opts)
+		content, err := messageContent(privkey, e)
+		if err != nil {
+			content = "(decrypt failed)"
+		} else {
+			content = displayContent(content, opts)
+		}
+		content = strings.Join(strings.Fields(content), " ")
+		if r := []rune(content); len(r) > preview {
+			content = string(r[:preview-3]) + "..."
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, from,
+			formatTimestamp(e.CreatedAt, opts.timeFormat, "2006-01-02 15:04"),
+			tagValue(e, "subject"), content)
 	}
+	w.Flush()
+}
 
-	filter := nostr.Filter{
-		Kinds: []int{nostr.KindEncryptedDirectMessage},
-		Tags:  nostr.TagMap{"p": []string{pubkey}},
-		Limit: opts.count,
+// withReadTimeout bounds how long a single relay may take to stream its
+// events. The parent ctx still limits the whole operation.
+func withReadTimeout(ctx context.Context, opts *options) (context.Context, context.CancelFunc) {
+	if opts.readTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, opts.readTimeout)
+}
 
+// timeoutStrategies are the values of --relay-timeout-strategy.
+var timeoutStrategies = []string{"first", "all", "majority"}
+
+// fetchEvents queries relays in turn until filter.Limit unique events are
+// collected (no cap when it is 0). An event already delivered by an earlier
+// relay is not counted again.
+func fetchEvents(ctx context.Context, opts *options, relays []string, filter nostr.Filter) []*nostr.Event {
+	seen := make(map[string]struct{})
 	var events []*nostr.Event
 	for _, relay := range relays {
-		rc, err := nostr.RelayConnect(ctx, relay)
+		opts.stats.RelaysTried++
+		began := time.Now()
+		rc, err := connectRelay(ctx, opts, relay)
 		if err != nil {
+			opts.health.record(opts, relay, err)
+			writeRelayStat(opts, "read", relay, began, 0, err)
 			if opts.verbose {
 				fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
 			}
 			continue
 		}
 
-		eventsCh, err := rc.QueryEvents(ctx, filter)
+		readCtx, cancel := withReadTimeout(ctx, opts)
+		eventsCh, err := rc.QueryEvents(readCtx, filter)
+		opts.health.record(opts, relay, err)
 		if err != nil {
+			writeRelayStat(opts, "read", relay, began, 0, err)
+			cancel()
 			rc.Close()
 			continue
 		}
+		opts.stats.RelaysSucceeded++
 
+		received := 0
 		for evt := range eventsCh {
+			received++
+			if _, dup := seen[evt.ID]; dup {
+				continue
+			}
+			seen[evt.ID] = struct{}{}
+			recordEventRelay(opts, evt.ID, relay)
 			events = append(events, evt)
-			if len(events) >= opts.count {
+			if filter.Limit > 0 && len(events) >= filter.Limit {
 				break
 			}
 		}
+		writeRelayStat(opts, "read", relay, began, received, nil)
+		if opts.verbose && errors.Is(readCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "[ndm] Read timeout on %s, moving on\n", relay)
+		}
+		cancel()
 		rc.Close()
-		if len(events) >= opts.count {
+		if filter.Limit > 0 && len(events) >= filter.Limit {
 			break
 		}
 	}
+	return events
+}
+
+// deduplicateEvents drops every event whose ID appeared earlier in events,
+// keeping the order of the rest.
+func deduplicateEvents(events []*nostr.Event) []*nostr.Event {
+	seen := make(map[string]struct{}, len(events))
+	var unique []*nostr.Event
+	for _, e := range events {
+		if _, dup := seen[e.ID]; dup {
+			continue
+		}
+		seen[e.ID] = struct{}{}
+		unique = append(unique, e)
+	}
+	return unique
+}
 
-	if len(events) == 0 {
-		fmt.Println("No messages found")
-		return nil
+// fetchEventsUntilEOSE queries every relay at once and waits until quorum of
+// them have sent EOSE, failed or timed out (or ctx expires), then returns the
+// newest opts.count unique events across those relays. Relays still pending
+// at that point are abandoned.
+func fetchEventsUntilEOSE(ctx context.Context, opts *options, relays []string, filter nostr.Filter, quorum int) []*nostr.Event {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		relay  string
+		events []*nostr.Event
+		ok     bool
+		err    error
+		began  time.Time
 	}
+	results := make(chan result, len(relays))
+	for _, relay := range relays {
+		go func(relay string) {
+			res := result{relay: relay, began: time.Now()}
+			defer func() { results <- res }()
 
-	if opts.jsonOutput {
-		type msg struct {
-			ID        string `json:"id"`
-			From      string `json:"from"`
-			Content   string `json:"content"`
-			CreatedAt int64  `json:"created_at"`
-		}
-		var msgs []msg
-		for _, e := range events {
-			decrypted, _ := decryptMessage(privkey, e.PubKey, e.Content)
-			msgs = append(msgs, msg{
-				ID:        e.ID,
-				From:      e.PubKey,
-				Content:   decrypted,
-				CreatedAt: int64(e.CreatedAt),
-			})
-		}
-		out, _ := json.MarshalIndent(msgs, "", "  ")
-		fmt.Println(string(out))
-	} else {
-		fmt.Printf("Found %d messages:\n\n", len(events))
-		for i, e := range events {
-			decrypted, err := decryptMessage(privkey, e.PubKey, e.Content)
+			rc, err := connectRelay(ctx, opts, relay)
 			if err != nil {
-				fmt.Printf("[%d] From: %s\n", i+1, e.PubKey[:16]+"...")
-				fmt.Printf("    ID: %s\n", e.ID[:16]+"...")
-				fmt.Printf("    Content: (decrypt failed: %v)\n", err)
-				fmt.Printf("    Raw: %s\n\n", e.Content[:min(50, len(e.Content))]+"...")
-			} else {
-				fromNpub, _ := nip19.EncodePublicKey(e.PubKey)
-				fmt.Printf("[%d] From: %s\n", i+1, fromNpub[:20]+"...")
-				fmt.Printf("    ID: %s\n", e.ID[:16]+"...")
-				fmt.Printf("    Time: %s\n", time.Unix(int64(e.CreatedAt), 0).Format("2006-01-02 15:04:05"))
-				fmt.Printf("    Content: %s\n\n", decrypted)
+				res.err = err
+				opts.health.record(opts, relay, err)
+				if opts.verbose {
+					fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
+				}
+				return
+			}
+			defer rc.Close()
+
+			readCtx, cancel := withReadTimeout(ctx, opts)
+			defer cancel()
+			sub, err := rc.Subscribe(readCtx, nostr.Filters{filter})
+			opts.health.record(opts, relay, err)
+			if err != nil {
+				res.err = err
+				return
+			}
+			defer sub.Unsub()
+			res.ok = true
+
+			for {
+				select {
+				case evt, ok := <-sub.Events:
+					if !ok {
+						return
+					}
+					res.events = append(res.events, evt)
+				case <-sub.EndOfStoredEvents:
+					if opts.verbose {
+						fmt.Fprintf(os.Stderr, "[ndm] EOSE from %s (%d events)\n", relay, len(res.events))
+					}
+					return
+				case <-readCtx.Done():
+					if opts.verbose {
+						fmt.Fprintf(os.Stderr, "[ndm] Timed out waiting for EOSE from %s\n", relay)
+					}
+					return
+				}
 			}
+		}(relay)
+	}
+
+	seen := make(map[string]struct{})
+	var events []*nostr.Event
+	for range quorum {
+		res := <-results
+		opts.stats.RelaysTried++
+		if res.ok {
+			opts.stats.RelaysSucceeded++
+		}
+		writeRelayStat(opts, "read", res.relay, res.began, len(res.events), res.err)
+		for _, evt := range res.events {
+			if _, dup := seen[evt.ID]; dup {
+				continue
+			}
+			seen[evt.ID] = struct{}{}
+			recordEventRelay(opts, evt.ID, res.relay)
+			events = append(events, evt)
 		}
 	}
+	if opts.verbose && quorum < len(relays) {
+		fmt.Fprintf(os.Stderr, "[ndm] %d of %d relays answered, not waiting for the rest\n", quorum, len(relays))
+	}
 
-	return nil
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt > events[j].CreatedAt
+	})
+	if len(events) > opts.count {
+		events = events[:opts.count]
+	}
+	return events
+}
+
+// loadEvents reads events from a file holding either a JSON array of events
+// or one event object per line (JSONL).
+func loadEvents(path string) ([]*nostr.Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(data)
+}
+
+// parseEvents decodes a JSON array of events or JSONL.
+func parseEvents(data []byte) ([]*nostr.Event, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var events []*nostr.Event
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, fmt.Errorf("invalid event array: %w", err)
+		}
+		return events, nil
+	}
+
+	var events []*nostr.Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var evt nostr.Event
+		if err := json.Unmarshal(text, &evt); err != nil {
+			return nil, fmt.Errorf("invalid event on line %d: %w", line, err)
+		}
+		events = append(events, &evt)
+	}
+	return events, scanner.Err()
+}
+
+// readStdinEvents reads events for --from-stdin-json, as a JSON array or
+// the JSONL written by export, and treats them like a relay reply: events
+// before filter.Since are dropped, duplicates removed, and the newest count
+// returned.
+func readStdinEvents(r io.Reader, filter nostr.Filter, count int) ([]*nostr.Event, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stdin: %w", err)
+	}
+	all, err := parseEvents(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid events on stdin: %w", err)
+	}
+
+	all = slices.DeleteFunc(all, func(e *nostr.Event) bool { return e == nil })
+	var events []*nostr.Event
+	for _, evt := range deduplicateEvents(all) {
+		if filter.Since != nil && evt.CreatedAt < *filter.Since {
+			continue
+		}
+		events = append(events, evt)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt > events[j].CreatedAt
+	})
+	if len(events) > count {
+		events = events[:count]
+	}
+	return events, nil
+}
+
+// exitCode maps an error returned by run to the process exit status.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errSignedOnly):
+		return 2
+	default:
+		return 1
+	}
 }
 
 func main() {
 	if err := run(os.Args[1:]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		code := exitCode(err)
+		if code == 1 {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(code)
 	}
 }
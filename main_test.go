@@ -1,10 +1,66 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip44"
 )
 
+func TestMain(m *testing.M) {
+	// Keep sends made by tests out of the real relay scores file.
+	dir, err := os.MkdirTemp("", "ndm-test-data")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_DATA_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it printed.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stdout, fn)
+}
+
+// captureStderr runs fn with os.Stderr redirected and returns what it printed.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stderr, fn)
+}
+
+func captureFile(t *testing.T, f **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *f
+	*f = w
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	defer func() { *f = orig }()
+	fn()
+	w.Close()
+	*f = orig
+	return <-done
+}
+
 func TestParseArgs(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -171,7 +227,7 @@ func TestResolveKey(t *testing.T) {
 func TestDerivePublicKeyFromPrivate(t *testing.T) {
 	// Test with a known private key
 	privkey := "d898fd8d6ba74893a08d7a6a2d244348b55f8b4a0c417574ca19682d1577c0b1"
-	got, err := derivePublicKeyFromPrivate(privkey)
+	got, err := derivePublicKeyFromPrivate(privkey, false)
 	if err != nil {
 		t.Errorf("derivePublicKeyFromPrivate(%q) error = %v", privkey, err)
 	}
@@ -181,7 +237,7 @@ func TestDerivePublicKeyFromPrivate(t *testing.T) {
 	}
 
 	// Test that deriving from same privkey gives same pubkey
-	got2, _ := derivePublicKeyFromPrivate(privkey)
+	got2, _ := derivePublicKeyFromPrivate(privkey, false)
 	if got != got2 {
 		t.Errorf("derivePublicKeyFromPrivate(%q) not deterministic: got %v, want %v", privkey, got2, got)
 	}
@@ -225,3 +281,1706 @@ func TestCountFlag(t *testing.T) {
 		t.Errorf("expected count 5, got %d", opts.count)
 	}
 }
+
+func TestMaxRelays(t *testing.T) {
+	var relays []*mockRelay
+	var urls []string
+	for i := 0; i < 5; i++ {
+		m := newMockRelay(t)
+		relays = append(relays, m)
+		urls = append(urls, m.URL)
+	}
+
+	opts := &options{
+		key:           nostr.GeneratePrivateKey(),
+		recipient:     nostr.GeneratePrivateKey(),
+		message:       "hello",
+		relays:        strings.Join(urls, ","),
+		wait:          5 * time.Second,
+		maxRelays:     3,
+		allowInsecure: true,
+	}
+
+	captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+
+	var attempted int32
+	for _, m := range relays {
+		attempted += m.connections.Load()
+	}
+	if attempted != 3 {
+		t.Errorf("expected 3 relay connections, got %d", attempted)
+	}
+}
+
+func TestSignOnly(t *testing.T) {
+	relay := newMockRelay(t)
+	outFile := filepath.Join(t.TempDir(), "event.json")
+
+	opts, err := parseArgs([]string{
+		"-k", nostr.GeneratePrivateKey(),
+		"-r", nostr.GeneratePrivateKey(),
+		"-m", "hello",
+		"--allow-insecure-relays", "--relays", relay.URL,
+		"--sign-only",
+		"-o", outFile,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var sendErr error
+	captureStdout(t, func() {
+		sendErr = sendMessage(opts)
+	})
+	if code := exitCode(sendErr); code != 2 {
+		t.Errorf("expected exit code 2, got %d (err: %v)", code, sendErr)
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	var evt nostr.Event
+	if err := json.Unmarshal(data, &evt); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if ok, _ := evt.CheckSignature(); !ok {
+		t.Error("expected a validly signed event")
+	}
+
+	if n := relay.connections.Load(); n != 0 {
+		t.Errorf("expected no relay connections, got %d", n)
+	}
+}
+
+func TestSignOnlyMakesNoRelayConnections(t *testing.T) {
+	relay := newMockRelay(t)
+	bobPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	serveNIP05(t, map[string]string{"good.test": bobPub})
+
+	for _, mode := range []string{"--sign-only", "--dry-run"} {
+		opts, err := parseArgs([]string{
+			"-k", nostr.GeneratePrivateKey(), "-r", "bob@good.test", "-m", "hello",
+			"--allow-insecure-relays", "--relays", relay.URL,
+			mode, "--relay-latency-sort", "--verify-nip05",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var sendErr error
+		out := captureStdout(t, func() { sendErr = sendMessage(opts) })
+		if sendErr != nil && !errors.Is(sendErr, errSignedOnly) {
+			t.Fatalf("%s: %v", mode, sendErr)
+		}
+		var evt nostr.Event
+		if err := json.Unmarshal([]byte(out), &evt); err != nil {
+			t.Fatalf("%s: output is not an event: %v\n%s", mode, err, out)
+		}
+	}
+
+	if n := relay.connections.Load(); n != 0 {
+		t.Errorf("expected no relay connections, got %d", n)
+	}
+}
+
+func TestNoSign(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	senderPub, _ := nostr.GetPublicKey(sender)
+	args := []string{"-k", sender, "-r", nostr.GeneratePrivateKey(), "-m", "hello", "--no-sign", "--nip", "4"}
+
+	opts, err := parseArgs(append(args, "--dry-run"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(out), &fields); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	if fields["id"] != "" || fields["sig"] != "" {
+		t.Errorf("expected empty id and sig, got id %v, sig %v", fields["id"], fields["sig"])
+	}
+	if fields["pubkey"] != senderPub || fields["content"] == "" {
+		t.Errorf("expected the template to carry pubkey and content, got %v", fields)
+	}
+
+	if _, err := parseArgs(args); err == nil || !strings.Contains(err.Error(), "--no-sign") {
+		t.Errorf("expected --no-sign without --dry-run to fail, got %v", err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if got := exitCode(nil); got != 0 {
+		t.Errorf("exitCode(nil) = %d, want 0", got)
+	}
+	if got := exitCode(errSignedOnly); got != 2 {
+		t.Errorf("exitCode(errSignedOnly) = %d, want 2", got)
+	}
+	if got := exitCode(errors.New("boom")); got != 1 {
+		t.Errorf("exitCode(other) = %d, want 1", got)
+	}
+}
+
+// newTestDM builds a signed kind-4 DM from senderPriv to recipientPub.
+func newTestDM(t *testing.T, senderPriv, recipientPub, message string) *nostr.Event {
+	t.Helper()
+	key, err := nip44.GenerateConversationKey(recipientPub, senderPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := nip44.Encrypt(message, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt := &nostr.Event{
+		Kind:      nostr.KindEncryptedDirectMessage,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipientPub}},
+		Content:   content,
+	}
+	if err := evt.Sign(senderPriv); err != nil {
+		t.Fatal(err)
+	}
+	return evt
+}
+
+func TestImportEvent(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, sender, recipientPub, "hello from a file")
+
+	relay := newMockRelay(t)
+	path := filepath.Join(t.TempDir(), "events.json")
+	data, _ := json.Marshal([]*nostr.Event{evt})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL, "--import-event", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if !strings.Contains(out, "hello from a file") {
+		t.Errorf("expected decrypted content in output, got:\n%s", out)
+	}
+	if n := relay.connections.Load(); n != 0 {
+		t.Errorf("expected no relay connections, got %d", n)
+	}
+}
+
+func TestLoadEventsJSONL(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	a := newTestDM(t, sender, recipientPub, "one")
+	b := newTestDM(t, sender, recipientPub, "two")
+
+	var buf strings.Builder
+	for _, evt := range []*nostr.Event{a, b} {
+		line, _ := json.Marshal(evt)
+		buf.Write(line)
+		buf.WriteString("\n\n")
+	}
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte(buf.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := loadEvents(path)
+	if err != nil {
+		t.Fatalf("loadEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != a.ID || events[1].ID != b.ID {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestVersionCommand(t *testing.T) {
+	opts, err := parseArgs([]string{"version", "check"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.command != "version" || len(opts.args) != 1 || opts.args[0] != "check" {
+		t.Errorf("unexpected command %q args %v", opts.command, opts.args)
+	}
+	if opts.checkTimeout != 5*time.Second {
+		t.Errorf("expected default check timeout 5s, got %v", opts.checkTimeout)
+	}
+}
+
+func TestBuildDMEventSubject(t *testing.T) {
+	privkey := nostr.GeneratePrivateKey()
+	recipient, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	evt, err := buildDMEvent(&options{message: "hi", subject: "Lunch"}, privkey, recipient)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if got := tagValue(&evt, "subject"); got != "Lunch" {
+		t.Errorf("expected subject tag %q, got %q", "Lunch", got)
+	}
+
+	evt, err = buildDMEvent(&options{message: "hi"}, privkey, recipient)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if tag := evt.Tags.Find("subject"); tag != nil {
+		t.Errorf("expected no subject tag, got %v", tag)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	privkey := nostr.GeneratePrivateKey()
+	recipient, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	evt, err := buildDMEvent(&options{message: "**hi**", contentType: "text/markdown"}, privkey, recipient)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if got := tagValue(&evt, "content-type"); got != "text/markdown" {
+		t.Errorf("expected content-type tag %q, got %q", "text/markdown", got)
+	}
+
+	evt, err = buildDMEvent(&options{message: "hi"}, privkey, recipient)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if tag := evt.Tags.Find("content-type"); tag != nil {
+		t.Errorf("expected no content-type tag, got %v", tag)
+	}
+}
+
+func TestContentLanguage(t *testing.T) {
+	privkey := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	opts, err := parseArgs([]string{"-k", privkey, "-r", recipientPub, "-m", "olá", "--content-language", "pt-BR", "--nip", "4"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	evt, err := buildDMEvent(opts, privkey, recipientPub)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if got := tagValue(&evt, "content-language"); got != "pt-BR" {
+		t.Errorf("expected content-language tag %q, got %q", "pt-BR", got)
+	}
+
+	path := writeEventsFile(t, &evt)
+	opts, err = parseArgs([]string{"read", "-k", recipient, "--import-event", path, "-v"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	var out string
+	captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	})
+	if !strings.Contains(out, "Language: pt-BR") {
+		t.Errorf("expected the language in verbose output, got:\n%s", out)
+	}
+
+	for _, lang := range []string{"fr", "pt-BR", "ast"} {
+		if !languagePattern.MatchString(lang) {
+			t.Errorf("expected %q to be a valid language tag", lang)
+		}
+	}
+	for _, lang := range []string{"not-valid-123", "EN", "en-us", ""} {
+		if languagePattern.MatchString(lang) {
+			t.Errorf("expected %q to be rejected", lang)
+		}
+	}
+}
+
+func TestCustomTags(t *testing.T) {
+	privkey := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	opts, err := parseArgs([]string{"-k", privkey, "-r", recipientPub, "-m", "hi", "--tag", "app=myapp", "--tag", "version=1=beta", "--nip", "4"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	evt, err := buildDMEvent(opts, privkey, recipientPub)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if got := tagValue(&evt, "app"); got != "myapp" {
+		t.Errorf("expected app tag %q, got %q", "myapp", got)
+	}
+	if got := tagValue(&evt, "version"); got != "1=beta" {
+		t.Errorf("expected version tag %q, got %q", "1=beta", got)
+	}
+	if got := tagValue(&evt, "p"); got != recipientPub {
+		t.Errorf("expected the recipient p tag to be kept, got %q", got)
+	}
+
+	for _, spec := range []string{"p=abc", "e=abc", "App=x", "=x", "novalue"} {
+		if _, err := parseCustomTag(spec); err == nil {
+			t.Errorf("expected --tag %s to be rejected", spec)
+		}
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	good, err := buildDMEvent(&options{message: "pay 10 sats", contentHash: true}, sender, recipientPub)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if tagValue(&good, "content-hash") != contentHash("pay 10 sats") {
+		t.Fatalf("expected content-hash tag, got %v", good.Tags)
+	}
+
+	// Swap in a validly encrypted but different message under the original
+	// hash, as a relay rewriting content would.
+	tampered := good
+	tampered.Content = newTestDM(t, sender, recipientPub, "pay 1000 sats").Content
+	if err := tampered.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(evt nostr.Event, format string) string {
+		t.Helper()
+		path := writeEventsFile(t, &evt)
+		opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--output-format", format})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	if out := read(good, "text"); !strings.Contains(out, "✓ hash verified") {
+		t.Errorf("expected hash to verify, got:\n%s", out)
+	}
+	if out := read(tampered, "text"); !strings.Contains(out, "✗ hash mismatch") {
+		t.Errorf("expected hash mismatch, got:\n%s", out)
+	}
+	if out := read(tampered, "json"); !strings.Contains(out, `"hash_verified": false`) {
+		t.Errorf("expected hash_verified false in JSON, got:\n%s", out)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	got := renderMarkdown("a **bold** and *italic* word, 2 * 3")
+	want := "a \x1b[1mbold\x1b[22m and \x1b[3mitalic\x1b[23m word, 2 * 3"
+	if got != want {
+		t.Errorf("renderMarkdown = %q, want %q", got, want)
+	}
+}
+
+// writeEventsFile writes events as a JSON array to a temp file for --import-event.
+func writeEventsFile(t *testing.T, events ...*nostr.Event) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.json")
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOutputFormatTable(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, sender, recipientPub, "table row content")
+	evt.Tags = append(evt.Tags, nostr.Tag{"subject", "Greetings"})
+	if err := evt.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", writeEventsFile(t, evt), "--output-format", "table"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row, got:\n%s", out)
+	}
+	if got := strings.Fields(lines[0]); strings.Join(got, " ") != "# FROM TIME SUBJECT CONTENT" {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	npub, _ := nip19.EncodePublicKey(evt.PubKey)
+	row := strings.Fields(lines[1])
+	if row[0] != "1" || row[1] != npub[:20]+"..." || row[4] != "Greetings" {
+		t.Errorf("unexpected row: %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[1], "table row content") {
+		t.Errorf("expected content preview at end of row: %q", lines[1])
+	}
+	// Columns must line up under the header.
+	if strings.Index(lines[0], "SUBJECT") != strings.Index(lines[1], "Greetings") {
+		t.Errorf("columns are not aligned:\n%s", out)
+	}
+}
+
+func TestOutputFormatInvalid(t *testing.T) {
+	_, err := parseArgs([]string{"read", "-k", "nsec1test", "--output-format", "xml"})
+	if err == nil || !strings.Contains(err.Error(), "invalid output format") {
+		t.Errorf("expected invalid output format error, got %v", err)
+	}
+}
+
+func TestGroupByDay(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	day1 := time.Date(2024, 12, 1, 10, 0, 0, 0, time.Local)
+	var events []*nostr.Event
+	for _, ts := range []time.Time{day1.Add(24 * time.Hour), day1, day1.Add(time.Hour)} {
+		evt := newTestDM(t, sender, recipientPub, "msg")
+		evt.CreatedAt = nostr.Timestamp(ts.Unix())
+		if err := evt.Sign(sender); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, evt)
+	}
+	path := writeEventsFile(t, events...)
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--group-by-day"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if n := strings.Count(out, "--- "); n != 1 {
+		t.Errorf("expected exactly one separator, got %d:\n%s", n, out)
+	}
+	sep := strings.Index(out, "--- 2024-12-02 ---")
+	if sep < 0 || strings.Count(out[:sep], "Content: msg") != 2 || strings.Count(out[sep:], "Content: msg") != 1 {
+		t.Errorf("separator not between the two days:\n%s", out)
+	}
+
+	opts.jsonOutput = true
+	out = captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	var items []map[string]any
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(items) != 4 || items[2]["type"] != "date_separator" || items[2]["date"] != "2024-12-02" {
+		t.Errorf("unexpected JSON output: %v", items)
+	}
+}
+
+func TestOnDecryptError(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	otherPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	bad := newTestDM(t, sender, otherPub, "not for you")
+	bad.Tags = nostr.Tags{{"p", recipientPub}}
+	if err := bad.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+	path := writeEventsFile(t,
+		newTestDM(t, sender, recipientPub, "first"),
+		bad,
+		newTestDM(t, sender, recipientPub, "third"),
+	)
+
+	tests := []struct {
+		mode    string
+		wantErr bool
+		want    string
+		raw     int
+	}{
+		{mode: "skip", want: "Found 2 messages"},
+		{mode: "show-raw", want: "Found 3 messages", raw: 1},
+		{mode: "abort", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--on-decrypt-error", tt.mode})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var readErr error
+			out := captureStdout(t, func() {
+				readErr = readMessages(opts)
+			})
+			if tt.wantErr {
+				if readErr == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if readErr != nil {
+				t.Fatalf("readMessages: %v", readErr)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("expected %q in output:\n%s", tt.want, out)
+			}
+			if n := strings.Count(out, "Raw: "); n != tt.raw {
+				t.Errorf("expected %d raw entries, got %d", tt.raw, n)
+			}
+		})
+	}
+}
+
+func TestTruncateContent(t *testing.T) {
+	// 200 characters where the 51st is a space, so the cut lands on a boundary.
+	message := "x" + strings.Repeat("abcd ", 40)[:199]
+
+	got, truncated := truncateContent(message, 50)
+	if !truncated {
+		t.Fatal("expected truncation")
+	}
+	if n := len([]rune(got)); n != 51 {
+		t.Errorf("expected 51 characters, got %d: %q", n, got)
+	}
+	if !strings.HasSuffix(got, "abcd…") || message[50] != ' ' {
+		t.Errorf("expected cut at a word boundary, got %q", got)
+	}
+
+	// A cut in the middle of a word backs off to the previous space.
+	got, _ = truncateContent("hello wonderful world", 10)
+	if got != "hello…" {
+		t.Errorf("expected %q, got %q", "hello…", got)
+	}
+
+	if got, truncated := truncateContent("short", 50); truncated || got != "short" {
+		t.Errorf("expected short content unchanged, got %q", got)
+	}
+}
+
+func TestMaxContentLengthJSON(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	long := strings.Repeat("word ", 40)
+	path := writeEventsFile(t, newTestDM(t, sender, recipientPub, long))
+
+	for _, noFull := range []bool{false, true} {
+		args := []string{"read", "-k", recipient, "--import-event", path, "--max-content-length", "50", "--json"}
+		if noFull {
+			args = append(args, "--no-full-content")
+		}
+		opts, err := parseArgs(args)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+		var msgs []jsonMessage
+		if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if len(msgs) != 1 || !msgs[0].Truncated {
+			t.Fatalf("expected one truncated message, got %+v", msgs)
+		}
+		if noFull && msgs[0].Full != "" {
+			t.Error("expected full_content to be omitted")
+		}
+		if !noFull && msgs[0].Full != long {
+			t.Errorf("expected full_content %q, got %q", long, msgs[0].Full)
+		}
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, sender, recipientPub, "hi")
+	path := writeEventsFile(t, evt)
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--timestamp-format", "unix"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	want := fmt.Sprintf("    Time: %d\n", evt.CreatedAt)
+	if !strings.Contains(out, want) {
+		t.Errorf("expected %q in output:\n%s", want, out)
+	}
+
+	past := nostr.Timestamp(time.Now().Add(-90 * time.Second).Unix())
+	if got := formatTimestamp(past, "relative", ""); got != "1 minute ago" {
+		t.Errorf("relative = %q, want %q", got, "1 minute ago")
+	}
+	if got := formatTimestamp(0, "rfc3339", ""); got != time.Unix(0, 0).Format(time.RFC3339) {
+		t.Errorf("rfc3339 = %q", got)
+	}
+	if got := formatTimestamp(0, "2006", ""); got != time.Unix(0, 0).Format("2006") {
+		t.Errorf("custom layout = %q", got)
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{30 * time.Second, "30 seconds ago"},
+		{90 * time.Second, "1 minute ago"},
+		{3 * time.Hour, "3 hours ago"},
+		{49 * time.Hour, "2 days ago"},
+	}
+	for _, tt := range tests {
+		if got := relativeTime(tt.d); got != tt.want {
+			t.Errorf("relativeTime(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestRandomDelay(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d, err := randomDuration(100 * time.Millisecond)
+		if err != nil {
+			t.Fatalf("randomDuration: %v", err)
+		}
+		if d < 0 || d > 100*time.Millisecond {
+			t.Fatalf("delay %v out of range", d)
+		}
+	}
+
+	relay := newMockRelay(t)
+	opts, err := parseArgs([]string{
+		"-k", nostr.GeneratePrivateKey(),
+		"-r", nostr.GeneratePrivateKey(),
+		"-m", "hello",
+		"--allow-insecure-relays", "--relays", relay.URL,
+		"--random-delay", "100",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.randomDelay != 100*time.Millisecond {
+		t.Fatalf("expected 100ms delay, got %v", opts.randomDelay)
+	}
+
+	start := time.Now()
+	captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+	// The mock relay answers immediately, so anything beyond the maximum
+	// delay plus a generous margin means the jitter was not bounded.
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond+time.Second {
+		t.Errorf("send took %v, expected at most ~100ms of delay", elapsed)
+	}
+}
+
+func TestRandomDelayBeforeConnecting(t *testing.T) {
+	bob := nostr.GeneratePrivateKey()
+	bobPub, _ := nostr.GetPublicKey(bob)
+	serveNIP05(t, map[string]string{"good.test": bobPub})
+	profile := &nostr.Event{Kind: nostr.KindProfileMetadata, CreatedAt: nostr.Now(), Content: `{"nip05":"bob@good.test"}`}
+	if err := profile.Sign(bob); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "recipients.txt")
+	if err := os.WriteFile(path, []byte("bob@good.test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, recipient := range [][]string{{"-r", bob}, {"--from-file", path}} {
+		relay := newMockRelay(t, profile)
+		args := append([]string{
+			"send", "-k", nostr.GeneratePrivateKey(), "-m", "hello", "-v",
+			"--allow-insecure-relays", "--relays", relay.URL,
+			"--random-delay", "400", "--relay-latency-sort", "--verify-nip05",
+		}, recipient...)
+		start := time.Now()
+		logs := captureStderr(t, func() {
+			captureStdout(t, func() {
+				if err := run(args); err != nil {
+					t.Fatalf("%v: %v", recipient, err)
+				}
+			})
+		})
+
+		_, after, ok := strings.Cut(logs, "[ndm] Waiting ")
+		delay, err := time.ParseDuration(strings.Fields(after + " ")[0])
+		if !ok || err != nil {
+			t.Fatalf("%v: expected the delay to be logged, got:\n%s", recipient, logs)
+		}
+		if first := relay.FirstConnection(); first.Sub(start) < delay {
+			t.Errorf("%v: first relay connection %v after start, before the %v delay ended", recipient, first.Sub(start), delay)
+		}
+		if len(relay.Published()) != 1 {
+			t.Errorf("%v: expected the message to be published", recipient)
+		}
+	}
+}
+
+func TestTopic(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	var events []*nostr.Event
+	for _, label := range []string{"billing", "support"} {
+		evt, err := buildDMEvent(&options{message: label + " message", label: label}, sender, recipientPub)
+		if err != nil {
+			t.Fatalf("buildDMEvent: %v", err)
+		}
+		events = append(events, &evt)
+	}
+	path := writeEventsFile(t, events...)
+
+	read := func(topic string) string {
+		t.Helper()
+		opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--topic", topic})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	out := read("billing")
+	if !strings.Contains(out, "billing message") || strings.Contains(out, "support message") {
+		t.Errorf("expected only the billing message, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Topic: billing") {
+		t.Errorf("expected a Topic header, got:\n%s", out)
+	}
+
+	out = read("*")
+	if !strings.Contains(out, "Topic: billing") || !strings.Contains(out, "Topic: support") {
+		t.Errorf("expected both topics, got:\n%s", out)
+	}
+
+	if out := read("shipping"); !strings.Contains(out, "No messages found") {
+		t.Errorf("expected no messages, got:\n%s", out)
+	}
+}
+
+func TestWaitForEOSE(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	fast := newMockRelay(t, newTestDM(t, sender, recipientPub, "from the fast relay"))
+	slow := newMockRelay(t, newTestDM(t, sender, recipientPub, "from the slow relay"))
+	slow.delay = 50 * time.Millisecond
+
+	opts, err := parseArgs([]string{
+		"read", "-k", recipient,
+		"--allow-insecure-relays", "--relays", fast.URL + "," + slow.URL,
+		"--wait-for-eose",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	for _, want := range []string{"from the fast relay", "from the slow relay"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestDeduplicateEvents(t *testing.T) {
+	a := &nostr.Event{ID: "a"}
+	b := &nostr.Event{ID: "b"}
+	tests := []struct {
+		name   string
+		events []*nostr.Event
+		want   []string
+	}{
+		{"empty", nil, nil},
+		{"all unique", []*nostr.Event{a, b}, []string{"a", "b"}},
+		{"all duplicates", []*nostr.Event{a, a, {ID: "a"}}, []string{"a"}},
+		{"mixed", []*nostr.Event{b, a, b}, []string{"b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range deduplicateEvents(tt.events) {
+				got = append(got, e.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDeduplicatesAcrossRelays(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	shared := newTestDM(t, sender, recipientPub, "on both relays")
+	first := newMockRelay(t, shared)
+	second := newMockRelay(t, shared, newTestDM(t, sender, recipientPub, "only on the second relay"))
+
+	opts, err := parseArgs([]string{
+		"read", "-k", recipient, "-n", "2",
+		"--allow-insecure-relays", "--relays", first.URL + "," + second.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Found 2 messages") || strings.Count(out, "on both relays") != 1 || !strings.Contains(out, "only on the second relay") {
+		t.Errorf("expected two unique messages, got:\n%s", out)
+	}
+}
+
+func TestRelayTimeoutStrategy(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	fast := newMockRelay(t, newTestDM(t, sender, recipientPub, "from the fast relay"))
+	medium := newMockRelay(t, newTestDM(t, sender, recipientPub, "from the medium relay"))
+	medium.delay = 50 * time.Millisecond
+	slow := newMockRelay(t, newTestDM(t, sender, recipientPub, "from the slow relay"))
+	slow.delay = 2 * time.Second
+
+	opts, err := parseArgs([]string{
+		"read", "-k", recipient,
+		"--allow-insecure-relays", "--relays", fast.URL + "," + medium.URL + "," + slow.URL,
+		"--relay-timeout-strategy", "majority",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected majority to stop before the slow relay answered, took %v", elapsed)
+	}
+	for _, want := range []string{"from the fast relay", "from the medium relay"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "from the slow relay") {
+		t.Errorf("expected the slow relay to be abandoned, got:\n%s", out)
+	}
+	for _, relay := range []*mockRelay{fast, medium, slow} {
+		if relay.connections.Load() == 0 {
+			t.Errorf("expected %s to be contacted", relay.URL)
+		}
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--relay-timeout-strategy", "some"}); err == nil {
+		t.Error("expected an unknown strategy to fail")
+	}
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--wait-for-eose", "--relay-timeout-strategy", "first"}); err == nil {
+		t.Error("expected --wait-for-eose with first to fail")
+	}
+}
+
+func TestEphemeralKey(t *testing.T) {
+	key := nostr.GeneratePrivateKey()
+	identity, _ := nostr.GetPublicKey(key)
+
+	signWithEphemeralKey := func() nostr.Event {
+		t.Helper()
+		opts, err := parseArgs([]string{
+			"-k", key,
+			"-r", nostr.GeneratePrivateKey(),
+			"-m", "hello",
+			"--ephemeral-key",
+			"--dry-run",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var out string
+		stderr := captureStderr(t, func() {
+			out = captureStdout(t, func() {
+				if err := sendMessage(opts); err != nil {
+					t.Fatalf("sendMessage: %v", err)
+				}
+			})
+		})
+		var evt nostr.Event
+		if err := json.Unmarshal([]byte(out), &evt); err != nil {
+			t.Fatalf("dry-run output is not valid JSON: %v", err)
+		}
+		npub, _ := nip19.EncodePublicKey(evt.PubKey)
+		if !strings.Contains(stderr, "cannot reply") || !strings.Contains(stderr, npub) {
+			t.Errorf("expected a warning and the ephemeral pubkey on stderr, got:\n%s", stderr)
+		}
+		return evt
+	}
+
+	first := signWithEphemeralKey()
+	second := signWithEphemeralKey()
+	if first.PubKey == identity {
+		t.Error("expected the event to be signed by an ephemeral key, not -k")
+	}
+	if first.PubKey == second.PubKey {
+		t.Error("expected a new ephemeral key for every send")
+	}
+	if ok, _ := first.CheckSignature(); !ok {
+		t.Error("expected a validly signed event")
+	}
+
+	if _, err := parseArgs([]string{"-r", identity, "-m", "hi", "--ephemeral-key"}); err != nil {
+		t.Errorf("expected -k to be optional with --ephemeral-key, got %v", err)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	silent := newSilentRelay(t)
+	relay := newMockRelay(t, newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "after the silent relay"))
+
+	opts, err := parseArgs([]string{
+		"read", "-k", recipient,
+		"--allow-insecure-relays", "--relays", silent + "," + relay.URL,
+		"--read-timeout", "50",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("read took %v, expected the silent relay to be skipped after ~50ms", elapsed)
+	}
+	if !strings.Contains(out, "after the silent relay") {
+		t.Errorf("expected the second relay's message, got:\n%s", out)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	key := nostr.GeneratePrivateKey()
+	opts, err := parseArgs([]string{"read", "-k", key, "--max-age", "1h"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := time.Now().Unix() - 3600
+	if got := int64(readSince(opts)); got < want-5 || got > want+5 {
+		t.Errorf("readSince = %d, want about %d", got, want)
+	}
+	filter := readFilter(opts, "pubkey")
+	if filter.Since == nil {
+		t.Fatal("expected Since to be set")
+	}
+	// Gift wraps are backdated, so the relay is asked for older events.
+	want -= int64(giftWrapWindow.Seconds())
+	if got := int64(*filter.Since); got < want-5 || got > want+5 {
+		t.Errorf("Since = %d, want about %d", got, want)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", key, "--max-age", "1h", "--since", "1700000000"}); err == nil {
+		t.Error("expected error combining --max-age and --since")
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"24h", 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"7d", 7 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.input)
+		if err != nil {
+			t.Errorf("parseAge(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAge(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "soon", "-1h", "7"} {
+		if _, err := parseAge(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestSince(t *testing.T) {
+	opts, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--since", "2024-01-02T03:04:05Z"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if since := readSince(opts); since != 1704164645 {
+		t.Errorf("unexpected readSince: %d", since)
+	}
+	opts.kind4Only = true
+	filter := readFilter(opts, "pubkey")
+	if filter.Since == nil || int64(*filter.Since) != 1704164645 {
+		t.Errorf("unexpected Since: %v", filter.Since)
+	}
+}
+
+func TestJSONFormatting(t *testing.T) {
+	value := map[string]any{"outer": map[string]int{"inner": 1}}
+	key := nostr.GeneratePrivateKey()
+
+	parse := func(args ...string) *options {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", key}, args...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !opts.jsonOutput {
+			t.Errorf("%v should enable JSON output", args)
+		}
+		return opts
+	}
+
+	out, _ := marshalJSON(value, parse("--format-json-compact"))
+	if strings.Contains(string(out), "\n") || strings.Contains(string(out), " ") {
+		t.Errorf("expected compact JSON, got %q", out)
+	}
+
+	out, _ = marshalJSON(value, parse("--format-json-indent", "4"))
+	want := "{\n    \"outer\": {\n        \"inner\": 1\n    }\n}"
+	if string(out) != want {
+		t.Errorf("indent 4:\n got %q\nwant %q", out, want)
+	}
+
+	pretty, _ := marshalJSON(value, parse("--format-json-pretty"))
+	alias, _ := marshalJSON(value, parse("--json"))
+	if string(pretty) != string(alias) || !strings.Contains(string(pretty), "\n  \"outer\"") {
+		t.Errorf("expected --json to match --format-json-pretty, got %q and %q", alias, pretty)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", key, "--format-json-indent", "-1"}); err == nil {
+		t.Error("expected error for a negative indent")
+	}
+}
+
+func TestAnonymizeFrom(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	senderPub, _ := nostr.GetPublicKey(sender)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	path := writeEventsFile(t, newTestDM(t, sender, recipientPub, "screenshot me"))
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--import-event", path, "--anonymize-from"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	out := read()
+	_, rest, ok := strings.Cut(out, "From: ")
+	if !ok {
+		t.Fatalf("expected a From line, got:\n%s", out)
+	}
+	from, _, _ := strings.Cut(rest, "\n")
+	if len(from) > 11 || from != senderPub[:8]+"..." {
+		t.Errorf("expected From %q, got %q", senderPub[:8]+"...", from)
+	}
+	if strings.Contains(out, "npub1") || strings.Contains(out, senderPub) {
+		t.Errorf("expected no full sender identity in output, got:\n%s", out)
+	}
+
+	var msgs []jsonMessage
+	if err := json.Unmarshal([]byte(read("--json")), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(msgs) != 1 || len(msgs[0].From) > 11 || msgs[0].From != senderPub[:8]+"..." {
+		t.Errorf("expected truncated JSON from, got %+v", msgs)
+	}
+}
+
+func TestDerivePublicKey(t *testing.T) {
+	priv := nostr.GeneratePrivateKey()
+	want, err := derivePublicKeyBySigning(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DerivePublicKey(priv)
+	if err != nil {
+		t.Fatalf("DerivePublicKey: %v", err)
+	}
+	if got != want {
+		t.Errorf("DerivePublicKey = %s, want %s", got, want)
+	}
+
+	for _, bad := range []string{"", "abc", strings.Repeat("z", 64)} {
+		if _, err := DerivePublicKey(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	opts, err := parseArgs([]string{"version", "--no-derive-pubkey"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := derivePublicKeyFromPrivate(priv, opts.directDerive); got != want || !opts.directDerive {
+		t.Errorf("expected --no-derive-pubkey to derive %s directly, got %s", want, got)
+	}
+	if opts, _ := parseArgs([]string{"version"}); opts.directDerive {
+		t.Error("expected --no-derive-pubkey not to carry over to later parses")
+	}
+}
+
+func BenchmarkDerivePublicKey(b *testing.B) {
+	priv := nostr.GeneratePrivateKey()
+	for b.Loop() {
+		if _, err := DerivePublicKey(priv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDerivePublicKeyBySigning(b *testing.B) {
+	priv := nostr.GeneratePrivateKey()
+	for b.Loop() {
+		if _, err := derivePublicKeyBySigning(priv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEventKind(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	note := &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipientPub}},
+		Content:   "a public mention",
+	}
+	if err := note.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t, note, newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "a private dm"))
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL, "--event-kind", "1", "-v"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out string
+	stderr := captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	})
+
+	if !strings.Contains(out, "Content: a public mention") {
+		t.Errorf("expected the note content as-is, got:\n%s", out)
+	}
+	if strings.Contains(out, "a private dm") || strings.Contains(out, "decrypt failed") {
+		t.Errorf("expected only the kind 1 note without decryption, got:\n%s", out)
+	}
+	if !strings.Contains(stderr, "not a DM kind") {
+		t.Errorf("expected a verbose warning about the kind, got:\n%s", stderr)
+	}
+	if opts.stats.EventsFailed != 0 {
+		t.Errorf("expected no decryption failures, got %d", opts.stats.EventsFailed)
+	}
+}
+
+func TestOmitFields(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	path := writeEventsFile(t, newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "trim me"))
+
+	read := func(extra ...string) []map[string]any {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--import-event", path, "--json"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+		var msgs []map[string]any
+		if err := json.Unmarshal([]byte(out), &msgs); err != nil || len(msgs) != 1 {
+			t.Fatalf("expected one JSON message, got %q (%v)", out, err)
+		}
+		return msgs
+	}
+
+	full := read()[0]
+	if _, ok := full["raw_event"]; !ok || full["signature_valid"] != true {
+		t.Fatalf("expected raw_event and a valid signature by default, got %v", full)
+	}
+
+	trimmed := read("--omit-fields", "raw_event")[0]
+	if _, ok := trimmed["raw_event"]; ok {
+		t.Errorf("expected raw_event to be omitted, got %v", trimmed)
+	}
+	for _, key := range []string{"id", "from", "created_at", "content", "signature_valid"} {
+		if _, ok := trimmed[key]; !ok {
+			t.Errorf("expected %s to remain, got %v", key, trimmed)
+		}
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--omit-fields", "id,bogus"}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestTruncateID(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "short ids")
+	path := writeEventsFile(t, evt)
+
+	idLine := func(n string) string {
+		t.Helper()
+		opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--truncate-id", n})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+		_, rest, ok := strings.Cut(out, "ID: ")
+		if !ok {
+			t.Fatalf("expected an ID line, got:\n%s", out)
+		}
+		line, _, _ := strings.Cut(rest, "\n")
+		return line
+	}
+
+	if got := idLine("8"); got != evt.ID[:8]+"..." {
+		t.Errorf("--truncate-id 8: got %q", got)
+	}
+	if got := idLine("0"); got != evt.ID {
+		t.Errorf("--truncate-id 0: got %q, want the full ID", got)
+	}
+	if got := idLine("64"); got != evt.ID {
+		t.Errorf("--truncate-id 64: got %q, want the full ID", got)
+	}
+}
+
+func TestIncludeReaction(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	noteID := strings.Repeat("ab", 32)
+
+	reaction := &nostr.Event{
+		Kind:      nostr.KindReaction,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"e", noteID}, {"p", recipientPub}},
+		Content:   "🤙",
+	}
+	if err := reaction.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t, reaction, newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "just a dm"))
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	if out := read(); strings.Contains(out, "Reaction:") {
+		t.Errorf("expected no reactions without --include-reaction, got:\n%s", out)
+	}
+
+	out := read("--include-reaction")
+	if !strings.Contains(out, "Content: just a dm") || !strings.Contains(out, "Reaction: 🤙 to event "+noteID[:16]+"...") {
+		t.Errorf("expected the DM and the reaction, got:\n%s", out)
+	}
+
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(read("--include-reaction", "--json")), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	types := map[any]int{}
+	for _, m := range msgs {
+		types[m["type"]]++
+		if m["type"] == "reaction" && (m["reacted_to"] != noteID || m["content"] != "🤙") {
+			t.Errorf("unexpected reaction object: %v", m)
+		}
+	}
+	if len(msgs) != 2 || types["reaction"] != 1 || types[nil] != 1 {
+		t.Errorf("expected one DM and one reaction, got %v", msgs)
+	}
+}
+
+func TestBech32EventIDs(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "hello")
+	relay := newMockRelay(t, evt)
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL, "--bech32-event-ids"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+	checkNevent := func(nevent string) {
+		t.Helper()
+		prefix, data, err := nip19.Decode(nevent)
+		if err != nil || prefix != "nevent" {
+			t.Fatalf("expected an nevent, got %q (%v)", nevent, err)
+		}
+		ptr := data.(nostr.EventPointer)
+		if ptr.ID != evt.ID || len(ptr.Relays) != 1 || !strings.Contains(ptr.Relays[0], strings.TrimPrefix(relay.URL, "ws://")) {
+			t.Errorf("expected event %s with hint %s, got %+v", evt.ID, relay.URL, ptr)
+		}
+	}
+
+	out := read()
+	_, after, ok := strings.Cut(out, "ID: ")
+	if !ok {
+		t.Fatalf("expected an ID line, got:\n%s", out)
+	}
+	checkNevent(strings.Fields(after)[0])
+
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(read("--json")), &msgs); err != nil || len(msgs) != 1 {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if msgs[0]["id"] != evt.ID {
+		t.Errorf("expected hex id to be kept, got %v", msgs[0]["id"])
+	}
+	checkNevent(msgs[0]["event_id_bech32"].(string))
+}
+
+func TestPubkeyDisplay(t *testing.T) {
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(pubkey)
+
+	if got := formatPubkey(pubkey, "short"); got != pubkey[:16]+"..." {
+		t.Errorf("short: got %q", got)
+	}
+	if got := formatPubkey(pubkey, "full"); got != pubkey || len(got) != 64 {
+		t.Errorf("full: got %q", got)
+	}
+	if got := formatPubkey(pubkey, "npub"); got != npub || !strings.HasPrefix(got, "npub1") {
+		t.Errorf("npub: got %q", got)
+	}
+	if got := formatPubkey(pubkey, ""); got != npub[:20]+"..." {
+		t.Errorf("default: got %q", got)
+	}
+
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	sender := nostr.GeneratePrivateKey()
+	senderPub, _ := nostr.GetPublicKey(sender)
+	path := writeEventsFile(t, newTestDM(t, sender, recipientPub, "hi"))
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--pubkey-display", "full"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if !strings.Contains(out, "From: "+senderPub+"\n") {
+		t.Errorf("expected the full sender pubkey, got:\n%s", out)
+	}
+
+	relay := newMockRelay(t)
+	opts, err = parseArgs([]string{"-k", sender, "-r", recipient, "-m", "hi", "--allow-insecure-relays", "--relays", relay.URL, "--pubkey-display", "short"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	out = captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+	if !strings.Contains(out, "To: "+recipientPub[:16]+"...\n") {
+		t.Errorf("expected a short recipient pubkey, got:\n%s", out)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--pubkey-display", "long"}); err == nil {
+		t.Error("expected error for unknown --pubkey-display mode")
+	}
+}
+
+func TestEventIDFormat(t *testing.T) {
+	id := strings.Repeat("ab", 32)
+	pubkey := strings.Repeat("cd", 32)
+
+	if got := encodeEventID(id, "", pubkey, "hex"); got != id {
+		t.Errorf("hex: got %q", got)
+	}
+	if got := encodeEventID(id, "", pubkey, "short"); got != id[:12] {
+		t.Errorf("short: got %q", got)
+	}
+	got := encodeEventID(id, "wss://relay.example.com", pubkey, "bech32")
+	if !strings.HasPrefix(got, "nevent1") {
+		t.Fatalf("bech32: got %q", got)
+	}
+	_, data, err := nip19.Decode(got)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", got, err)
+	}
+	if ptr := data.(nostr.EventPointer); ptr.ID != id || len(ptr.Relays) != 1 || ptr.Relays[0] != "wss://relay.example.com" {
+		t.Errorf("bech32: unexpected pointer %+v", ptr)
+	}
+
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "hi")
+	path := writeEventsFile(t, evt)
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--json", "--event-id-format", "short"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil || len(msgs) != 1 {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if msgs[0]["id"] != evt.ID[:12] {
+		t.Errorf("expected a short id, got %v", msgs[0]["id"])
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--event-id-format", "base64"}); err == nil {
+		t.Error("expected error for unknown --event-id-format")
+	}
+}
+
+func TestDecryptWithKey(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	keyA := nostr.GeneratePrivateKey()
+	keyB := nostr.GeneratePrivateKey()
+	pubA, _ := nostr.GetPublicKey(keyA)
+	pubB, _ := nostr.GetPublicKey(keyB)
+
+	// Encrypted to A but delivered to B's inbox.
+	evt := newTestDM(t, sender, pubA, "for the agent")
+	evt.Tags = nostr.Tags{{"p", pubB}}
+	if err := evt.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t, evt)
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", keyB, "--allow-insecure-relays", "--relays", relay.URL}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	nsecA, _ := nip19.EncodePrivateKey(keyA)
+	if out := read("--decrypt-with-key", nsecA); !strings.Contains(out, "Content: for the agent") {
+		t.Errorf("expected the message decrypted with key A, got:\n%s", out)
+	}
+	if out := read(); !strings.Contains(out, "decrypt failed") {
+		t.Errorf("expected key B alone to fail decryption, got:\n%s", out)
+	}
+}
+
+func TestRequirePTagMatch(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	otherPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	stray := newTestDM(t, sender, recipientPub, "not addressed to you")
+	stray.Tags = nostr.Tags{{"p", otherPub}}
+	if err := stray.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+	path := writeEventsFile(t, newTestDM(t, sender, recipientPub, "addressed to you"), stray)
+
+	read := func(extra ...string) (string, string) {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--import-event", path}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var out string
+		stderr := captureStderr(t, func() {
+			out = captureStdout(t, func() {
+				if err := readMessages(opts); err != nil {
+					t.Fatalf("readMessages: %v", err)
+				}
+			})
+		})
+		return out, stderr
+	}
+
+	out, stderr := read("--require-p-tag-match", "-v")
+	if !strings.Contains(out, "addressed to you") || strings.Contains(out, "not addressed") || strings.Contains(out, stray.ID[:16]) {
+		t.Errorf("expected only the correctly tagged event, got:\n%s", out)
+	}
+	if !strings.Contains(stderr, "Dropping event "+stray.ID) {
+		t.Errorf("expected a verbose log for the dropped event, got:\n%s", stderr)
+	}
+
+	if out, _ := read(); !strings.Contains(out, stray.ID[:16]) {
+		t.Errorf("expected the stray event without the flag, got:\n%s", out)
+	}
+}
+
+func TestReadKindOnly(t *testing.T) {
+	key := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(key)
+	for flag, want := range map[string]int{
+		"--read-kind4-only":    nostr.KindEncryptedDirectMessage,
+		"--read-kind1059-only": nostr.KindGiftWrap,
+	} {
+		opts, err := parseArgs([]string{"read", "-k", key, flag})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", flag, err)
+		}
+		if kinds := readFilter(opts, pub).Kinds; len(kinds) != 1 || kinds[0] != want {
+			t.Errorf("%s: Kinds = %v, want [%d]", flag, kinds, want)
+		}
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", key, "--read-kind4-only", "--read-kind1059-only"}); err == nil {
+		t.Error("expected the two flags together to be rejected")
+	}
+}
+
+func TestFromStdinJSON(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	first := newTestDM(t, sender, recipientPub, "first from stdin")
+	second := newTestDM(t, sender, recipientPub, "second from stdin")
+
+	read := func(events []*nostr.Event, extra ...string) string {
+		t.Helper()
+		data, err := json.Marshal(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			w.Write(data)
+			w.Close()
+		}()
+		stdin := os.Stdin
+		os.Stdin = r
+		defer func() { os.Stdin = stdin }()
+
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--from-stdin-json"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	out := read([]*nostr.Event{first, second, first})
+	for _, msg := range []string{"first from stdin", "second from stdin"} {
+		if n := strings.Count(out, msg); n != 1 {
+			t.Errorf("expected %q once, got %d times:\n%s", msg, n, out)
+		}
+	}
+
+	if out := read([]*nostr.Event{first, second}, "--json", "-n", "1"); strings.Count(out, "from stdin") != 1 {
+		t.Errorf("expected --count to apply, got:\n%s", out)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "regexp"
+
+var (
+	markdownBold   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	markdownItalic = regexp.MustCompile(`\*([^*\n]+)\*`)
+)
+
+// renderMarkdown turns **bold** and *italic* into ANSI styles. It is only
+// meant for terminals and leaves all other Markdown as is.
+func renderMarkdown(s string) string {
+	s = markdownBold.ReplaceAllString(s, "\x1b[1m$1\x1b[22m")
+	return markdownItalic.ReplaceAllString(s, "\x1b[3m$1\x1b[23m")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// mentionPattern matches NIP-21 URIs for profiles and events.
+var mentionPattern = regexp.MustCompile(`nostr:(?:npub|nprofile|note|nevent)1[02-9ac-hj-np-z]+`)
+
+// mention is a nostr: URI found in a message, for --parse-mentions.
+type mention struct {
+	URI     string `json:"uri" desc:"The nostr: URI as written in the message"`
+	Type    string `json:"type" desc:"profile or event"`
+	Pubkey  string `json:"pubkey,omitempty" desc:"Hex pubkey of a profile mention"`
+	NIP05   string `json:"nip05,omitempty" desc:"NIP-05 identifier from the profile's kind 0, when it has one"`
+	EventID string `json:"event_id,omitempty" desc:"Hex ID of an event mention"`
+	Display string `json:"display" desc:"What the URI is replaced with in content"`
+}
+
+// parseMention decodes a nostr: URI. ok is false for URIs that do not
+// decode, which are left alone.
+func parseMention(uri string, opts *options) (m mention, ok bool) {
+	prefix, value, err := nip19.Decode(uri[len("nostr:"):])
+	if err != nil {
+		return m, false
+	}
+	m.URI = uri
+	switch v := value.(type) {
+	case string:
+		if prefix == "npub" {
+			m.Type, m.Pubkey = "profile", v
+		} else {
+			m.Type, m.EventID = "event", v
+		}
+	case nostr.ProfilePointer:
+		m.Type, m.Pubkey = "profile", v.PublicKey
+	case nostr.EventPointer:
+		m.Type, m.EventID = "event", v.ID
+	default:
+		return m, false
+	}
+
+	m.Display = uri
+	if m.Type == "event" {
+		m.Display = "<event " + m.EventID[:12] + "...>"
+	} else if name := opts.nip05Names[m.Pubkey]; name != "" {
+		m.NIP05 = name
+		m.Display = "@" + name
+	}
+	return m, true
+}
+
+// findMentions returns the decodable nostr: URIs in content, in order.
+func findMentions(content string, opts *options) []mention {
+	var mentions []mention
+	for _, uri := range mentionPattern.FindAllString(content, -1) {
+		if m, ok := parseMention(uri, opts); ok {
+			mentions = append(mentions, m)
+		}
+	}
+	return mentions
+}
+
+// replaceMentions swaps each nostr: URI in content for its display form:
+// @<nip05> for profiles that have one, <event abc123...> for events.
+func replaceMentions(content string, opts *options) string {
+	return mentionPattern.ReplaceAllStringFunc(content, func(uri string) string {
+		if m, ok := parseMention(uri, opts); ok {
+			return m.Display
+		}
+		return uri
+	})
+}
+
+// resolveMentions looks up the profiles mentioned in the decrypted events so
+// replaceMentions can show their NIP-05 identifiers.
+func resolveMentions(ctx context.Context, opts *options, relays []string, events []*nostr.Event, privkey string) {
+	var pubkeys []string
+	for _, e := range events {
+		content, err := messageContent(privkey, e)
+		if err != nil {
+			continue
+		}
+		for _, m := range findMentions(content, opts) {
+			if m.Pubkey != "" {
+				pubkeys = append(pubkeys, m.Pubkey)
+			}
+		}
+	}
+	if len(pubkeys) > 0 {
+		lookupNIP05(ctx, opts, relays, pubkeys)
+	}
+}
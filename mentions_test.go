@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestParseMentions(t *testing.T) {
+	alice := nostr.GeneratePrivateKey()
+	alicePub, _ := nostr.GetPublicKey(alice)
+	aliceNpub, _ := nip19.EncodePublicKey(alicePub)
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	profile := &nostr.Event{
+		Kind:      nostr.KindProfileMetadata,
+		CreatedAt: nostr.Now(),
+		Content:   `{"name":"alice","nip05":"alice@example.com"}`,
+	}
+	if err := profile.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	eventID := strings.Repeat("ab", 32)
+	nevent, _ := nip19.EncodeEvent(eventID, nil, "")
+	relay := newMockRelay(t,
+		profile,
+		newTestDM(t, sender, recipientPub, "ask nostr:"+aliceNpub+" about nostr:"+nevent),
+	)
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL, "--parse-mentions"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	out := read()
+	if !strings.Contains(out, "ask @alice@example.com about <event abababababab...>") {
+		t.Errorf("expected mentions to be replaced, got:\n%s", out)
+	}
+
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(read("--json")), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	mentions, _ := msgs[0]["mentions"].([]any)
+	if len(mentions) != 2 {
+		t.Fatalf("expected 2 mentions, got %v", msgs[0]["mentions"])
+	}
+	first, _ := mentions[0].(map[string]any)
+	if first["type"] != "profile" || first["pubkey"] != alicePub || first["nip05"] != "alice@example.com" {
+		t.Errorf("unexpected profile mention: %v", first)
+	}
+	second, _ := mentions[1].(map[string]any)
+	if second["type"] != "event" || second["event_id"] != eventID {
+		t.Errorf("unexpected event mention: %v", second)
+	}
+}
+
+func TestReplaceMentionsUnresolved(t *testing.T) {
+	pub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(pub)
+	in := "hi nostr:" + npub + " and nostr:npub1invalid"
+	if got := replaceMentions(in, &options{}); got != in {
+		t.Errorf("expected unresolved and invalid mentions to be kept, got %q", got)
+	}
+}
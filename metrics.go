@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runStats collects per-invocation counters written by --metrics-file.
+type runStats struct {
+	Timestamp       int64   `json:"timestamp"`
+	Command         string  `json:"command"`
+	DurationMS      int64   `json:"duration_ms"`
+	RelaysTried     int     `json:"relays_tried"`
+	RelaysSucceeded int     `json:"relays_succeeded"`
+	EventsFetched   int     `json:"events_fetched"`
+	EventsDecrypted int     `json:"events_decrypted"`
+	EventsFailed    int     `json:"events_failed"`
+	Error           *string `json:"error"`
+}
+
+// writeMetrics appends the run's stats as one JSON line to --metrics-file.
+// Failures are reported on stderr so they never mask the command's result.
+func writeMetrics(opts *options, command string, start time.Time, runErr error) {
+	if opts.metricsFile == "" {
+		return
+	}
+
+	stats := opts.stats
+	stats.Timestamp = start.Unix()
+	stats.Command = command
+	stats.DurationMS = time.Since(start).Milliseconds()
+	if runErr != nil {
+		msg := runErr.Error()
+		stats.Error = &msg
+	}
+
+	line, err := json.Marshal(stats)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(opts.metricsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Failed to write metrics: %v\n", err)
+	}
+}
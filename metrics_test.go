@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMetricsFile(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	otherPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	bad := newTestDM(t, sender, otherPub, "not for us")
+	bad.Tags = nostr.Tags{{"p", recipientPub}}
+	if err := bad.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+	path := writeEventsFile(t, newTestDM(t, sender, recipientPub, "hello"), bad)
+	metricsFile := filepath.Join(t.TempDir(), "metrics.jsonl")
+
+	for i := 0; i < 2; i++ {
+		opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--metrics-file", metricsFile})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	f, err := os.Open(metricsFile)
+	if err != nil {
+		t.Fatalf("opening metrics file: %v", err)
+	}
+	defer f.Close()
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 appended lines, got %d", len(lines))
+	}
+
+	m := lines[0]
+	want := map[string]any{
+		"command":          "read",
+		"relays_tried":     float64(0),
+		"relays_succeeded": float64(0),
+		"events_fetched":   float64(2),
+		"events_decrypted": float64(1),
+		"events_failed":    float64(1),
+		"error":            nil,
+	}
+	for k, v := range want {
+		got, ok := m[k]
+		if !ok {
+			t.Errorf("missing field %q", k)
+			continue
+		}
+		if got != v {
+			t.Errorf("%s = %v, want %v", k, got, v)
+		}
+	}
+	if ts, _ := m["timestamp"].(float64); ts <= 0 {
+		t.Errorf("expected a timestamp, got %v", m["timestamp"])
+	}
+	if _, ok := m["duration_ms"]; !ok {
+		t.Error("missing duration_ms")
+	}
+}
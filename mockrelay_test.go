@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws "github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// mockRelay is a minimal in-process Nostr relay used by tests. It answers
+// REQ with its stored events followed by EOSE, accepts every EVENT and serves
+// a fixed NIP-11 document.
+type mockRelay struct {
+	server      *httptest.Server
+	URL         string
+	connections atomic.Int32
+	// sent counts the bytes written to clients, including those still
+	// buffered by the network when a client hangs up.
+	sent atomic.Int64
+
+	// delay holds back the stored events answering each REQ.
+	delay time.Duration
+
+	mu          sync.Mutex
+	connectedAt time.Time // of the first websocket connection
+	events      []*nostr.Event
+	published   []*nostr.Event
+	reqs        []nostr.Filters
+	subs        map[*mockSubscription]struct{}
+}
+
+// mockSubscription is a live REQ that receives events passed to Deliver.
+type mockSubscription struct {
+	conn    *ws.Conn
+	id      string
+	filters nostr.Filters
+}
+
+func newMockRelay(t *testing.T, events ...*nostr.Event) *mockRelay {
+	t.Helper()
+	m := &mockRelay{events: events, subs: make(map[*mockSubscription]struct{})}
+	m.server = httptest.NewUnstartedServer(http.HandlerFunc(m.handle))
+	m.server.Listener = countingListener{m.server.Listener, &m.sent}
+	m.server.Start()
+	m.URL = "ws" + strings.TrimPrefix(m.server.URL, "http")
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// countingListener adds up the bytes written to the connections it accepts.
+type countingListener struct {
+	net.Listener
+	sent *atomic.Int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, l.sent}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	sent *atomic.Int64
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.Add(int64(n))
+	return n, err
+}
+
+// newFailingRelay returns the URL of a server that counts and rejects every
+// websocket upgrade.
+func newFailingRelay(t *testing.T, attempts *atomic.Int32) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts != nil {
+			attempts.Add(1)
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// newSilentRelay returns the URL of a relay that accepts connections and
+// subscriptions but never sends anything back.
+func newSilentRelay(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := ws.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		for {
+			if _, _, err := conn.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func (m *mockRelay) Published() []*nostr.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*nostr.Event(nil), m.published...)
+}
+
+// FirstConnection returns when the first websocket connection was made, or
+// the zero time if none was.
+func (m *mockRelay) FirstConnection() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connectedAt
+}
+
+// Requests returns the filters of every REQ received so far.
+func (m *mockRelay) Requests() []nostr.Filters {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]nostr.Filters(nil), m.reqs...)
+}
+
+// Subscriptions returns the number of open subscriptions.
+func (m *mockRelay) Subscriptions() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.subs)
+}
+
+// Deliver stores evt and pushes it to every open subscription it matches.
+func (m *mockRelay) Deliver(evt *nostr.Event) {
+	m.mu.Lock()
+	m.events = append(m.events, evt)
+	subs := make([]*mockSubscription, 0, len(m.subs))
+	for sub := range m.subs {
+		subs = append(subs, sub)
+	}
+	m.mu.Unlock()
+
+	for _, sub := range subs {
+		if !sub.filters.Match(evt) {
+			continue
+		}
+		out, _ := nostr.EventEnvelope{SubscriptionID: &sub.id, Event: *evt}.MarshalJSON()
+		sub.conn.Write(context.Background(), ws.MessageText, out)
+	}
+}
+
+// Drop closes every connection with an open subscription, like a relay
+// going away.
+func (m *mockRelay) Drop() {
+	m.mu.Lock()
+	conns := make(map[*ws.Conn]bool)
+	for sub := range m.subs {
+		conns[sub.conn] = true
+	}
+	m.mu.Unlock()
+	for conn := range conns {
+		conn.CloseNow()
+	}
+}
+
+func (m *mockRelay) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Accept") == "application/nostr+json" {
+		w.Header().Set("Content-Type", "application/nostr+json")
+		w.Write([]byte(`{"name":"mock relay","software":"ndm-mockrelay","version":"1.0","supported_nips":[1,4,11]}`))
+		return
+	}
+	m.connections.Add(1)
+	m.mu.Lock()
+	if m.connectedAt.IsZero() {
+		m.connectedAt = time.Now()
+	}
+	m.mu.Unlock()
+	conn, err := ws.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	open := make(map[string]*mockSubscription)
+	defer func() {
+		m.mu.Lock()
+		for _, sub := range open {
+			delete(m.subs, sub)
+		}
+		m.mu.Unlock()
+	}()
+
+	ctx := context.Background()
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		switch env := nostr.ParseMessage(string(data)).(type) {
+		case *nostr.ReqEnvelope:
+			time.Sleep(m.delay)
+			m.mu.Lock()
+			m.reqs = append(m.reqs, env.Filters)
+			stored := append([]*nostr.Event(nil), m.events...)
+			m.mu.Unlock()
+			for _, evt := range stored {
+				if !env.Filters.Match(evt) {
+					continue
+				}
+				out, _ := nostr.EventEnvelope{SubscriptionID: &env.SubscriptionID, Event: *evt}.MarshalJSON()
+				if err := conn.Write(ctx, ws.MessageText, out); err != nil {
+					return
+				}
+			}
+			out, _ := nostr.EOSEEnvelope(env.SubscriptionID).MarshalJSON()
+			if err := conn.Write(ctx, ws.MessageText, out); err != nil {
+				return
+			}
+			sub := &mockSubscription{conn: conn, id: env.SubscriptionID, filters: env.Filters}
+			m.mu.Lock()
+			open[env.SubscriptionID] = sub
+			m.subs[sub] = struct{}{}
+			m.mu.Unlock()
+		case *nostr.CloseEnvelope:
+			m.mu.Lock()
+			if sub, ok := open[string(*env)]; ok {
+				delete(m.subs, sub)
+				delete(open, string(*env))
+			}
+			m.mu.Unlock()
+		case *nostr.EventEnvelope:
+			evt := env.Event
+			m.mu.Lock()
+			m.published = append(m.published, &evt)
+			m.events = append(m.events, &evt)
+			m.mu.Unlock()
+			out, _ := nostr.OKEnvelope{EventID: evt.ID, OK: true}.MarshalJSON()
+			if err := conn.Write(ctx, ws.MessageText, out); err != nil {
+				return
+			}
+		}
+	}
+}
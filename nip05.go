@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip05"
+)
+
+// resolveNIP05Names looks up the NIP-05 identifier of each event's sender.
+func resolveNIP05Names(ctx context.Context, opts *options, relays []string, events []*nostr.Event) {
+	pubkeys := make([]string, len(events))
+	for i, e := range events {
+		pubkeys[i] = e.PubKey
+	}
+	lookupNIP05(ctx, opts, relays, pubkeys)
+}
+
+// lookupNIP05 looks up the NIP-05 identifier in the kind-0 profile of each
+// pubkey not already in opts.nip05Names. Pubkeys without one are cached as ""
+// so they are only looked up once per run.
+func lookupNIP05(ctx context.Context, opts *options, relays []string, pubkeys []string) {
+	if opts.nip05Names == nil {
+		opts.nip05Names = make(map[string]string)
+	}
+	var authors []string
+	for _, pk := range pubkeys {
+		if _, ok := opts.nip05Names[pk]; !ok {
+			opts.nip05Names[pk] = ""
+			authors = append(authors, pk)
+		}
+	}
+	if len(authors) == 0 {
+		return
+	}
+
+	filter := nostr.Filter{Kinds: []int{nostr.KindProfileMetadata}, Authors: authors}
+	latest := make(map[string]*nostr.Event)
+	for _, relay := range relays {
+		rc, err := connectRelay(ctx, opts, relay)
+		if err != nil {
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
+			}
+			continue
+		}
+		readCtx, cancel := withReadTimeout(ctx, opts)
+		eventsCh, err := rc.QueryEvents(readCtx, filter)
+		if err == nil {
+			for evt := range eventsCh {
+				if prev, ok := latest[evt.PubKey]; !ok || evt.CreatedAt > prev.CreatedAt {
+					latest[evt.PubKey] = evt
+				}
+			}
+		}
+		cancel()
+		rc.Close()
+	}
+
+	for pubkey, evt := range latest {
+		var profile struct {
+			NIP05 string `json:"nip05"`
+		}
+		if err := json.Unmarshal([]byte(evt.Content), &profile); err == nil {
+			opts.nip05Names[pubkey] = profile.NIP05
+		}
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Found profiles for %d of %d pubkeys\n", len(latest), len(authors))
+	}
+}
+
+// verifyRecipientNIP05 checks, for --verify-nip05, that a recipient found
+// through a NIP-05 lookup claims an identifier in their kind-0 profile that
+// resolves back to the same pubkey. With --force a failed check is only a
+// warning.
+func verifyRecipientNIP05(ctx context.Context, opts *options, relays []string, pubkey string) error {
+	lookupNIP05(ctx, opts, relays, []string{pubkey})
+	claimed := opts.nip05Names[pubkey]
+
+	err := checkNIP05(ctx, claimed, pubkey)
+	if err == nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Verified NIP-05 %s for %s\n", claimed, pubkey)
+		}
+		return nil
+	}
+	if opts.force {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	return fmt.Errorf("%w (use --force to send anyway)", err)
+}
+
+// checkNIP05 looks up identifier and compares the pubkey it names to pubkey.
+func checkNIP05(ctx context.Context, identifier, pubkey string) error {
+	if identifier == "" {
+		return fmt.Errorf("recipient %s has no nip05 in their profile", pubkey)
+	}
+	pointer, err := nip05.QueryIdentifier(ctx, identifier)
+	if err != nil {
+		return fmt.Errorf("NIP-05 lookup for %s failed: %w", identifier, err)
+	}
+	if pointer.PublicKey != pubkey {
+		return fmt.Errorf("NIP-05 %s from the recipient's profile resolves to %s, not %s", identifier, pointer.PublicKey, pubkey)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestNIP05From(t *testing.T) {
+	alice := nostr.GeneratePrivateKey()
+	bob := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	profile := &nostr.Event{
+		Kind:      nostr.KindProfileMetadata,
+		CreatedAt: nostr.Now(),
+		Content:   `{"name":"alice","nip05":"alice@example.com"}`,
+	}
+	if err := profile.Sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t,
+		profile,
+		newTestDM(t, alice, recipientPub, "hi from alice"),
+		newTestDM(t, bob, recipientPub, "hi from bob"),
+	)
+
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL, "--nip05-from"}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	out := read()
+	if !strings.Contains(out, "From: alice@example.com") {
+		t.Errorf("expected alice's NIP-05 as sender, got:\n%s", out)
+	}
+	if got := strings.Count(out, "From: npub1"); got != 1 {
+		t.Errorf("expected bob to fall back to an npub, got %d npub senders:\n%s", got, out)
+	}
+
+	var msgs []map[string]any
+	if err := json.Unmarshal([]byte(read("--json")), &msgs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	alicePub, _ := nostr.GetPublicKey(alice)
+	for _, m := range msgs {
+		name, ok := m["from_nip05"]
+		if !ok {
+			t.Fatalf("expected a from_nip05 field, got %v", m)
+		}
+		if m["from"] == alicePub && name != "alice@example.com" {
+			t.Errorf("expected alice@example.com, got %v", name)
+		}
+		if m["from"] != alicePub && name != nil {
+			t.Errorf("expected null for bob, got %v", name)
+		}
+	}
+}
+
+// serveNIP05 answers NIP-05 lookups for each domain in names, which maps a
+// domain to the pubkey its well-known file gives for every name. Requests for
+// other hosts go out as usual.
+func serveNIP05(t *testing.T, names map[string]string) {
+	t.Helper()
+	orig := http.DefaultTransport
+	transport := orig.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	dial := transport.DialContext
+	servers := make(map[string]string)
+	for domain, pubkey := range names {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"names":{%q:%q}}`, r.URL.Query().Get("name"), pubkey)
+		}))
+		t.Cleanup(server.Close)
+		servers[net.JoinHostPort(domain, "443")] = server.Listener.Addr().String()
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if server, ok := servers[addr]; ok {
+			addr = server
+		}
+		return dial(ctx, network, addr)
+	}
+	http.DefaultTransport = transport
+	t.Cleanup(func() { http.DefaultTransport = orig })
+}
+
+func TestVerifyNIP05(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	bob := nostr.GeneratePrivateKey()
+	bobPub, _ := nostr.GetPublicKey(bob)
+	otherPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	serveNIP05(t, map[string]string{"good.test": bobPub, "bad.test": otherPub})
+
+	send := func(claimed string, extra ...string) (*mockRelay, string, error) {
+		t.Helper()
+		profile := &nostr.Event{
+			Kind:      nostr.KindProfileMetadata,
+			CreatedAt: nostr.Now(),
+			Content:   fmt.Sprintf(`{"name":"bob","nip05":%q}`, claimed),
+		}
+		if err := profile.Sign(bob); err != nil {
+			t.Fatal(err)
+		}
+		relay := newMockRelay(t, profile)
+		opts, err := parseArgs(append([]string{
+			"-k", sender, "-r", "bob@good.test", "-m", "hello",
+			"--allow-insecure-relays", "--relays", relay.URL, "--verify-nip05",
+		}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var sendErr error
+		stderr := captureStderr(t, func() {
+			captureStdout(t, func() { sendErr = sendMessage(opts) })
+		})
+		return relay, stderr, sendErr
+	}
+
+	relay, _, err := send("bob@good.test")
+	if err != nil {
+		t.Fatalf("expected a matching NIP-05 to pass, got %v", err)
+	}
+	if published := relay.Published(); len(published) != 1 || published[0].Tags.GetFirst([]string{"p"}).Value() != bobPub {
+		t.Errorf("expected one DM to bob, got %v", published)
+	}
+
+	relay, _, err = send("bob@bad.test")
+	if err == nil || !strings.Contains(err.Error(), "resolves to "+otherPub) {
+		t.Errorf("expected a mismatched NIP-05 to abort, got %v", err)
+	}
+	if n := len(relay.Published()); n != 0 {
+		t.Errorf("expected nothing published after a mismatch, got %d events", n)
+	}
+
+	relay, stderr, err := send("bob@bad.test", "--force")
+	if err != nil {
+		t.Fatalf("expected --force to send anyway, got %v", err)
+	}
+	if !strings.Contains(stderr, "Warning: NIP-05 bob@bad.test") || len(relay.Published()) != 1 {
+		t.Errorf("expected a warning and a published DM with --force, got %q and %d events", stderr, len(relay.Published()))
+	}
+}
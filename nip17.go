@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/nip59"
+)
+
+// giftWrapWindow is how far back NIP-59 gift wraps may be dated. Their
+// created_at is randomized to hide when a message was sent, so watch asks
+// relays for wraps this old and compares the real time inside.
+const giftWrapWindow = 2 * 24 * time.Hour
+
+// setSince sets filter.Since to since, moved back by giftWrapWindow when the
+// filter asks for gift wraps. Use dropBefore once the wraps are opened.
+func setSince(filter *nostr.Filter, since nostr.Timestamp) {
+	if slices.Contains(filter.Kinds, nostr.KindGiftWrap) {
+		since -= nostr.Timestamp(giftWrapWindow.Seconds())
+	}
+	filter.Since = &since
+}
+
+// dropBefore removes events created before since. Opened gift wraps are
+// compared by the real time of their rumor.
+func dropBefore(events []*nostr.Event, since nostr.Timestamp) []*nostr.Event {
+	return slices.DeleteFunc(events, func(e *nostr.Event) bool { return e.CreatedAt < since })
+}
+
+// giftWrapDM builds a NIP-17 direct message: an unsigned kind-14 rumor
+// holding the message and tags, sealed (kind 13) and signed by signer, then
+// gift-wrapped (kind 1059) for the recipient with a one-time key.
+func giftWrapDM(ctx context.Context, opts *options, signer nostr.Keyer, recipientPubkey string, tags nostr.Tags) (nostr.Event, error) {
+	pubkey, err := signer.GetPublicKey(ctx)
+	if err != nil {
+		return nostr.Event{}, fmt.Errorf("failed to get public key: %w", err)
+	}
+	rumor := nostr.Event{
+		Kind:      nostr.KindDirectMessage,
+		PubKey:    pubkey,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   compressPlaintext(opts.message, opts),
+	}
+	rumor.ID = rumor.GetID()
+
+	wrap, err := nip59.GiftWrap(rumor, recipientPubkey,
+		func(plaintext string) (string, error) { return signer.Encrypt(ctx, plaintext, recipientPubkey) },
+		func(seal *nostr.Event) error { return signer.SignEvent(ctx, seal) },
+		nil,
+	)
+	if err != nil {
+		return nostr.Event{}, fmt.Errorf("failed to gift-wrap message: %w", err)
+	}
+	opts.trace.step("Encrypted", "")
+	opts.trace.step("Signed", "id: "+wrap.ID)
+	return wrap, nil
+}
+
+// unwrapGiftWrap opens a kind-1059 gift wrap addressed to privkey and returns
+// the rumor inside, whose pubkey is the real sender and whose content is the
+// plaintext message.
+func unwrapGiftWrap(privkey string, e *nostr.Event) (*nostr.Event, error) {
+	rumor, err := nip59.GiftUnwrap(*e, func(pubkey, ciphertext string) (string, error) {
+		key, err := nip44.GenerateConversationKey(pubkey, privkey)
+		if err != nil {
+			return "", fmt.Errorf("generate key: %w", err)
+		}
+		return nip44.Decrypt(ciphertext, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rumor, nil
+}
+
+// unwrapGiftWraps replaces each gift wrap in events with its rumor. Wraps
+// that cannot be opened are kept, so the usual decrypt error handling
+// reports them.
+func unwrapGiftWraps(events []*nostr.Event, privkey string, opts *options) []*nostr.Event {
+	unwrapped := make([]*nostr.Event, len(events))
+	for i, e := range events {
+		unwrapped[i] = e
+		if e.Kind != nostr.KindGiftWrap {
+			continue
+		}
+		if rumor, ok := openGiftWrap(privkey, e, opts); ok {
+			unwrapped[i] = rumor
+		}
+	}
+	return unwrapped
+}
+
+// openGiftWrap is unwrapGiftWrap for a received event. It remembers the rumor
+// as verified, and on failure logs with -v and reports false.
+func openGiftWrap(privkey string, e *nostr.Event, opts *options) (*nostr.Event, bool) {
+	rumor, err := unwrapGiftWrap(privkey, e)
+	if err != nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Failed to unwrap gift wrap %s: %v\n", e.ID, err)
+		}
+		return nil, false
+	}
+	if opts.unwrapped == nil {
+		opts.unwrapped = make(map[string]bool)
+	}
+	opts.unwrapped[rumor.ID] = true
+	return rumor, true
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestNIP17RoundTrip(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	senderPub, _ := nostr.GetPublicKey(sender)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	relay := newMockRelay(t, newTestDM(t, sender, recipientPub, "an old kind-4 message"))
+
+	opts, err := parseArgs([]string{
+		"-k", sender, "-r", recipient, "-m", "wrapped hello", "--subject", "Lunch",
+		"--allow-insecure-relays", "--relays", relay.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+
+	published := relay.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 published event, got %d", len(published))
+	}
+	wrap := published[0]
+	if wrap.Kind != nostr.KindGiftWrap || wrap.PubKey == senderPub || tagValue(wrap, "p") != recipientPub {
+		t.Errorf("expected a kind-1059 wrap for the recipient from a one-time key, got kind %d from %s", wrap.Kind, wrap.PubKey)
+	}
+	if tagValue(wrap, "subject") != "" || strings.Contains(wrap.Content, "wrapped hello") {
+		t.Error("expected the subject and message to be hidden inside the wrap")
+	}
+
+	rumor, err := unwrapGiftWrap(recipient, wrap)
+	if err != nil {
+		t.Fatalf("unwrapGiftWrap: %v", err)
+	}
+	if rumor.Kind != nostr.KindDirectMessage || rumor.PubKey != senderPub || rumor.Content != "wrapped hello" || tagValue(rumor, "subject") != "Lunch" {
+		t.Errorf("unexpected rumor: %+v", rumor)
+	}
+	if _, err := unwrapGiftWrap(nostr.GeneratePrivateKey(), wrap); err == nil {
+		t.Error("expected another key to fail to unwrap")
+	}
+
+	opts, err = parseArgs([]string{"read", "-k", recipient, "--json", "--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	var msgs []jsonMessage
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	got := map[string]jsonMessage{}
+	for _, m := range msgs {
+		got[m.Content] = m
+	}
+	if m, ok := got["wrapped hello"]; !ok || m.From != senderPub || m.Subject != "Lunch" || !m.SigValid {
+		t.Errorf("expected the unwrapped message from the sender, got %+v", msgs)
+	}
+	if _, ok := got["an old kind-4 message"]; !ok {
+		t.Errorf("expected kind-4 messages to still be read, got %+v", msgs)
+	}
+}
+
+func TestNIP17MaxAge(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	stale := newTestDM(t, sender, recipientPub, "too old")
+	stale.CreatedAt = nostr.Now() - 7200
+	if err := stale.Sign(sender); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t, stale)
+
+	opts, err := parseArgs([]string{"-k", sender, "-r", recipient, "-m", "just sent", "--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+
+	opts, err = parseArgs([]string{"read", "-k", recipient, "--max-age", "1m", "--json", "--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	var msgs []jsonMessage
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	// The wrap is usually dated hours back; the rumor inside is not.
+	if len(msgs) != 1 || msgs[0].Content != "just sent" {
+		t.Errorf("expected only the message just sent, got %+v", msgs)
+	}
+}
+
+// nip17SpecWrap is the gift wrap for the receiver from the NIP-17 example,
+// which sends "Hola, que tal?" from nsec1w8udu59ydjvedgs3yv5qccshcj8k05fh3l60k9x57asjrqdpa00qkmr89m
+// to nsec12ywtkplvyq5t6twdqwwygavp5lm4fhuang89c943nf2z92eez43szvn4dt.
+const nip17SpecWrap = `{"id":"2886780f7349afc1344047524540ee716f7bdc1b64191699855662330bf235d8","pubkey":"8f8a7ec43b77d25799281207e1a47f7a654755055788f7482653f9c9661c6d51","created_at":1703128320,"kind":1059,"tags":[["p","918e2da906df4ccd12c8ac672d8335add131a4cf9d27ce42b3bb3625755f0788"]],"content":"AsqzdlMsG304G8h08bE67dhAR1gFTzTckUUyuvndZ8LrGCvwI4pgC3d6hyAK0Wo9gtkLqSr2rT2RyHlE5wRqbCOlQ8WvJEKwqwIJwT5PO3l2RxvGCHDbd1b1o40ZgIVwwLCfOWJ86I5upXe8K5AgpxYTOM1BD+SbgI5jOMA8tgpRoitJedVSvBZsmwAxXM7o7sbOON4MXHzOqOZpALpS2zgBDXSAaYAsTdEM4qqFeik+zTk3+L6NYuftGidqVluicwSGS2viYWr5OiJ1zrj1ERhYSGLpQnPKrqDaDi7R1KrHGFGyLgkJveY/45y0rv9aVIw9IWF11u53cf2CP7akACel2WvZdl1htEwFu/v9cFXD06fNVZjfx3OssKM/uHPE9XvZttQboAvP5UoK6lv9o3d+0GM4/3zP+yO3C0NExz1ZgFmbGFz703YJzM+zpKCOXaZyzPjADXp8qBBeVc5lmJqiCL4solZpxA1865yPigPAZcc9acSUlg23J1dptFK4n3Tl5HfSHP+oZ/QS/SHWbVFCtq7ZMQSRxLgEitfglTNz9P1CnpMwmW/Y4Gm5zdkv0JrdUVrn2UO9ARdHlPsW5ARgDmzaxnJypkfoHXNfxGGXWRk0sKLbz/ipnaQP/eFJv/ibNuSfqL6E4BnN/tHJSHYEaTQ/PdrA2i9laG3vJti3kAl5Ih87ct0w/tzYfp4SRPhEF1zzue9G/16eJEMzwmhQ5Ec7jJVcVGa4RltqnuF8unUu3iSRTQ+/MNNUkK6Mk+YuaJJs6Fjw6tRHuWi57SdKKv7GGkr0zlBUU2Dyo1MwpAqzsCcCTeQSv+8qt4wLf4uhU9Br7F/L0ZY9bFgh6iLDCdB+4iABXyZwT7Ufn762195hrSHcU4Okt0Zns9EeiBOFxnmpXEslYkYBpXw70GmymQfJlFOfoEp93QKCMS2DAEVeI51dJV1e+6t3pCSsQN69Vg6jUCsm1TMxSs2VX4BRbq562+VffchvW2BB4gMjsvHVUSRl8i5/ZSDlfzSPXcSGALLHBRzy+gn0oXXJ/447VHYZJDL3Ig8+QW5oFMgnWYhuwI5QSLEyflUrfSz+Pdwn/5eyjybXKJftePBD9Q+8NQ8zulU5sqvsMeIx/bBUx0fmOXsS3vjqCXW5IjkmSUV7q54GewZqTQBlcx+90xh/LSUxXex7UwZwRnifvyCbZ+zwNTHNb12chYeNjMV7kAIr3cGQv8vlOMM8ajyaZ5KVy7HpSXQjz4PGT2/nXbL5jKt8Lx0erGXsSsazkdoYDG3U","sig":"a3c6ce632b145c0869423c1afaff4a6d764a9b64dedaf15f170b944ead67227518a72e455567ca1c2a0d187832cecbde7ed478395ec4c95dd3e71749ed66c480"}`
+
+func TestNIP17SpecVector(t *testing.T) {
+	const (
+		recipient    = "nsec12ywtkplvyq5t6twdqwwygavp5lm4fhuang89c943nf2z92eez43szvn4dt"
+		recipientPub = "918e2da906df4ccd12c8ac672d8335add131a4cf9d27ce42b3bb3625755f0788"
+		senderPub    = "44900586091b284416a0c001f677f9c49f7639a55c3f1e2ec130a8e1a7998e1b"
+	)
+	var wrap nostr.Event
+	if err := json.Unmarshal([]byte(nip17SpecWrap), &wrap); err != nil {
+		t.Fatalf("invalid vector: %v", err)
+	}
+
+	privkey, err := resolvePrivateKey(recipient)
+	if err != nil {
+		t.Fatalf("resolvePrivateKey: %v", err)
+	}
+	rumor, err := unwrapGiftWrap(privkey, &wrap)
+	if err != nil {
+		t.Fatalf("unwrapGiftWrap: %v", err)
+	}
+	if rumor.Kind != nostr.KindDirectMessage || rumor.PubKey != senderPub || rumor.Content != "Hola, que tal?" {
+		t.Errorf("unexpected rumor: %+v", rumor)
+	}
+	if len(rumor.Tags) != 1 || tagValue(rumor, "p") != recipientPub {
+		t.Errorf("expected a single p tag for the recipient, got %v", rumor.Tags)
+	}
+	if rumor.ID != "cf4d60706f9681a31c1cd5850779bcabe1578c1ae293296be20748c2e0771749" || rumor.GetID() != rumor.ID {
+		t.Errorf("unexpected rumor id %s", rumor.ID)
+	}
+
+	// The sender's own key cannot open the wrap addressed to the receiver.
+	sender, _ := resolvePrivateKey("nsec1w8udu59ydjvedgs3yv5qccshcj8k05fh3l60k9x57asjrqdpa00qkmr89m")
+	if _, err := unwrapGiftWrap(sender, &wrap); err == nil {
+		t.Error("expected the sender's key to fail to unwrap the receiver's copy")
+	}
+
+	relay := newMockRelay(t, &wrap)
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--json", "--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	var msgs []jsonMessage
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if len(msgs) != 1 || msgs[0].From != senderPub || msgs[0].Content != "Hola, que tal?" {
+		t.Errorf("expected the spec message from the sender, got %+v", msgs)
+	}
+}
+
+func TestNIP4Fallback(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	senderPub, _ := nostr.GetPublicKey(sender)
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	opts, err := parseArgs([]string{"-k", sender, "-r", recipientPub, "-m", "legacy", "--nip", "4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	evt, err := buildDMEvent(opts, sender, recipientPub)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	if evt.Kind != nostr.KindEncryptedDirectMessage || evt.PubKey != senderPub {
+		t.Errorf("expected a kind-4 DM from the sender, got kind %d from %s", evt.Kind, evt.PubKey)
+	}
+
+	for _, bad := range []string{"44", "x"} {
+		if _, err := parseArgs([]string{"-k", sender, "-r", recipientPub, "-m", "hi", "--nip", bad}); err == nil {
+			t.Errorf("expected --nip %s to be rejected", bad)
+		}
+	}
+	if _, err := parseArgs([]string{"-k", sender, "-r", recipientPub, "-m", "hi", "--no-sign", "--dry-run"}); err == nil {
+		t.Error("expected --no-sign to need --nip 4")
+	}
+}
+
+func TestWatchGiftWrap(t *testing.T) {
+	source := newMockRelay(t)
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	wrap := func(message string) *nostr.Event {
+		t.Helper()
+		opts := &options{message: message, nip: 17}
+		evt, err := buildDMEvent(opts, sender, recipientPub)
+		if err != nil {
+			t.Fatalf("buildDMEvent: %v", err)
+		}
+		return &evt
+	}
+
+	opts, err := parseArgs([]string{"watch", "-k", recipient, "--allow-insecure-relays", "--relays", source.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	out := captureStdout(t, func() {
+		go func() { done <- watch(ctx, opts) }()
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+			t.Fatal("watch never subscribed")
+		}
+		source.Deliver(wrap("gift-wrapped while watching"))
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+	})
+	if !strings.Contains(out, "gift-wrapped while watching") {
+		t.Errorf("expected the unwrapped message, got:\n%s", out)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pipeThrough runs command with sh -c, feeding content on stdin, and returns
+// its stdout without the trailing newline.
+func pipeThrough(content, command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(content)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// pipeContent applies --pipe-to, falling back to the original content with a
+// warning when the command fails.
+func pipeContent(content string, opts *options) string {
+	if opts.pipeTo == "" {
+		return content
+	}
+	out, err := pipeThrough(content, opts.pipeTo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Warning: --pipe-to command failed, showing original message: %v\n", err)
+		return content
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestPipeTo(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "shout this")
+	raw := evt.Content
+	path := writeEventsFile(t, evt)
+
+	read := func(command string) (string, string) {
+		t.Helper()
+		opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--pipe-to", command})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var out string
+		stderr := captureStderr(t, func() {
+			out = captureStdout(t, func() {
+				if err := readMessages(opts); err != nil {
+					t.Fatalf("readMessages: %v", err)
+				}
+			})
+		})
+		return out, stderr
+	}
+
+	out, _ := read("tr a-z A-Z")
+	if !strings.Contains(out, "Content: SHOUT THIS") {
+		t.Errorf("expected piped content, got:\n%s", out)
+	}
+
+	out, stderr := read("exit 3")
+	if !strings.Contains(out, "Content: shout this") {
+		t.Errorf("expected original content on failure, got:\n%s", out)
+	}
+	if !strings.Contains(stderr, "Warning") {
+		t.Errorf("expected a warning, got %q", stderr)
+	}
+
+	if evt.Content != raw {
+		t.Error("--pipe-to modified the raw event")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prettyJSONCommand indents every JSON value read from --file or stdin.
+// Relay frames like ["EVENT", <sub-id>, {...}] are unwrapped to their event.
+// Input that is not JSON is written back unchanged and reported as an error.
+func prettyJSONCommand(opts *options) error {
+	var data []byte
+	var err error
+	if opts.inputFile != "" {
+		data, err = os.ReadFile(opts.inputFile)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	out, err := prettyJSON(data, opts.jsonIndent)
+	if err != nil {
+		os.Stdout.Write(data)
+		return fmt.Errorf("input is not JSON: %w", err)
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// prettyJSON indents each JSON value in data by indent spaces (compacting
+// it when indent is 0), keeping key order, one value after another.
+func prettyJSON(data []byte, indent int) ([]byte, error) {
+	var out bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		value = unwrapEventFrame(value)
+		var err error
+		if indent > 0 {
+			err = json.Indent(&out, value, "", strings.Repeat(" ", indent))
+		} else {
+			err = json.Compact(&out, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+	}
+	if out.Len() == 0 {
+		return nil, fmt.Errorf("no JSON value found")
+	}
+	return out.Bytes(), nil
+}
+
+// unwrapEventFrame returns the event object of an ["EVENT", ...] websocket
+// message, or value unchanged when it is anything else.
+func unwrapEventFrame(value json.RawMessage) json.RawMessage {
+	var frame []json.RawMessage
+	if json.Unmarshal(value, &frame) != nil || len(frame) < 2 {
+		return value
+	}
+	var label string
+	if json.Unmarshal(frame[0], &label) != nil || label != "EVENT" {
+		return value
+	}
+	event := bytes.TrimSpace(frame[len(frame)-1])
+	if len(event) == 0 || event[0] != '{' {
+		return value
+	}
+	return event
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestPrettyJSON(t *testing.T) {
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	event := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "hi")
+	compact, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	json.Indent(&want, compact, "", "  ")
+	want.WriteByte('\n')
+
+	path := filepath.Join(t.TempDir(), "frame.json")
+	frame := `["EVENT","sub1",` + string(compact) + "]\n"
+	if err := os.WriteFile(path, []byte(frame), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseArgs([]string{"pretty-json", "--file", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := prettyJSONCommand(opts); err != nil {
+			t.Fatalf("pretty-json: %v", err)
+		}
+	})
+	if out != want.String() {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want.String())
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{`{"b":1,"a":[1,2]}`, "{\n  \"b\": 1,\n  \"a\": [\n    1,\n    2\n  ]\n}\n"},
+		{`["OK","abc",true,""]`, "[\n  \"OK\",\n  \"abc\",\n  true,\n  \"\"\n]\n"},
+		{`["EVENT",{"id":"x"}]` + "\n" + `1`, "{\n  \"id\": \"x\"\n}\n1\n"},
+	}
+	for _, tt := range tests {
+		got, err := prettyJSON([]byte(tt.in), 2)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("prettyJSON(%s) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := prettyJSON([]byte("not json"), 2); err == nil {
+		t.Error("expected non-JSON input to fail")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// eventURI returns a nostr:nevent1... URI for the event with relay as a hint.
+func eventURI(eventID, relay, author string) (string, error) {
+	var relays []string
+	if relay != "" {
+		relays = []string{relay}
+	}
+	nevent, err := nip19.EncodeEvent(eventID, relays, author)
+	if err != nil {
+		return "", err
+	}
+	return "nostr:" + nevent, nil
+}
+
+// printEventQR writes a terminal QR code for the event's nostr: URI, followed
+// by the URI itself.
+func printEventQR(w io.Writer, eventID, relay, author string) error {
+	uri, err := eventURI(eventID, relay, author)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	q, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	fmt.Fprint(w, q.ToSmallString(false))
+	fmt.Fprintln(w, uri)
+	return nil
+}
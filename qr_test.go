@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestShowEventIDQR(t *testing.T) {
+	relay := newMockRelay(t)
+	opts, err := parseArgs([]string{
+		"-k", nostr.GeneratePrivateKey(),
+		"-r", nostr.GeneratePrivateKey(),
+		"-m", "scan me",
+		"--allow-insecure-relays", "--relays", relay.URL,
+		"--show-event-id-qr",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+	if !strings.Contains(out, "█") {
+		t.Errorf("expected QR block characters, got:\n%s", out)
+	}
+
+	i := strings.Index(out, "nostr:nevent1")
+	if i < 0 {
+		t.Fatalf("expected a nostr:nevent URI, got:\n%s", out)
+	}
+	uri := strings.Fields(out[i:])[0]
+	prefix, value, err := nip19.Decode(strings.TrimPrefix(uri, "nostr:"))
+	if err != nil || prefix != "nevent" {
+		t.Fatalf("invalid nevent %q: %v", uri, err)
+	}
+	pointer := value.(nostr.EventPointer)
+	if published := relay.Published(); len(published) != 1 || pointer.ID != published[0].ID {
+		t.Errorf("QR points at %s, not the published event", pointer.ID)
+	}
+	if len(pointer.Relays) != 1 || pointer.Relays[0] != relay.URL {
+		t.Errorf("expected relay hint %s, got %v", relay.URL, pointer.Relays)
+	}
+}
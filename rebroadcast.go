@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// rebroadcastCommand fetches an event by ID from the configured relays and
+// publishes it unchanged to the --to-relays list. The event keeps its
+// original signature, so no key is needed.
+func rebroadcastCommand(opts *options) error {
+	if len(opts.args) != 1 {
+		return fmt.Errorf("usage: ndm rebroadcast <event-id> --to-relays <urls>")
+	}
+	if opts.toRelays == "" {
+		return fmt.Errorf("missing required flag: --to-relays")
+	}
+	id, err := decodeEventID(opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	event, source := fetchEventByID(ctx, opts, relayList(opts), id)
+	if event == nil {
+		return fmt.Errorf("event %s not found on any relay", id)
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Found %s on %s\n", id, source)
+	}
+	// Relays hand us whatever they stored; only pass on what verifies.
+	if err := verifyEvent(event); err != nil {
+		return fmt.Errorf("refusing to rebroadcast event %s: %v", id, err)
+	}
+
+	var targets []string
+	for _, relay := range strings.Split(opts.toRelays, ",") {
+		if relay = strings.TrimSpace(relay); relay != "" {
+			targets = append(targets, normalizeRelayURL(relay))
+		}
+	}
+
+	results := publishVerbatim(ctx, opts, targets, *event)
+	if opts.verbose {
+		for _, res := range results {
+			if res.OK {
+				fmt.Fprintf(os.Stderr, "[ndm] Accepted by %s\n", res.Relay)
+			} else {
+				fmt.Fprintf(os.Stderr, "[ndm] Rejected by %s: %s\n", res.Relay, res.Error)
+			}
+		}
+	}
+
+	accepted := acceptedBy(results)
+	if opts.jsonOutput {
+		out, _ := marshalJSON(results, opts)
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("✓ Rebroadcast %s to %d of %d relays\n", id, accepted, len(targets))
+	}
+	if accepted == 0 {
+		return fmt.Errorf("failed to publish to any relay")
+	}
+	return nil
+}
+
+// decodeEventID accepts an event ID as hex, note or nevent.
+func decodeEventID(s string) (string, error) {
+	if nostr.IsValid32ByteHex(s) {
+		return s, nil
+	}
+	prefix, data, err := nip19.Decode(s)
+	if err == nil {
+		switch prefix {
+		case "note":
+			return data.(string), nil
+		case "nevent":
+			return data.(nostr.EventPointer).ID, nil
+		}
+	}
+	return "", fmt.Errorf("invalid event ID: %s (want hex, note or nevent)", s)
+}
+
+// fetchEventByID asks each relay in turn for the event with id and returns
+// the first copy found along with the relay that had it.
+func fetchEventByID(ctx context.Context, opts *options, relays []string, id string) (*nostr.Event, string) {
+	filter := nostr.Filter{IDs: []string{id}, Limit: 1}
+	for _, relay := range relays {
+		rc, err := connectRelay(ctx, opts, relay)
+		if err != nil {
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
+			}
+			continue
+		}
+		readCtx, cancel := withReadTimeout(ctx, opts)
+		events, err := rc.QuerySync(readCtx, filter)
+		cancel()
+		rc.Close()
+		if err == nil && len(events) > 0 && events[0].ID == id {
+			return events[0], relay
+		}
+	}
+	return nil, ""
+}
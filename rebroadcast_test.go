@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestRebroadcast(t *testing.T) {
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "spread me")
+	source := newMockRelay(t, evt)
+	target := newMockRelay(t)
+
+	note, _ := nip19.EncodeNote(evt.ID)
+	opts, err := parseArgs([]string{"rebroadcast", note, "--allow-insecure-relays", "--relays", source.URL, "--to-relays", target.URL})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := rebroadcastCommand(opts); err != nil {
+			t.Fatalf("rebroadcast: %v", err)
+		}
+	})
+	if !strings.Contains(out, "to 1 of 1 relays") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	published := target.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected the target to receive one event, got %d", len(published))
+	}
+	if got := published[0]; got.ID != evt.ID || got.Sig != evt.Sig || got.Content != evt.Content {
+		t.Errorf("expected the event unchanged, got %+v", got)
+	}
+
+	// A tampered copy fails the check done before republishing.
+	tampered := *evt
+	tampered.Content = "tampered"
+	if err := verifyEvent(&tampered); err == nil {
+		t.Error("expected tampered content to fail verification")
+	}
+	tampered = *evt
+	tampered.Sig = strings.Repeat("0", 128)
+	if err := verifyEvent(&tampered); err == nil {
+		t.Error("expected a bad signature to fail verification")
+	}
+	if err := verifyEvent(evt); err != nil {
+		t.Errorf("expected the original event to verify, got %v", err)
+	}
+}
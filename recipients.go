@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr/nip05"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// readRecipientsFile returns the entries of a --from-file list: one npub,
+// hex pubkey or NIP-05 identifier per line. Blank lines and lines starting
+// with # are skipped.
+func readRecipientsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, scanner.Err()
+}
+
+// resolveRecipient turns a recipient list entry into a hex pubkey. Unlike
+// resolveKey, a bare hex key is taken to be the recipient's public key, since
+// a recipient list never holds private keys.
+func resolveRecipient(ctx context.Context, entry string) (string, error) {
+	if len(entry) == 64 && isHex(entry) {
+		return strings.ToLower(entry), nil
+	}
+	if nip05.IsValidIdentifier(entry) {
+		pointer, err := nip05.QueryIdentifier(ctx, entry)
+		if err != nil {
+			return "", fmt.Errorf("NIP-05 lookup for %s failed: %w", entry, err)
+		}
+		return pointer.PublicKey, nil
+	}
+	return resolveKey(entry)
+}
+
+// sendToRecipients sends opts.message to everyone listed in --from-file plus
+// the -r recipient, if given, as one separate DM per recipient.
+func sendToRecipients(opts *options) error {
+	entries, err := readRecipientsFile(opts.fromFile)
+	if err != nil {
+		return fmt.Errorf("failed to read --from-file: %w", err)
+	}
+	if opts.recipient != "" {
+		entries = append(entries, opts.recipient)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	seen := make(map[string]bool)
+	var recipients []string
+	// NIP-05 entries are passed on as they are, so with --verify-nip05
+	// sendMessage checks them against relays after --random-delay.
+	identifiers := make(map[string]string)
+	for _, entry := range entries {
+		pk, err := resolveRecipient(ctx, entry)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", entry, err)
+		}
+		if seen[pk] {
+			continue
+		}
+		seen[pk] = true
+		recipients = append(recipients, pk)
+		if nip05.IsValidIdentifier(entry) {
+			identifiers[pk] = entry
+		}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients in %s", opts.fromFile)
+	}
+
+	if opts.dryRun {
+		fmt.Printf("Would send to %d recipients:\n", len(recipients))
+		for _, pk := range recipients {
+			npub, _ := nip19.EncodePublicKey(pk)
+			fmt.Printf("  %s\n", npub)
+		}
+		return nil
+	}
+
+	failed := 0
+	for i, pk := range recipients {
+		npub, _ := nip19.EncodePublicKey(pk)
+		fmt.Printf("[%d/%d] Sending to %s\n", i+1, len(recipients), npub)
+
+		send := *opts
+		send.recipient = npub
+		if identifier, ok := identifiers[pk]; ok {
+			send.recipient = identifier
+		}
+		// With --sign-only each send stops after printing its event.
+		if err := sendMessage(&send); err != nil && !errors.Is(err, errSignedOnly) {
+			fmt.Fprintf(os.Stderr, "Failed to send to %s: %v\n", npub, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send to %d of %d recipients", failed, len(recipients))
+	}
+	if opts.signOnly {
+		return errSignedOnly
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestSendFromFile(t *testing.T) {
+	me := nostr.GeneratePrivateKey()
+	alicePub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	bobPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	bobNpub, _ := nip19.EncodePublicKey(bobPub)
+
+	path := filepath.Join(t.TempDir(), "recipients.txt")
+	list := "# team\n" + alicePub + "\n\n" + bobNpub + "\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	relay := newMockRelay(t)
+	send := func(extra ...string) string {
+		t.Helper()
+		args := append([]string{
+			"send", "-k", me, "--from-file", path, "-m", "standup in 5", "--allow-insecure-relays", "--relays", relay.URL,
+		}, extra...)
+		return captureStdout(t, func() {
+			if err := run(args); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+		})
+	}
+
+	out := send("--dry-run")
+	if !strings.Contains(out, "Would send to 2 recipients") || !strings.Contains(out, bobNpub) || len(relay.Published()) != 0 {
+		t.Fatalf("expected a dry run listing 2 recipients, got:\n%s", out)
+	}
+
+	out = send()
+	published := relay.Published()
+	if len(published) != 2 {
+		t.Fatalf("expected one event per recipient, got %d:\n%s", len(published), out)
+	}
+	to := map[string]bool{}
+	for _, e := range published {
+		if e.Kind != nostr.KindGiftWrap || e.Content == "standup in 5" {
+			t.Errorf("expected an encrypted DM, got kind %d %q", e.Kind, e.Content)
+		}
+		to[e.Tags.Find("p")[1]] = true
+	}
+	if !to[alicePub] || !to[bobPub] {
+		t.Errorf("expected DMs to alice and bob, got %v", to)
+	}
+
+	var signErr error
+	stderr := captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			signErr = run([]string{"send", "-k", me, "--from-file", path, "-m", "standup in 5", "--sign-only"})
+		})
+	})
+	if !errors.Is(signErr, errSignedOnly) || strings.Contains(stderr, "Failed") {
+		t.Errorf("expected --sign-only to sign for every recipient without failures, got %v:\n%s", signErr, stderr)
+	}
+	if n := strings.Count(out, `"sig"`); n != 2 {
+		t.Errorf("expected 2 signed events, got %d:\n%s", n, out)
+	}
+}
+
+func TestReadRecipientsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipients.txt")
+	if err := os.WriteFile(path, []byte("# comment\n\n  npub1abc  \nalice@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRecipientsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "npub1abc" || got[1] != "alice@example.com" {
+		t.Errorf("unexpected entries: %q", got)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redaction replaces every match of a pattern in displayed message content.
+type redaction struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// cardRedactions masks 13 to 19 digit card numbers, optionally grouped with
+// spaces or dashes.
+var cardRedactions = []redaction{
+	{regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), "[CARD]"},
+}
+
+// keyRedactions masks private keys and common API token formats.
+var keyRedactions = []redaction{
+	{regexp.MustCompile(`\bnsec1[02-9ac-hj-np-z]{58}\b`), "[KEY]"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`), "[KEY]"},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`), "[KEY]"},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`), "[KEY]"},
+	{regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), "[KEY]"},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), "[KEY]"},
+}
+
+// parseRedaction parses a --redact value of the form <regex>=<replacement>.
+// The split is at the last '=' so patterns may contain one.
+func parseRedaction(spec string) (redaction, error) {
+	i := strings.LastIndex(spec, "=")
+	if i <= 0 {
+		return redaction{}, fmt.Errorf("invalid redaction %q: expected <regex>=<replacement>", spec)
+	}
+	re, err := regexp.Compile(spec[:i])
+	if err != nil {
+		return redaction{}, fmt.Errorf("invalid redaction pattern: %w", err)
+	}
+	return redaction{pattern: re, replacement: spec[i+1:]}, nil
+}
+
+// redact applies every configured redaction to decrypted content. Only what
+// is displayed changes; the relay event is left as is.
+func redact(content string, redactions []redaction) string {
+	for _, r := range redactions {
+		content = r.pattern.ReplaceAllString(content, r.replacement)
+	}
+	return content
+}
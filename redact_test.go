@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRedact(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, sender, recipientPub, "card is 4111-1111-1111-1111 thanks")
+	raw := evt.Content
+	path := writeEventsFile(t, evt)
+
+	for _, format := range []string{"text", "json", "table"} {
+		t.Run(format, func(t *testing.T) {
+			opts, err := parseArgs([]string{
+				"read", "-k", recipient, "--import-event", path,
+				"--output-format", format,
+				"--redact", `\d{4}-\d{4}-\d{4}-\d{4}=[CARD]`,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			out := captureStdout(t, func() {
+				if err := readMessages(opts); err != nil {
+					t.Fatalf("readMessages: %v", err)
+				}
+			})
+			if !strings.Contains(out, "[CARD]") || strings.Contains(out, "4111") {
+				t.Errorf("expected card number to be redacted, got:\n%s", out)
+			}
+		})
+	}
+	if evt.Content != raw {
+		t.Error("redaction modified the raw event")
+	}
+}
+
+func TestRedactShortcuts(t *testing.T) {
+	tests := []struct {
+		name  string
+		flag  string
+		input string
+		want  string
+	}{
+		{"spaced card", "--redact-cards", "pay 4111 1111 1111 1111 now", "pay [CARD] now"},
+		{"short number", "--redact-cards", "call 555-1234", "call 555-1234"},
+		{"nsec", "--redact-keys", "nsec1" + strings.Repeat("q", 58), "[KEY]"},
+		{"api key", "--redact-keys", "token sk-" + strings.Repeat("a", 32), "token [KEY]"},
+		{"github token", "--redact-keys", "ghp_" + strings.Repeat("A", 36), "[KEY]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), tt.flag})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := redact(tt.input, opts.redactions); got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRedactionInvalid(t *testing.T) {
+	for _, spec := range []string{"no-separator", "=[CARD]", "(unclosed=x"} {
+		if _, err := parseRedaction(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/net/proxy"
+)
+
+// defaultResponseLimit is how many bytes of events a relay may send for one
+// query before its connection is closed.
+const defaultResponseLimit = 10 << 20
+
+// torProxyAddr is the SOCKS5 address of the local Tor daemon.
+var torProxyAddr = "127.0.0.1:9050"
+
+// connectRelay opens a connection to relay, routing it through its
+// --relay-proxy, or through Tor when the URL uses the wss+tor:// scheme or
+// points at a .onion host. With --relay-challenge the upgrade request carries
+// a bearer token. The connection is closed once the relay sends more than
+// --relay-response-limit bytes. Plain ws:// relays are refused without
+// --allow-insecure-relays, wherever their URL came from.
+func connectRelay(ctx context.Context, opts *options, relay string) (*nostr.Relay, error) {
+	return connectRelayWithBudget(ctx, opts, relay, newResponseBudget(opts, relay))
+}
+
+// connectRelayWithBudget is connectRelay with the caller's response budget,
+// e.g. one counted per message for a long-running subscription. A nil budget
+// has no limit.
+func connectRelayWithBudget(ctx context.Context, opts *options, relay string, budget *responseBudget) (*nostr.Relay, error) {
+	relay = normalizeRelayURL(strings.TrimSpace(relay))
+	if !opts.allowInsecure && isInsecureRelay(relay) {
+		return nil, fmt.Errorf("relay %s is not encrypted: use wss:// or pass --allow-insecure-relays", relay)
+	}
+	if opts.health.blocked(relay) {
+		return nil, errRelayBlacklisted
+	}
+	viaProxy, proxied := opts.relayProxies[strings.TrimSuffix(relay, "/")]
+	relay, viaTor := torRelayURL(relay)
+	var dial dialFunc
+	if proxied {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Routing %s through proxy %s\n", relay, viaProxy.addr)
+		}
+		dial = viaProxy.dial
+	} else if viaTor {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Routing %s through Tor (%s)\n", relay, torProxyAddr)
+		}
+		dial = dialTor
+	}
+	if opts.connectLimiter != nil {
+		if err := opts.connectLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("waiting for --relay-connect-rate: %w", err)
+		}
+	}
+	var relayOpts []nostr.RelayOption
+	if opts.relayChallenge != "" {
+		relayOpts = append(relayOpts, nostr.WithRequestHeader(http.Header{
+			"Authorization": {"Bearer " + opts.relayChallenge},
+		}))
+	}
+	// The budget counts bytes as the bridge reads them off the socket, so an
+	// oversized message is cut off before it has been read in full.
+	target := relay
+	var bridge *relayBridge
+	if dial != nil || budget != nil {
+		var err error
+		if bridge, err = startRelayBridge(relay, dial, budget); err != nil {
+			return nil, err
+		}
+		defer bridge.Close()
+		target = bridge.URL
+	}
+	rc, err := nostr.RelayConnect(ctx, target, relayOpts...)
+	if err != nil {
+		if dialErr := bridge.dialErr(); dialErr != nil {
+			err = dialErr
+		}
+		return nil, err
+	}
+	// The upgrade response does not count against the limit.
+	budget.reset()
+	opts.connected.add(relay)
+	return rc, nil
+}
+
+// dialFunc dials a relay's host:port, e.g. through a SOCKS5 proxy.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// relayBridge lets go-nostr, which dials relays itself, reach one relay over
+// a dialFunc, with what the relay sends counted against a responseBudget: it
+// forwards the websocket upgrade made to a loopback port to the relay, dialed
+// with its own transport. Closing the bridge stops it from accepting
+// connections; an upgraded connection stays open until either end closes it.
+type relayBridge struct {
+	URL       string
+	ln        net.Listener
+	transport *http.Transport
+
+	mu  sync.Mutex
+	err error
+}
+
+// startRelayBridge starts a bridge to relay. A nil dial connects directly
+// and a nil budget has no limit.
+func startRelayBridge(relay string, dial dialFunc, budget *responseBudget) (*relayBridge, error) {
+	u, err := url.Parse(relay)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay URL %q: %w", relay, err)
+	}
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "ws" {
+			port = "80"
+		}
+	}
+	relayAddr := net.JoinHostPort(u.Hostname(), port)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start relay bridge: %w", err)
+	}
+	// The transport speaks plain HTTP: TLS is set up here instead, so the
+	// budget counts the relay's messages rather than ciphertext.
+	upstream := &url.URL{Scheme: "http", Host: u.Host}
+	b := &relayBridge{ln: ln, transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			conn, err := dial(ctx, network, relayAddr)
+			if err != nil {
+				return nil, err
+			}
+			if u.Scheme == "wss" {
+				tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				conn = tlsConn
+			}
+			return budget.wrap(conn), nil
+		},
+	}}
+	proxy := &httputil.ReverseProxy{
+		Rewrite:   func(r *httputil.ProxyRequest) { r.SetURL(upstream) },
+		Transport: b.transport,
+		ErrorLog:  log.New(io.Discard, "", 0),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			b.mu.Lock()
+			b.err = err
+			b.mu.Unlock()
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	go http.Serve(ln, proxy)
+
+	local := *u
+	local.Scheme, local.Host = "ws", ln.Addr().String()
+	b.URL = local.String()
+	return b, nil
+}
+
+// dialErr returns the error that made the bridge fail to reach the relay,
+// if any. A nil bridge has none.
+func (b *relayBridge) dialErr() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *relayBridge) Close() {
+	b.ln.Close()
+	b.transport.CloseIdleConnections()
+}
+
+// normalizeRelayURL turns http:// and https:// relay URLs into their
+// websocket equivalents.
+func normalizeRelayURL(relay string) string {
+	if rest, ok := strings.CutPrefix(relay, "https://"); ok {
+		return "wss://" + rest
+	}
+	if rest, ok := strings.CutPrefix(relay, "http://"); ok {
+		return "ws://" + rest
+	}
+	return relay
+}
+
+// isInsecureRelay reports whether relay would be reached over a plain ws://
+// connection. Relays reached through Tor are encrypted by Tor itself.
+func isInsecureRelay(relay string) bool {
+	if _, viaTor := torRelayURL(relay); viaTor {
+		return false
+	}
+	return strings.HasPrefix(relay, "ws://")
+}
+
+// torRelayURL rewrites a wss+tor:// or ws+tor:// URL to its plain scheme and
+// reports whether the relay should be reached through Tor.
+func torRelayURL(relay string) (string, bool) {
+	for _, scheme := range []string{"wss", "ws"} {
+		if rest, ok := strings.CutPrefix(relay, scheme+"+tor://"); ok {
+			return scheme + "://" + rest, true
+		}
+	}
+
+	u, err := url.Parse(relay)
+	if err != nil {
+		return relay, false
+	}
+	return relay, strings.HasSuffix(u.Hostname(), ".onion")
+}
+
+// responseBudget enforces --relay-response-limit on one connection: it adds
+// up the bytes read from the relay, or with perMessage the size of each
+// websocket message, and closes the socket once they pass the limit. A nil
+// budget has no limit.
+type responseBudget struct {
+	relay      string
+	limit      int64
+	perMessage bool
+	used       atomic.Int64
+	warn       sync.Once
+}
+
+func newResponseBudget(opts *options, relay string) *responseBudget {
+	if opts.responseLimit <= 0 {
+		return nil
+	}
+	return &responseBudget{relay: relay, limit: opts.responseLimit}
+}
+
+// newMessageBudget is newResponseBudget applied to each message rather than
+// to everything the relay sends.
+func newMessageBudget(opts *options, relay string) *responseBudget {
+	b := newResponseBudget(opts, relay)
+	if b != nil {
+		b.perMessage = true
+	}
+	return b
+}
+
+// spend counts n bytes against the budget and returns how many of them fit,
+// warning the first time some do not.
+func (b *responseBudget) spend(n int64) int64 {
+	used := b.used.Add(n)
+	if used <= b.limit {
+		return n
+	}
+	b.warn.Do(func() {
+		if b.perMessage {
+			fmt.Fprintf(os.Stderr, "[ndm] Warning: relay at %s sent a message over %d bytes (--relay-response-limit), closing the connection\n", b.relay, b.limit)
+		} else {
+			fmt.Fprintf(os.Stderr, "[ndm] Warning: relay at %s sent more than %d bytes (--relay-response-limit), closing the connection\n", b.relay, b.limit)
+		}
+	})
+	return max(0, n-(used-b.limit))
+}
+
+// reset starts counting from zero again.
+func (b *responseBudget) reset() {
+	if b != nil {
+		b.used.Store(0)
+	}
+}
+
+// wrap returns conn with its reads counted against the budget. A nil budget
+// returns conn unchanged.
+func (b *responseBudget) wrap(conn net.Conn) net.Conn {
+	if b == nil {
+		return conn
+	}
+	c := &budgetConn{Conn: conn, budget: b}
+	if b.perMessage {
+		c.frames = &frameMeter{}
+	}
+	return c
+}
+
+// budgetConn is a relay connection whose reads are counted against a
+// responseBudget. Once the budget runs out it passes on what still fit and
+// closes the socket.
+type budgetConn struct {
+	net.Conn
+	budget *responseBudget
+	frames *frameMeter
+	spent  bool
+}
+
+func (c *budgetConn) Read(p []byte) (int, error) {
+	if c.spent {
+		return 0, net.ErrClosed
+	}
+	n, err := c.Conn.Read(p)
+	var fit int
+	if c.frames != nil {
+		fit = c.frames.scan(p[:n], c.budget)
+	} else {
+		fit = int(c.budget.spend(int64(n)))
+	}
+	if fit < n {
+		c.spent = true
+		c.Conn.Close()
+		if fit == 0 {
+			return 0, net.ErrClosed
+		}
+		return fit, nil
+	}
+	return n, err
+}
+
+// frameMeter follows the websocket frames read from a relay, after the
+// upgrade response, and charges each message's length to a budget from its
+// frame headers, before the payload itself has been read.
+type frameMeter struct {
+	upgraded bool
+	head     []byte // a partial upgrade response ending or frame header
+	payload  int64  // payload bytes left in the current frame
+}
+
+// scan reads data and returns how much of it fits the budget: all of it,
+// or up to the end of the header of the first message that does not fit.
+func (m *frameMeter) scan(data []byte, b *responseBudget) int {
+	rest := data
+	for len(rest) > 0 {
+		if !m.upgraded {
+			buf := append(m.head, rest...)
+			end := bytes.Index(buf, []byte("\r\n\r\n"))
+			if end < 0 {
+				m.head = append([]byte(nil), buf[max(0, len(buf)-3):]...)
+				break
+			}
+			m.upgraded, m.head = true, nil
+			rest = buf[end+4:]
+			continue
+		}
+		if m.payload > 0 {
+			n := int64(len(rest))
+			if m.payload < n {
+				n = m.payload
+			}
+			m.payload -= n
+			rest = rest[n:]
+			continue
+		}
+
+		need := 2
+		if len(m.head) >= 2 {
+			need = frameHeaderSize(m.head[1])
+		}
+		n := min(need-len(m.head), len(rest))
+		m.head = append(m.head, rest[:n]...)
+		rest = rest[n:]
+		if len(m.head) < 2 || len(m.head) < frameHeaderSize(m.head[1]) {
+			continue
+		}
+
+		var size int64
+		switch m.head[1] & 0x7f {
+		case 126:
+			size = int64(binary.BigEndian.Uint16(m.head[2:4]))
+		case 127:
+			size = int64(binary.BigEndian.Uint64(m.head[2:10]) & math.MaxInt64)
+		default:
+			size = int64(m.head[1] & 0x7f)
+		}
+		opcode := m.head[0] & 0x0f
+		m.head, m.payload = nil, size
+		if opcode >= 8 {
+			continue // control frames are not part of a message
+		}
+		if opcode != 0 {
+			b.reset() // a new message; 0 continues the last one
+		}
+		if b.spend(size) < size {
+			return len(data) - len(rest)
+		}
+	}
+	return len(data)
+}
+
+// frameHeaderSize returns the length of a websocket frame header from its
+// second byte, which holds the mask bit and the payload length.
+func frameHeaderSize(b byte) int {
+	size := 2
+	switch b & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if b&0x80 != 0 {
+		size += 4 // masking key
+	}
+	return size
+}
+
+// relayProxy is the SOCKS5 proxy a --relay-proxy relay is dialed through.
+type relayProxy struct {
+	addr string
+}
+
+func (p relayProxy) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	return dialProxy(ctx, p.addr, network, addr)
+}
+
+func dialProxy(ctx context.Context, proxyAddr, network, addr string) (net.Conn, error) {
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy at %s: %w", proxyAddr, err)
+	}
+	return conn, nil
+}
+
+// parseRelayProxy splits a --relay-proxy value, <relay-url>=<proxy>, where
+// proxy is a SOCKS5 host:port, optionally written as socks5://host:port.
+func parseRelayProxy(value string) (relay, proxyAddr string, err error) {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", fmt.Errorf("invalid --relay-proxy %q: want <relay-url>=<proxy>", value)
+	}
+	relay, proxyAddr = normalizeRelayURL(value[:i]), value[i+1:]
+	for _, scheme := range []string{"socks5://", "socks5h://"} {
+		proxyAddr = strings.TrimPrefix(proxyAddr, scheme)
+	}
+	if _, _, err := net.SplitHostPort(proxyAddr); err != nil || strings.Contains(proxyAddr, "://") {
+		return "", "", fmt.Errorf("invalid --relay-proxy %q: proxy must be a SOCKS5 host:port", value)
+	}
+	return strings.TrimSuffix(relay, "/"), proxyAddr, nil
+}
+
+func dialTor(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := dialProxy(ctx, torProxyAddr, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("tor %w (is the Tor daemon running?)", err)
+	}
+	return conn, nil
+}
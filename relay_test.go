@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws "github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestTorRelayURL(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		viaTor bool
+	}{
+		{"wss+tor://relay.example.com", "wss://relay.example.com", true},
+		{"ws+tor://relay.example.com:8080/path", "ws://relay.example.com:8080/path", true},
+		{"wss://abcdefghijklmnop.onion", "wss://abcdefghijklmnop.onion", true},
+		{"wss://relay.damus.io", "wss://relay.damus.io", false},
+	}
+	for _, tt := range tests {
+		got, viaTor := torRelayURL(tt.in)
+		if got != tt.want || viaTor != tt.viaTor {
+			t.Errorf("torRelayURL(%q) = %q, %v; want %q, %v", tt.in, got, viaTor, tt.want, tt.viaTor)
+		}
+	}
+}
+
+func TestConnectRelayOnionUsesTor(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	hit := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			hit <- struct{}{}
+			conn.Close()
+		}
+	}()
+
+	orig := torProxyAddr
+	torProxyAddr = ln.Addr().String()
+	t.Cleanup(func() { torProxyAddr = orig })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := connectRelay(ctx, &options{allowInsecure: true}, "ws://ndmtestrelay.onion"); err == nil {
+		t.Fatal("expected the fake proxy to fail the connection")
+	}
+
+	select {
+	case <-hit:
+	case <-time.After(time.Second):
+		t.Error("expected the connection to go through the Tor proxy")
+	}
+
+	// Routing one relay through Tor must not affect later direct
+	// connections to the same host.
+	relay := newMockRelay(t)
+	if _, err := connectRelay(ctx, &options{allowInsecure: true}, strings.Replace(relay.URL, "ws://", "ws+tor://", 1)); err == nil {
+		t.Fatal("expected the fake proxy to fail the connection")
+	}
+	<-hit
+	rc, err := connectRelay(ctx, &options{allowInsecure: true}, relay.URL)
+	if err != nil {
+		t.Fatalf("expected a direct connection after a Tor one, got %v", err)
+	}
+	rc.Close()
+	if len(hit) != 0 {
+		t.Error("expected the direct connection to bypass the Tor proxy")
+	}
+}
+
+func TestConnectRelayInsecure(t *testing.T) {
+	relay := newMockRelay(t)
+	opts, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// However the URL reached connectRelay, e.g. from a config file or a
+	// kind-10002 list, ws:// needs --allow-insecure-relays.
+	httpURL := "http" + strings.TrimPrefix(relay.URL, "ws")
+	for _, url := range []string{relay.URL, httpURL, " " + relay.URL} {
+		if _, err := connectRelay(ctx, opts, url); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+			t.Errorf("%q: expected an insecure relay error, got %v", url, err)
+		}
+	}
+	if n := relay.connections.Load(); n != 0 {
+		t.Errorf("expected no connections to the insecure relay, got %d", n)
+	}
+
+	opts.allowInsecure = true
+	rc, err := connectRelay(ctx, opts, httpURL)
+	if err != nil {
+		t.Fatalf("expected an http:// URL to connect as ws:// with --allow-insecure-relays, got %v", err)
+	}
+	rc.Close()
+}
+
+func TestRelayBridge(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "through the bridge")
+	relay := newMockRelay(t, evt)
+
+	var dialed atomic.Int32
+	bridge, err := startRelayBridge(relay.URL+"/inbox", func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed.Add(1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}, nil)
+	if err != nil {
+		t.Fatalf("startRelayBridge: %v", err)
+	}
+	if !strings.HasSuffix(bridge.URL, "/inbox") || strings.Contains(bridge.URL, relay.URL) {
+		t.Errorf("expected a loopback URL keeping the path, got %s", bridge.URL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rc, err := nostr.RelayConnect(ctx, bridge.URL)
+	bridge.Close()
+	if err != nil {
+		t.Fatalf("RelayConnect: %v", err)
+	}
+	defer rc.Close()
+	events, err := rc.QuerySync(ctx, nostr.Filter{IDs: []string{evt.ID}})
+	if err != nil || len(events) != 1 || events[0].ID != evt.ID {
+		t.Fatalf("expected the stored event through the bridge, got %v, %v", events, err)
+	}
+	if dialed.Load() != 1 {
+		t.Errorf("expected the relay to be dialed once with the bridge's dialer, got %d", dialed.Load())
+	}
+}
+
+func TestRelayProxy(t *testing.T) {
+	// fakeProxy counts the connections made to it and drops each one.
+	fakeProxy := func() (string, *atomic.Int32) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		hits := &atomic.Int32{}
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				hits.Add(1)
+				conn.Close()
+			}
+		}()
+		return ln.Addr().String(), hits
+	}
+	proxyA, hitsA := fakeProxy()
+	proxyB, hitsB := fakeProxy()
+
+	opts, err := parseArgs([]string{
+		"-k", "k", "-r", "r", "-m", "hi", "--allow-insecure-relays",
+		"--relay-proxy", "ws://ndm-proxy-a.example:7001=socks5://" + proxyA,
+		"--relay-proxy", "ws://ndm-proxy-b.example:7002/=" + proxyB,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := connectRelay(ctx, opts, "ws://ndm-proxy-a.example:7001"); err == nil {
+		t.Fatal("expected the fake proxy to fail the connection")
+	}
+	if hitsA.Load() == 0 || hitsB.Load() != 0 {
+		t.Errorf("expected relay A to go through proxy A only, got A=%d B=%d", hitsA.Load(), hitsB.Load())
+	}
+	before := hitsA.Load()
+	if _, err := connectRelay(ctx, opts, "ws://ndm-proxy-b.example:7002"); err == nil {
+		t.Fatal("expected the fake proxy to fail the connection")
+	}
+	if hitsB.Load() == 0 || hitsA.Load() != before {
+		t.Errorf("expected relay B to go through proxy B only, got A=%d B=%d", hitsA.Load()-before, hitsB.Load())
+	}
+
+	// The proxy belongs to the options it was given with: connecting to the
+	// same relay without --relay-proxy dials it directly.
+	relay := newMockRelay(t)
+	proxied, err := parseArgs([]string{"read", "-k", "k", "--allow-insecure-relays", "--relay-proxy", relay.URL + "=" + proxyA})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := connectRelay(ctx, proxied, relay.URL); err == nil {
+		t.Fatal("expected the fake proxy to fail the connection")
+	}
+	before = hitsA.Load()
+	rc, err := connectRelay(ctx, &options{allowInsecure: true}, relay.URL)
+	if err != nil {
+		t.Fatalf("expected a direct connection without --relay-proxy, got %v", err)
+	}
+	rc.Close()
+	if hitsA.Load() != before {
+		t.Error("expected the direct connection to bypass proxy A")
+	}
+
+	for _, bad := range []string{"ws://relay.example", "ws://relay.example=", "=127.0.0.1:1080", "ws://relay.example=http://127.0.0.1:8080"} {
+		if _, _, err := parseRelayProxy(bad); err == nil {
+			t.Errorf("parseRelayProxy(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestConnectRelayChallenge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := ws.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		for {
+			if _, _, err := conn.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := connectRelay(ctx, &options{allowInsecure: true}, url); err == nil {
+		t.Fatal("expected the relay to reject a connection without the token")
+	}
+
+	opts, err := parseArgs([]string{"version", "--relay-challenge", "s3cret", "--allow-insecure-relays"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rc, err := connectRelay(ctx, opts, url)
+	if err != nil {
+		t.Fatalf("expected --relay-challenge to be accepted: %v", err)
+	}
+	rc.Close()
+}
+
+func TestInsecureRelays(t *testing.T) {
+	args := []string{"-k", "k", "-r", "r", "-m", "hi", "--relays", "wss://relay.example.com,ws://localhost:7777"}
+	if _, err := parseArgs(args); err == nil || !strings.Contains(err.Error(), "--allow-insecure-relays") {
+		t.Fatalf("expected an error for a ws:// relay, got %v", err)
+	}
+	if _, err := parseArgs(append(args, "--allow-insecure-relays")); err != nil {
+		t.Fatalf("expected --allow-insecure-relays to allow ws://, got %v", err)
+	}
+	if _, err := parseArgs([]string{"-k", "k", "-r", "r", "-m", "hi", "--relays", "http://localhost:7777"}); err == nil {
+		t.Error("expected http:// to be treated as an insecure ws:// relay")
+	}
+	if _, err := parseArgs([]string{"-k", "k", "-r", "r", "-m", "hi", "--relays", "ws+tor://relay.example.com"}); err != nil {
+		t.Errorf("expected a Tor relay to be allowed, got %v", err)
+	}
+
+	opts, err := parseArgs([]string{"-k", "k", "-r", "r", "-m", "hi", "--relays", "https://relay.example.com, wss://nos.lol"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := relayList(opts)
+	if len(got) != 2 || got[0] != "wss://relay.example.com" || got[1] != "wss://nos.lol" {
+		t.Errorf("expected https:// to be normalized to wss://, got %v", got)
+	}
+}
+
+func TestPrivateRelay(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	var attempts atomic.Int32
+	private := newFailingRelay(t, &attempts)
+	public := newMockRelay(t)
+
+	args := []string{"send", "-k", nostr.GeneratePrivateKey(), "-r", nostr.GeneratePrivateKey(), "-m", "hello",
+		"--allow-insecure-relays", "--relays", public.URL, "--private-relay", private, "-t", "5"}
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if relays := relayList(opts); len(relays) != 2 || relays[0] != private {
+		t.Fatalf("expected private relay first, got %v", relays)
+	}
+	captureStdout(t, func() {
+		err = sendMessage(opts)
+	})
+	if err == nil || !strings.Contains(err.Error(), "private relay") {
+		t.Fatalf("expected private relay error, got %v", err)
+	}
+	if attempts.Load() == 0 {
+		t.Error("expected the private relay to be tried")
+	}
+	if n := public.connections.Load(); n != 0 {
+		t.Errorf("expected public relay not to be contacted, got %d connections", n)
+	}
+
+	opts, err = parseArgs(append(args, "--allow-private-relay-failure"))
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	captureStderr(t, func() {
+		captureStdout(t, func() {
+			err = sendMessage(opts)
+		})
+	})
+	if err != nil {
+		t.Fatalf("sendMessage: %v", err)
+	}
+	if got := len(public.Published()); got != 1 {
+		t.Errorf("expected the public relay to receive the event, got %d", got)
+	}
+}
+
+func TestRelayConnectRate(t *testing.T) {
+	relay := newMockRelay(t)
+	opts, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--allow-insecure-relays", "--relays", relay.URL,
+		"--relay-connect-burst", "1", "--relay-connect-rate", "2"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+
+	start := time.Now()
+	for range 5 {
+		rc, err := connectRelay(context.Background(), opts, relay.URL)
+		if err != nil {
+			t.Fatalf("connectRelay: %v", err)
+		}
+		rc.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Errorf("expected 5 connections at 2/s to take at least 1.5s, took %v", elapsed)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--relay-connect-burst", "3"}); err == nil {
+		t.Error("expected error for --relay-connect-burst without --relay-connect-rate")
+	}
+}
+
+// newHugeEvent returns a DM to recipientPub with size bytes of random
+// content, which websocket compression cannot shrink.
+func newHugeEvent(t *testing.T, recipientPub string, size int) *nostr.Event {
+	t.Helper()
+	random := make([]byte, size/2)
+	rand.Read(random)
+	evt := &nostr.Event{
+		Kind:      nostr.KindEncryptedDirectMessage,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipientPub}},
+		Content:   hex.EncodeToString(random),
+	}
+	if err := evt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	return evt
+}
+
+func TestRelayResponseLimit(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	huge := newHugeEvent(t, recipientPub, 24<<20)
+	relay := newMockRelay(t, huge)
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--allow-insecure-relays", "--relays", relay.URL,
+		"--relay-response-limit", "16384"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	var out string
+	logs := captureStderr(t, func() {
+		out = captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	})
+	if !strings.Contains(logs, "--relay-response-limit") {
+		t.Errorf("expected a warning about the response limit, got:\n%s", logs)
+	}
+	if !strings.Contains(out, "No messages found") {
+		t.Errorf("expected the oversized event to be dropped, got:\n%s", out)
+	}
+	if sent := relay.sent.Load(); sent >= int64(len(huge.Content)) {
+		t.Errorf("expected the connection to close before the oversized event was read, but %d bytes were sent", sent)
+	}
+}
+
+func TestRelayWriteProof(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	first, second := newMockRelay(t), newMockRelay(t)
+	relays := first.URL + "," + second.URL + "," + newFailingRelay(t, nil)
+
+	send := func(proof string) error {
+		t.Helper()
+		opts, err := parseArgs([]string{"-k", sender, "-r", recipient, "-m", "hi", "--allow-insecure-relays", "--relays", relays, "--relay-write-proof", proof})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var sendErr error
+		captureStdout(t, func() { sendErr = sendMessage(opts) })
+		return sendErr
+	}
+
+	if err := send("2"); err != nil {
+		t.Errorf("expected two accepting relays to satisfy --relay-write-proof 2, got %v", err)
+	}
+	if err := send("3"); err == nil || !strings.Contains(err.Error(), "only 2 of 3 relays") {
+		t.Errorf("expected --relay-write-proof 3 to fail, got %v", err)
+	}
+
+	if _, err := parseArgs([]string{"-k", sender, "-r", recipient, "-m", "hi", "--allow-insecure-relays", "--relays", relays, "--relay-write-proof", "4"}); err == nil {
+		t.Error("expected more proofs than relays to be rejected at parse time")
+	}
+}
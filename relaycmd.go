@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// publishResult is the outcome of publishing to one relay, as printed by
+// relay publish-raw --json.
+type publishResult struct {
+	Relay string `json:"relay"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// relayCommand handles the relay subcommands.
+func relayCommand(opts *options) error {
+	if len(opts.args) == 0 {
+		return fmt.Errorf("usage: ndm relay publish-raw <json-file>")
+	}
+	switch opts.args[0] {
+	case "publish-raw":
+		if len(opts.args) < 2 {
+			return fmt.Errorf("usage: ndm relay publish-raw <json-file>")
+		}
+		return publishRaw(opts, opts.args[1])
+	default:
+		return fmt.Errorf("unknown relay command: %s (want publish-raw)", opts.args[0])
+	}
+}
+
+// publishRaw publishes an already-signed event from path to every relay
+// without touching it. Events that fail verification need --force.
+func publishRaw(opts *options, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read event: %w", err)
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("invalid event JSON: %w", err)
+	}
+
+	if err := verifyEvent(&event); err != nil {
+		if !opts.force {
+			return fmt.Errorf("refusing to publish event %s: %v (use --force to publish anyway)", event.ID, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: publishing event with %v\n", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	results := publishVerbatim(ctx, opts, relayList(opts), event)
+	if opts.jsonOutput {
+		out, _ := marshalJSON(results, opts)
+		fmt.Println(string(out))
+	} else {
+		for _, res := range results {
+			if res.OK {
+				fmt.Printf("✓ %s\n", res.Relay)
+			} else {
+				fmt.Printf("✗ %s: %s\n", res.Relay, res.Error)
+			}
+		}
+	}
+	if acceptedBy(results) == 0 {
+		return fmt.Errorf("failed to publish to any relay")
+	}
+	return nil
+}
+
+// verifyEvent checks that an event's ID matches its content and that its
+// signature is valid.
+func verifyEvent(event *nostr.Event) error {
+	if !event.CheckID() {
+		return errors.New("id does not match content")
+	}
+	if ok, err := event.CheckSignature(); !ok {
+		if err != nil {
+			return err
+		}
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// publishVerbatim publishes an already-signed event to each relay as is.
+func publishVerbatim(ctx context.Context, opts *options, relays []string, event nostr.Event) []publishResult {
+	var results []publishResult
+	for _, relay := range relays {
+		res := publishResult{Relay: relay}
+		rc, err := connectRelay(ctx, opts, relay)
+		if err == nil {
+			err = rc.Publish(ctx, event)
+			rc.Close()
+		}
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.OK = true
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// acceptedBy counts the relays that accepted an event.
+func acceptedBy(results []publishResult) int {
+	n := 0
+	for _, res := range results {
+		if res.OK {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// writeEventFile signs a kind 1 note and writes it to a temp file, letting
+// tamper modify it after signing.
+func writeEventFile(t *testing.T, tamper func(*nostr.Event)) (string, *nostr.Event) {
+	t.Helper()
+	event := &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: nostr.Now(),
+		Content:   "signed elsewhere",
+	}
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(event)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "event.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, event
+}
+
+func TestPublishRaw(t *testing.T) {
+	relay := newMockRelay(t)
+	path, event := writeEventFile(t, nil)
+
+	opts, err := parseArgs([]string{"relay", "publish-raw", path, "--allow-insecure-relays", "--relays", relay.URL, "--json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := relayCommand(opts); err != nil {
+			t.Fatalf("publish-raw: %v", err)
+		}
+	})
+
+	published := relay.Published()
+	if len(published) != 1 || published[0].ID != event.ID || published[0].Sig != event.Sig {
+		t.Fatalf("expected the event to be published unchanged, got %v", published)
+	}
+
+	var results []publishResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", out, err)
+	}
+	if len(results) != 1 || results[0].Relay != relay.URL || !results[0].OK {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestPublishRawTamperedSignature(t *testing.T) {
+	relay := newMockRelay(t)
+	path, _ := writeEventFile(t, func(e *nostr.Event) {
+		e.Sig = strings.Repeat("0", 128)
+	})
+
+	opts, err := parseArgs([]string{"relay", "publish-raw", path, "--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = relayCommand(opts)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected refusal mentioning --force, got %v", err)
+	}
+	if got := len(relay.Published()); got != 0 {
+		t.Fatalf("expected nothing published, got %d events", got)
+	}
+
+	opts.force = true
+	captureStderr(t, func() {
+		captureStdout(t, func() {
+			if err := relayCommand(opts); err != nil {
+				t.Fatalf("publish-raw --force: %v", err)
+			}
+		})
+	})
+	if got := len(relay.Published()); got != 1 {
+		t.Errorf("expected the event published with --force, got %d events", got)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr/nip11"
+)
+
+// relaySet records the relays a run connected to, for --relay-info-file. A
+// nil set records nothing.
+type relaySet struct {
+	mu   sync.Mutex
+	urls []string
+	seen map[string]bool
+}
+
+func (s *relaySet) add(relay string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	if !s.seen[relay] {
+		s.seen[relay] = true
+		s.urls = append(s.urls, relay)
+	}
+}
+
+func (s *relaySet) list() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.urls...)
+}
+
+// relayInfo is one line of --relay-info-file.
+type relayInfo struct {
+	URL           string `json:"url"`
+	Name          string `json:"name"`
+	Software      string `json:"software"`
+	Version       string `json:"version"`
+	SupportedNIPs []any  `json:"supported_nips"`
+	FetchedAt     int64  `json:"fetched_at"`
+}
+
+// writeRelayInfo fetches the NIP-11 document of every relay the run connected
+// to and appends one JSON line per relay to --relay-info-file. Like
+// writeMetrics, failures only produce a warning.
+func writeRelayInfo(opts *options) {
+	if opts.relayInfoFile == "" {
+		return
+	}
+	relays := opts.connected.list()
+	if len(relays) == 0 {
+		return
+	}
+
+	f, err := os.OpenFile(opts.relayInfoFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Failed to write relay info: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	for _, relay := range relays {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.readTimeout)
+		doc, err := nip11.Fetch(ctx, relay)
+		cancel()
+		if err != nil && opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] No relay info from %s: %v\n", relay, err)
+		}
+
+		line, _ := json.Marshal(relayInfo{
+			URL:           relay,
+			Name:          doc.Name,
+			Software:      doc.Software,
+			Version:       doc.Version,
+			SupportedNIPs: doc.SupportedNIPs,
+			FetchedAt:     time.Now().Unix(),
+		})
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "[ndm] Failed to write relay info: %v\n", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRelayInfoFile(t *testing.T) {
+	first := newMockRelay(t)
+	second := newMockRelay(t)
+	path := filepath.Join(t.TempDir(), "relays.jsonl")
+
+	opts, err := parseArgs([]string{
+		"-k", nostr.GeneratePrivateKey(),
+		"-r", nostr.GeneratePrivateKey(),
+		"-m", "hello",
+		"--allow-insecure-relays", "--relays", first.URL + "," + second.URL,
+		"--relay-info-file", path,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	captureStdout(t, func() {
+		if err := sendMessage(opts); err != nil {
+			t.Fatalf("sendMessage: %v", err)
+		}
+	})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	urls := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var info relayInfo
+		if err := json.Unmarshal(scanner.Bytes(), &info); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		if info.Software != "ndm-mockrelay" || info.Name != "mock relay" || len(info.SupportedNIPs) != 3 {
+			t.Errorf("unexpected relay info: %+v", info)
+		}
+		if info.FetchedAt == 0 {
+			t.Errorf("expected fetched_at, got %+v", info)
+		}
+		urls[info.URL] = true
+	}
+	if len(urls) != 2 || !urls[first.URL] || !urls[second.URL] {
+		t.Errorf("expected entries for %s and %s, got %v", first.URL, second.URL, urls)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// relayScore is what ndm remembers about one relay across runs.
+type relayScore struct {
+	Successes    int     `json:"successes"`
+	Failures     int     `json:"failures"`
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+	LastSeen     int64   `json:"last_seen,omitempty"`
+}
+
+// Score rates a relay between 0 and 1 by its publish success rate. The +1/+2
+// smoothing keeps a relay seen once from outranking a long, mostly good
+// record.
+func (s relayScore) Score() float64 {
+	return float64(s.Successes+1) / float64(s.Successes+s.Failures+2)
+}
+
+// record adds the outcome of one publish attempt.
+func (s *relayScore) record(ok bool, latency time.Duration) {
+	if !ok {
+		s.Failures++
+		return
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	s.AvgLatencyMS = (s.AvgLatencyMS*float64(s.Successes) + ms) / float64(s.Successes+1)
+	s.Successes++
+	s.LastSeen = time.Now().Unix()
+}
+
+// relayScoresPath returns where relay scores are kept.
+func relayScoresPath() string {
+	return dataPath("relay_scores.json")
+}
+
+func loadRelayScores(path string) (map[string]*relayScore, error) {
+	scores := make(map[string]*relayScore)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return scores, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return nil, fmt.Errorf("invalid relay scores %s: %w", path, err)
+	}
+	return scores, nil
+}
+
+func saveRelayScores(path string, scores map[string]*relayScore) error {
+	out, err := json.MarshalIndent(scores, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o600)
+}
+
+// relayAttempt is the outcome of publishing to one relay.
+type relayAttempt struct {
+	relay   string
+	ok      bool
+	latency time.Duration
+}
+
+// updateRelayScores folds one send's attempts into the scores file. Failures
+// are only reported, since they must not fail the send.
+func updateRelayScores(opts *options, attempts []relayAttempt) {
+	path := relayScoresPath()
+	if path == "" || len(attempts) == 0 {
+		return
+	}
+	scores, err := loadRelayScores(path)
+	if err == nil {
+		for _, a := range attempts {
+			s, ok := scores[a.relay]
+			if !ok {
+				s = &relayScore{}
+				scores[a.relay] = s
+			}
+			s.record(a.ok, a.latency)
+		}
+		err = saveRelayScores(path, scores)
+	}
+	if err != nil && opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Failed to update relay scores: %v\n", err)
+	}
+}
+
+// rankedRelays returns the scored relays, best first. Ties go to the lower
+// average latency.
+func rankedRelays(scores map[string]*relayScore) []string {
+	relays := make([]string, 0, len(scores))
+	for relay := range scores {
+		relays = append(relays, relay)
+	}
+	sort.Slice(relays, func(i, j int) bool {
+		a, b := scores[relays[i]], scores[relays[j]]
+		if a.Score() != b.Score() {
+			return a.Score() > b.Score()
+		}
+		if a.AvgLatencyMS != b.AvgLatencyMS {
+			return a.AvgLatencyMS < b.AvgLatencyMS
+		}
+		return relays[i] < relays[j]
+	})
+	return relays
+}
+
+// relayScoresCommand handles relay-scores list.
+func relayScoresCommand(opts *options) error {
+	if len(opts.args) > 0 && opts.args[0] != "list" {
+		return fmt.Errorf("unknown relay-scores command: %s (want list)", opts.args[0])
+	}
+
+	scores, err := loadRelayScores(relayScoresPath())
+	if err != nil {
+		return err
+	}
+
+	if opts.jsonOutput {
+		out, _ := marshalJSON(scores, opts)
+		fmt.Println(string(out))
+		return nil
+	}
+	if len(scores) == 0 {
+		fmt.Println("No relay scores recorded yet")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RELAY\tSCORE\tOK\tFAILED\tAVG LATENCY\tLAST SEEN")
+	for _, relay := range rankedRelays(scores) {
+		s := scores[relay]
+		lastSeen := "never"
+		if s.LastSeen > 0 {
+			lastSeen = time.Unix(s.LastSeen, 0).Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%.2f\t%d\t%d\t%.0fms\t%s\n", relay, s.Score(), s.Successes, s.Failures, s.AvgLatencyMS, lastSeen)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRelayScores(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	good := newMockRelay(t)
+	bad := newFailingRelay(t, nil)
+
+	for run := 0; run < 2; run++ {
+		opts := &options{
+			key:           nostr.GeneratePrivateKey(),
+			recipient:     nostr.GeneratePrivateKey(),
+			message:       "hello",
+			relays:        good.URL + "," + bad,
+			wait:          5 * time.Second,
+			allowInsecure: true,
+		}
+		captureStdout(t, func() {
+			if err := sendMessage(opts); err != nil {
+				t.Fatalf("sendMessage: %v", err)
+			}
+		})
+	}
+
+	scores, err := loadRelayScores(relayScoresPath())
+	if err != nil {
+		t.Fatalf("loadRelayScores: %v", err)
+	}
+	g, b := scores[good.URL], scores[bad]
+	if g == nil || b == nil {
+		t.Fatalf("expected scores for both relays, got %v", scores)
+	}
+	if g.Successes != 2 || g.Failures != 0 || b.Successes != 0 || b.Failures != 2 {
+		t.Errorf("unexpected counts: good %+v, bad %+v", *g, *b)
+	}
+	if g.Score() <= b.Score() {
+		t.Errorf("expected good relay to outscore bad relay: %.2f <= %.2f", g.Score(), b.Score())
+	}
+	if g.LastSeen == 0 {
+		t.Error("expected last seen to be recorded")
+	}
+
+	opts, err := parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--auto-select-relays", "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if relays := relayList(opts); len(relays) != 1 || relays[0] != good.URL {
+		t.Errorf("expected auto-selected %s, got %v", good.URL, relays)
+	}
+
+	private := "wss://private.example"
+	opts, err = parseArgs([]string{"read", "-k", nostr.GeneratePrivateKey(), "--auto-select-relays", "2",
+		"--private-relay", private, "--max-relays", "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if relays := relayList(opts); len(relays) != 2 || relays[0] != private || relays[1] != good.URL {
+		t.Errorf("expected the private relay first, then 1 auto-selected relay, got %v", relays)
+	}
+
+	out := captureStdout(t, func() {
+		if err := relayScoresCommand(&options{args: []string{"list"}}); err != nil {
+			t.Fatalf("relay-scores list: %v", err)
+		}
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], good.URL) {
+		t.Errorf("expected good relay ranked first, got:\n%s", out)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// relayStat is one line of --relay-stats-file.
+type relayStat struct {
+	Timestamp   int64   `json:"timestamp"`
+	RelayURL    string  `json:"relay_url"`
+	Operation   string  `json:"operation"`
+	LatencyMS   int64   `json:"latency_ms"`
+	Success     bool    `json:"success"`
+	EventsCount int     `json:"events_count"`
+	ErrorMsg    *string `json:"error_msg"`
+}
+
+// writeRelayStat appends the outcome of one relay operation ("send" or
+// "read") that started at began to --relay-stats-file. Like writeMetrics,
+// failures only produce a warning.
+func writeRelayStat(opts *options, operation, relay string, began time.Time, events int, opErr error) {
+	if opts.relayStatsFile == "" {
+		return
+	}
+
+	stat := relayStat{
+		Timestamp:   began.Unix(),
+		RelayURL:    relay,
+		Operation:   operation,
+		LatencyMS:   time.Since(began).Milliseconds(),
+		Success:     opErr == nil,
+		EventsCount: events,
+	}
+	if opErr != nil {
+		msg := opErr.Error()
+		stat.ErrorMsg = &msg
+	}
+
+	line, err := json.Marshal(stat)
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(opts.relayStatsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.Write(append(line, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Failed to write relay stats: %v\n", err)
+	}
+}
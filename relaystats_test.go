@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRelayStatsFile(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	good := newMockRelay(t, newTestDM(t, sender, recipientPub, "hello"), newTestDM(t, sender, recipientPub, "again"))
+	bad := newFailingRelay(t, nil)
+	statsFile := filepath.Join(t.TempDir(), "relay-stats.jsonl")
+
+	opts, err := parseArgs([]string{
+		"read", "-k", recipient, "--relay-stats-file", statsFile,
+		"--allow-insecure-relays", "--relays", good.URL + "," + bad,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+
+	f, err := os.Open(statsFile)
+	if err != nil {
+		t.Fatalf("opening relay stats file: %v", err)
+	}
+	defer f.Close()
+
+	lines := make(map[string]map[string]any)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		url, _ := line["relay_url"].(string)
+		lines[url] = line
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per relay, got %v", lines)
+	}
+
+	ok := lines[good.URL]
+	if ok["operation"] != "read" || ok["success"] != true || ok["events_count"] != float64(2) || ok["error_msg"] != nil {
+		t.Errorf("unexpected line for the working relay: %v", ok)
+	}
+	if _, found := ok["latency_ms"]; !found {
+		t.Errorf("missing latency_ms: %v", ok)
+	}
+	failed := lines[bad]
+	if failed["success"] != false || failed["events_count"] != float64(0) {
+		t.Errorf("unexpected line for the failing relay: %v", failed)
+	}
+	if msg, _ := failed["error_msg"].(string); msg == "" {
+		t.Errorf("expected an error_msg for the failing relay, got %v", failed["error_msg"])
+	}
+}
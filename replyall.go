@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// replyAllCommand sends opts.message to every sender found in the inbox
+// within --max-age, once per sender, skipping --exclude pubkeys.
+func replyAllCommand(opts *options) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	privkey, err := resolvePrivateKey(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	pubkey, err := derivePublicKeyFromPrivate(privkey, opts.directDerive)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	excluded := make(map[string]bool)
+	for _, ex := range opts.exclude {
+		pk, _, err := decodePubkeyInput(ex)
+		if err != nil {
+			return fmt.Errorf("invalid --exclude: %w", err)
+		}
+		excluded[pk] = true
+	}
+
+	filter := readFilter(opts, pubkey)
+	filter.Limit = 0
+	seen := make(map[string]bool)
+	var senders []string
+	events := unwrapGiftWraps(fetchEvents(ctx, opts, relayList(opts), filter), privkey, opts)
+	for _, e := range dropBefore(events, readSince(opts)) {
+		// A gift wrap that could not be opened is signed by a one-time key.
+		if e.Kind == nostr.KindGiftWrap || seen[e.PubKey] || excluded[e.PubKey] || e.PubKey == pubkey {
+			continue
+		}
+		seen[e.PubKey] = true
+		senders = append(senders, e.PubKey)
+	}
+
+	if len(senders) == 0 {
+		fmt.Println("No senders to reply to")
+		return nil
+	}
+
+	if opts.dryRun {
+		fmt.Printf("Would reply to %d senders:\n", len(senders))
+		for _, pk := range senders {
+			npub, _ := nip19.EncodePublicKey(pk)
+			fmt.Printf("  %s\n", npub)
+		}
+		return nil
+	}
+
+	failed := 0
+	for i, pk := range senders {
+		npub, _ := nip19.EncodePublicKey(pk)
+		fmt.Printf("[%d/%d] Replying to %s\n", i+1, len(senders), npub)
+
+		reply := *opts
+		reply.command = "send"
+		reply.recipient = npub
+		// With --sign-only each reply stops after printing its event.
+		if err := sendMessage(&reply); err != nil && !errors.Is(err, errSignedOnly) {
+			fmt.Fprintf(os.Stderr, "Failed to reply to %s: %v\n", npub, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to reply to %d of %d senders", failed, len(senders))
+	}
+	if opts.signOnly {
+		return errSignedOnly
+	}
+	return nil
+}
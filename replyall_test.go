@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestReplyAll(t *testing.T) {
+	alice := nostr.GeneratePrivateKey()
+	bob := nostr.GeneratePrivateKey()
+	carol := nostr.GeneratePrivateKey()
+	me := nostr.GeneratePrivateKey()
+	mePub, _ := nostr.GetPublicKey(me)
+
+	relay := newMockRelay(t,
+		newTestDM(t, alice, mePub, "first"),
+		newTestDM(t, alice, mePub, "second"),
+		newTestDM(t, bob, mePub, "hello"),
+	)
+
+	replyAll := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{
+			"reply-all", "-k", me, "-m", "thanks!", "--max-age", "1h", "--allow-insecure-relays", "--relays", relay.URL,
+		}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := replyAllCommand(opts); err != nil {
+				t.Fatalf("reply-all: %v", err)
+			}
+		})
+	}
+
+	out := replyAll("--dry-run")
+	if !strings.Contains(out, "Would reply to 2 senders") || len(relay.Published()) != 0 {
+		t.Fatalf("expected a dry run listing 2 senders, got:\n%s", out)
+	}
+
+	carolPub, _ := nostr.GetPublicKey(carol)
+	carolNpub, _ := nip19.EncodePublicKey(carolPub)
+	out = replyAll("--exclude", carolNpub)
+	published := relay.Published()
+	if len(published) != 2 {
+		t.Fatalf("expected one reply per unique sender, got %d:\n%s", len(published), out)
+	}
+	alicePub, _ := nostr.GetPublicKey(alice)
+	bobPub, _ := nostr.GetPublicKey(bob)
+	to := map[string]bool{}
+	for _, e := range published {
+		to[e.Tags.Find("p")[1]] = true
+	}
+	if !to[alicePub] || !to[bobPub] {
+		t.Errorf("expected replies to alice and bob, got %v", to)
+	}
+	if strings.Count(out, "Replying to") != 2 {
+		t.Errorf("expected a progress line per sender, got:\n%s", out)
+	}
+
+	bobNpub, _ := nip19.EncodePublicKey(bobPub)
+	replyAll("--exclude", bobNpub)
+	for _, e := range relay.Published()[2:] {
+		if e.Tags.Find("p")[1] == bobPub {
+			t.Errorf("expected --exclude to skip bob")
+		}
+	}
+
+	// A hex pubkey is also a valid private key, but it must be kept as is.
+	if out := replyAll("--dry-run", "--exclude", bobPub); !strings.Contains(out, "Would reply to 1 senders") || strings.Contains(out, bobNpub) {
+		t.Errorf("expected --exclude with a hex pubkey to skip bob, got:\n%s", out)
+	}
+
+	opts, err := parseArgs([]string{"reply-all", "-k", me, "-m", "thanks!", "--max-age", "1h", "--sign-only",
+		"--allow-insecure-relays", "--relays", relay.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	before := len(relay.Published())
+	var signErr error
+	stderr := captureStderr(t, func() {
+		out = captureStdout(t, func() { signErr = replyAllCommand(opts) })
+	})
+	if !errors.Is(signErr, errSignedOnly) || strings.Contains(stderr, "Failed") {
+		t.Errorf("expected --sign-only to sign a reply per sender without failures, got %v:\n%s", signErr, stderr)
+	}
+	if n := strings.Count(out, `"sig"`); n != 2 || len(relay.Published()) != before {
+		t.Errorf("expected 2 signed, unpublished replies, got %d:\n%s", n, out)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// jsonSchemaCommand prints a JSON Schema (draft 7) for the --json output of
+// the current command.
+func jsonSchemaCommand(opts *options) error {
+	var schema map[string]any
+	switch {
+	case opts.read:
+		schema = map[string]any{
+			"type":        "array",
+			"description": "Messages returned by ndm read --json",
+			"items":       structSchema(reflect.TypeOf(jsonMessage{})),
+		}
+	case opts.command == "send":
+		schema = structSchema(reflect.TypeOf(sendResult{}))
+		schema["description"] = "Result of ndm send --json"
+	default:
+		return fmt.Errorf("no JSON schema for %s", opts.command)
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// structSchema describes a struct from its json and desc tags. Fields
+// without omitempty are required.
+func structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, flags, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		prop := typeSchema(f.Type)
+		if desc := f.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		properties[name] = prop
+		if !strings.Contains(flags, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// typeSchema maps a Go type to its JSON Schema type. Pointers and
+// interfaces may also be null.
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		prop := typeSchema(t.Elem())
+		prop["type"] = []any{prop["type"], "null"}
+		return prop
+	case reflect.Interface:
+		return map[string]any{"type": []any{"string", "null"}}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return map[string]any{"type": "object"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schemaFor := func(args ...string) map[string]any {
+		t.Helper()
+		out := captureStdout(t, func() {
+			if err := run(args); err != nil {
+				t.Fatalf("run %v: %v", args, err)
+			}
+		})
+		var schema map[string]any
+		if err := json.Unmarshal([]byte(out), &schema); err != nil {
+			t.Fatalf("schema is not valid JSON: %v\n%s", err, out)
+		}
+		return schema
+	}
+
+	send := schemaFor("send", "--json-schema")
+	props, _ := send["properties"].(map[string]any)
+	id, _ := props["id"].(map[string]any)
+	if id["type"] != "string" || id["description"] == "" {
+		t.Errorf("expected string id property, got %v", props["id"])
+	}
+	if required, _ := send["required"].([]any); len(required) != len(props) {
+		t.Errorf("expected every send field to be required, got %v", required)
+	}
+
+	read := schemaFor("read", "--json-schema")
+	items, _ := read["items"].(map[string]any)
+	props, _ = items["properties"].(map[string]any)
+	if _, ok := props["content"]; !ok || read["type"] != "array" {
+		t.Errorf("expected an array of messages with content, got %v", read)
+	}
+	for name, prop := range props {
+		if prop.(map[string]any)["description"] == nil {
+			t.Errorf("expected a description for %s", name)
+		}
+	}
+
+	if err := run([]string{"keygen", "--json-schema"}); err == nil {
+		t.Error("expected error for a command without JSON output schema")
+	}
+}
+
+func TestJSONSchemaMatchesMessage(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	senderPub, _ := nostr.GetPublicKey(sender)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	opts, err := parseArgs([]string{"-k", sender, "-r", recipientPub, "-m", "hello", "--label", "work", "--nip", "4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	evt, err := buildDMEvent(opts, sender, recipientPub)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	data, _ := json.Marshal(newJSONMessage(&evt, recipient, &options{}))
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := structSchema(reflect.TypeOf(jsonMessage{}))
+	props := schema["properties"].(map[string]any)
+	for _, name := range schema["required"].([]string) {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("required field %s missing from a real message", name)
+		}
+	}
+	jsonType := map[reflect.Kind]string{reflect.String: "string", reflect.Bool: "boolean", reflect.Float64: "integer", reflect.Slice: "array", reflect.Map: "object"}
+	for name, value := range fields {
+		prop, ok := props[name].(map[string]any)
+		if !ok {
+			t.Errorf("field %s is not in the schema", name)
+			continue
+		}
+		want := jsonType[reflect.TypeOf(value).Kind()]
+		if types, ok := prop["type"].([]any); ok {
+			if !slices.Contains(types, any(want)) {
+				t.Errorf("field %s: schema types %v do not allow %s", name, types, want)
+			}
+		} else if prop["type"] != want {
+			t.Errorf("field %s: schema type %v, got %s", name, prop["type"], want)
+		}
+	}
+
+	desc := func(name string) string { return props[name].(map[string]any)["description"].(string) }
+	if fields["from"] != senderPub || !strings.Contains(desc("from"), "hex") {
+		t.Errorf("expected from to be the hex pubkey and described as such, got %v: %q", fields["from"], desc("from"))
+	}
+	if topics, _ := fields["topics"].([]any); len(topics) != 1 || topics[0] != "work" || !strings.Contains(desc("topics"), "l tags") {
+		t.Errorf("expected topics to hold the --label value and be described as labels, got %v: %q", fields["topics"], desc("topics"))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// maxSeenEvents caps how many event IDs watch and aggregate remember to skip
+// duplicates.
+const maxSeenEvents = 10000
+
+// seenEvents remembers recently seen event IDs so watch and aggregate can
+// drop copies delivered by other relays. IDs are forgotten after window, and the oldest
+// are forgotten first once max are held.
+type seenEvents struct {
+	window time.Duration
+	max    int
+	at     map[string]time.Time
+	order  []string
+}
+
+func newSeenEvents(window time.Duration, max int) *seenEvents {
+	return &seenEvents{window: window, max: max, at: make(map[string]time.Time)}
+}
+
+// firstSeen records id and reports whether it was not already remembered.
+func (s *seenEvents) firstSeen(id string, now time.Time) bool {
+	s.expire(now)
+	if _, ok := s.at[id]; ok {
+		return false
+	}
+	s.at[id] = now
+	s.order = append(s.order, id)
+	return true
+}
+
+// expire forgets IDs older than the window and, beyond max, the oldest ones.
+func (s *seenEvents) expire(now time.Time) {
+	drop := 0
+	for drop < len(s.order) {
+		id := s.order[drop]
+		if len(s.order)-drop < s.max && now.Sub(s.at[id]) < s.window {
+			break
+		}
+		delete(s.at, id)
+		drop++
+	}
+	s.order = s.order[drop:]
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// seenByResult is one relay's answer to event-seen-by.
+type seenByResult struct {
+	Relay     string `json:"relay"`
+	EventID   string `json:"event_id"`
+	Found     bool   `json:"found"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// eventSeenByCommand asks each relay (usually the one given with --relay)
+// whether it has the event, for checking that a send reached it.
+func eventSeenByCommand(opts *options) error {
+	if len(opts.args) != 1 {
+		return fmt.Errorf("usage: ndm event-seen-by <event-id> --relay <url>")
+	}
+	id, err := decodeEventID(opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	for _, relay := range relayList(opts) {
+		res := eventSeenBy(ctx, opts, relay, id)
+		if opts.jsonOutput {
+			out, _ := marshalJSON(res, opts)
+			fmt.Println(string(out))
+			continue
+		}
+		switch {
+		case res.Error != "":
+			fmt.Printf("✗ Could not check %s: %s\n", relay, res.Error)
+		case res.Found:
+			fmt.Printf("✓ Event found on relay %s (%dms)\n", relay, res.LatencyMS)
+		default:
+			fmt.Printf("✗ Event not found on relay %s\n", relay)
+		}
+	}
+	return nil
+}
+
+// eventSeenBy queries relay for the event with id.
+func eventSeenBy(ctx context.Context, opts *options, relay, id string) (res seenByResult) {
+	res = seenByResult{Relay: relay, EventID: id}
+	began := time.Now()
+	defer func() { res.LatencyMS = time.Since(began).Milliseconds() }()
+
+	rc, err := connectRelay(ctx, opts, relay)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer rc.Close()
+
+	readCtx, cancel := withReadTimeout(ctx, opts)
+	defer cancel()
+	events, err := rc.QuerySync(readCtx, nostr.Filter{IDs: []string{id}, Limit: 1})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Found = len(events) > 0 && events[0].ID == id
+	return res
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestEventSeenBy(t *testing.T) {
+	recipientPub, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	stored := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "hello")
+	relay := newMockRelay(t, stored)
+	missing := strings.Repeat("0f", 32)
+
+	seenBy := func(id string, extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"event-seen-by", id, "--allow-insecure-relays", "--relay", relay.URL}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := eventSeenByCommand(opts); err != nil {
+				t.Fatalf("event-seen-by: %v", err)
+			}
+		})
+	}
+
+	note, _ := nip19.EncodeNote(stored.ID)
+	if out := seenBy(note); !strings.Contains(out, "Event found on relay "+relay.URL) {
+		t.Errorf("expected the stored event to be found, got:\n%s", out)
+	}
+	if out := seenBy(missing); !strings.Contains(out, "Event not found on relay "+relay.URL) {
+		t.Errorf("expected the unknown event to be missing, got:\n%s", out)
+	}
+
+	for id, want := range map[string]bool{stored.ID: true, missing: false} {
+		var res map[string]any
+		if err := json.Unmarshal([]byte(seenBy(id, "--json")), &res); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if res["relay"] != relay.URL || res["event_id"] != id || res["found"] != want {
+			t.Errorf("unexpected result for %s: %v", id, res)
+		}
+		if ms, ok := res["latency_ms"].(float64); !ok || ms < 0 {
+			t.Errorf("expected a latency_ms, got %v", res["latency_ms"])
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// parseMessageTemplate parses a --format template. It is run once per
+// message with the message's JSON fields ({{.From}}, {{.Content}}, ...).
+func parseMessageTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("format").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// loadTemplateFile reads and parses --output-template-file. A trailing
+// newline is dropped so the file behaves like the same text given inline.
+func loadTemplateFile(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --output-template-file: %w", err)
+	}
+	return parseMessageTemplate(strings.TrimSuffix(string(data), "\n"))
+}
+
+// fprintTemplate writes one message rendered with opts.tmpl, followed by a
+// newline.
+func fprintTemplate(w io.Writer, e *nostr.Event, privkey string, opts *options) error {
+	if err := opts.tmpl.Execute(w, newJSONMessage(e, privkey, opts)); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// reloadTemplate re-reads --output-template-file. On error the previous
+// template stays in use.
+func reloadTemplate(opts *options) {
+	tmpl, err := loadTemplateFile(opts.templateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ndm] Warning: keeping previous template: %v\n", err)
+		return
+	}
+	opts.tmpl = tmpl
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Reloaded template from %s\n", opts.templateFile)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func writeTemplateFile(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "format.tmpl")
+	if err := os.WriteFile(path, []byte(text+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOutputTemplateFile(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	events := writeEventsFile(t,
+		newTestDM(t, sender, recipientPub, "first"),
+		newTestDM(t, sender, recipientPub, "second"),
+	)
+
+	const text = "{{.From}} says {{.Content}}"
+	read := func(extra ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"read", "-k", recipient, "--import-event", events}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := readMessages(opts); err != nil {
+				t.Fatalf("readMessages: %v", err)
+			}
+		})
+	}
+
+	inline := read("--format", text)
+	fromFile := read("--output-template-file", writeTemplateFile(t, text))
+	if fromFile != inline {
+		t.Errorf("expected the file template to match --format:\nfile:\n%s\ninline:\n%s", fromFile, inline)
+	}
+	if !strings.Contains(inline, " says first\n") || !strings.Contains(inline, " says second\n") {
+		t.Errorf("expected one rendered line per message, got:\n%s", inline)
+	}
+}
+
+func TestOutputTemplateFileErrors(t *testing.T) {
+	key := nostr.GeneratePrivateKey()
+	path := writeTemplateFile(t, "{{.Content}}")
+
+	if _, err := parseArgs([]string{"read", "-k", key, "--format", "{{.Content}}", "--output-template-file", path}); err == nil {
+		t.Error("expected --format with --output-template-file to fail")
+	}
+	if _, err := parseArgs([]string{"read", "-k", key, "--output-template-file", filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("expected a missing template file to fail")
+	}
+	if _, err := parseArgs([]string{"read", "-k", key, "--format", "{{.Content"}); err == nil {
+		t.Error("expected an invalid template to fail")
+	}
+}
+
+func TestWatchTemplateReload(t *testing.T) {
+	source := newMockRelay(t)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	sender := nostr.GeneratePrivateKey()
+	path := writeTemplateFile(t, "old: {{.Content}}")
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", recipient,
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--output-template-file", path,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	out := captureStdout(t, func() {
+		go func() { done <- watch(ctx, opts) }()
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+			t.Fatal("watch never subscribed")
+		}
+		source.Deliver(newTestDM(t, sender, recipientPub, "before"))
+		time.Sleep(100 * time.Millisecond)
+
+		if err := os.WriteFile(path, []byte("new: {{.Content}}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		source.Deliver(newTestDM(t, sender, recipientPub, "after"))
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+	})
+
+	if !strings.Contains(out, "old: before\n") || !strings.Contains(out, "new: after\n") {
+		t.Errorf("expected the template to change after SIGHUP, got:\n%s", out)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// replyParent returns the event e replies to: its NIP-10 "reply" e tag,
+// else its "root" e tag, else "".
+func replyParent(e *nostr.Event) string {
+	root := ""
+	for tag := range e.Tags.FindAll("e") {
+		if len(tag) < 4 {
+			continue
+		}
+		switch tag[3] {
+		case "reply":
+			return tag[1]
+		case "root":
+			root = tag[1]
+		}
+	}
+	return root
+}
+
+// inConversation reports whether one of e's marked e tags references id.
+func inConversation(e *nostr.Event, id string) bool {
+	for tag := range e.Tags.FindAll("e") {
+		if len(tag) >= 4 && tag[1] == id && (tag[3] == "root" || tag[3] == "reply") {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByConversation keeps the events in the thread of root, oldest first.
+func filterByConversation(events []*nostr.Event, root string) []*nostr.Event {
+	var kept []*nostr.Event
+	for _, e := range events {
+		if inConversation(e, root) {
+			kept = append(kept, e)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].CreatedAt < kept[j].CreatedAt
+	})
+	return kept
+}
+
+// threadDepths returns how many known replies separate each event from a
+// direct reply to root. Events whose parent is not among events count as
+// direct replies. Without a root it returns nil.
+func threadDepths(events []*nostr.Event, root string) map[string]int {
+	if root == "" {
+		return nil
+	}
+	parents := make(map[string]string, len(events))
+	for _, e := range events {
+		parents[e.ID] = replyParent(e)
+	}
+
+	depths := make(map[string]int, len(events))
+	for _, e := range events {
+		depth := 0
+		seen := map[string]bool{e.ID: true}
+		for p := parents[e.ID]; p != root && !seen[p]; p = parents[p] {
+			if _, known := parents[p]; !known {
+				break
+			}
+			seen[p] = true
+			depth++
+		}
+		depths[e.ID] = depth
+	}
+	return depths
+}
+
+// printIndented prints a message like printMessage, indented two spaces for
+// each reply hop.
+func printIndented(n int, e *nostr.Event, privkey string, opts *options, depth int) {
+	var buf bytes.Buffer
+	fprintMessage(&buf, n, e, privkey, opts)
+	indent := strings.Repeat("  ", depth)
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if strings.TrimSpace(line) != "" {
+			line = indent + line
+		}
+		fmt.Print(line)
+	}
+}
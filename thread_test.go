@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestConversationID(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	root := strings.Repeat("a", 64)
+
+	threadDM := func(msg string, at nostr.Timestamp, tags ...nostr.Tag) *nostr.Event {
+		evt := newTestDM(t, sender, recipientPub, msg)
+		evt.CreatedAt = at
+		evt.Tags = append(evt.Tags, tags...)
+		if err := evt.Sign(sender); err != nil {
+			t.Fatal(err)
+		}
+		return evt
+	}
+	first := threadDM("first reply", 100, nostr.Tag{"e", root, "", "root"})
+	second := threadDM("reply to first", 200, nostr.Tag{"e", root, "", "root"}, nostr.Tag{"e", first.ID, "", "reply"})
+	third := threadDM("another reply", 300, nostr.Tag{"e", root, "", "reply"})
+	other := threadDM("elsewhere", 150, nostr.Tag{"e", strings.Repeat("b", 64), "", "root"})
+	path := writeEventsFile(t, third, other, second, first)
+
+	if got := filterByConversation([]*nostr.Event{third, other, second, first}, root); len(got) != 3 ||
+		got[0] != first || got[1] != second || got[2] != third {
+		t.Fatalf("expected the three thread events oldest first, got %v", got)
+	}
+
+	opts, err := parseArgs([]string{"read", "-k", recipient, "--import-event", path, "--conversation-id", root})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+	if !strings.Contains(out, "Found 3 messages") || strings.Contains(out, "elsewhere") {
+		t.Errorf("expected only the thread messages, got:\n%s", out)
+	}
+	if !strings.Contains(out, "\n  [2] From:") || !strings.Contains(out, "\n[3] From:") {
+		t.Errorf("expected the reply to the first message to be indented, got:\n%s", out)
+	}
+
+	if _, err := parseArgs([]string{"read", "-k", recipient, "--conversation-id", "nope"}); err == nil {
+		t.Error("expected error for invalid conversation ID")
+	}
+}
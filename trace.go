@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// traceStep is one timed step of a traced send.
+type traceStep struct {
+	Step      string `json:"step"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// sendTrace records the steps of sendMessage for the trace command. A nil
+// *sendTrace records nothing, so sendMessage can call it unconditionally.
+type sendTrace struct {
+	start time.Time
+	steps []traceStep
+}
+
+func newSendTrace() *sendTrace {
+	return &sendTrace{start: time.Now()}
+}
+
+func (t *sendTrace) step(name, detail string) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, traceStep{name, time.Since(t.start).Milliseconds(), detail})
+}
+
+// traceCommand runs "trace send": a normal send that prints how long each
+// step took instead of the usual result, even when the send fails.
+func traceCommand(opts *options) error {
+	if len(opts.args) == 0 || opts.args[0] != "send" {
+		return fmt.Errorf("usage: ndm trace send -k <key> -r <recipient> -m <message>")
+	}
+
+	trace := newSendTrace()
+	send := *opts
+	send.command = "send"
+	send.trace = trace
+	sendErr := sendMessage(&send)
+	if sendErr != nil {
+		trace.step("Failed", sendErr.Error())
+	}
+
+	if opts.jsonOutput {
+		out, _ := marshalJSON(trace.steps, opts)
+		fmt.Println(string(out))
+	} else {
+		for _, s := range trace.steps {
+			line := fmt.Sprintf("[+%dms] %s", s.ElapsedMS, s.Step)
+			if s.Detail != "" {
+				line += " (" + s.Detail + ")"
+			}
+			fmt.Println(line)
+		}
+	}
+	return sendErr
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestTraceSend(t *testing.T) {
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	relay := newMockRelay(t)
+
+	trace := func(extra ...string) string {
+		t.Helper()
+		args := append([]string{"trace", "send", "-k", sender, "-r", recipient, "-m", "hi", "--allow-insecure-relays", "--relays", relay.URL}, extra...)
+		return captureStdout(t, func() {
+			if err := run(args); err != nil {
+				t.Fatalf("trace: %v", err)
+			}
+		})
+	}
+
+	var steps []traceStep
+	if err := json.Unmarshal([]byte(trace("--json")), &steps); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	names := make(map[string]bool)
+	for i, s := range steps {
+		names[s.Step] = true
+		if s.ElapsedMS < 0 || (i > 0 && s.ElapsedMS < steps[i-1].ElapsedMS) {
+			t.Errorf("elapsed times must not go backwards: %+v", steps)
+		}
+	}
+	for _, want := range []string{"Key resolved", "Encrypted", "Signed", "Connecting", "Published", "Done"} {
+		if !names[want] {
+			t.Errorf("missing step %q in %+v", want, steps)
+		}
+	}
+	if len(relay.Published()) != 1 {
+		t.Errorf("expected the traced send to publish, got %d events", len(relay.Published()))
+	}
+
+	out := trace()
+	if !strings.Contains(out, "] Published ("+relay.URL+": OK)") || strings.Contains(out, "DM sent successfully") {
+		t.Errorf("expected only trace lines, got:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "[+") {
+		t.Errorf("expected lines like [+0ms] Key resolved, got:\n%s", out)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// trustList is the on-disk allowlist used by --trusted-only.
+type trustList struct {
+	Pubkeys []string `json:"pubkeys"`
+}
+
+// trustPath returns trusted.json next to the config file.
+func trustPath(opts *options) string {
+	path := configPath(opts)
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), "trusted.json")
+}
+
+func loadTrustList(path string) (*trustList, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &trustList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list trustList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid trust list %s: %w", path, err)
+	}
+	return &list, nil
+}
+
+func saveTrustList(path string, list *trustList) error {
+	out, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o600)
+}
+
+// trustCommand handles trust add, trust remove and trust list.
+func trustCommand(opts *options) error {
+	path := trustPath(opts)
+	if path == "" {
+		return fmt.Errorf("could not determine config directory; use --config")
+	}
+	list, err := loadTrustList(path)
+	if err != nil {
+		return err
+	}
+
+	action := "list"
+	if len(opts.args) > 0 {
+		action = opts.args[0]
+	}
+
+	switch action {
+	case "list":
+		if opts.jsonOutput {
+			out, _ := marshalJSON(list.Pubkeys, opts)
+			fmt.Println(string(out))
+			return nil
+		}
+		if len(list.Pubkeys) == 0 {
+			fmt.Println("No trusted pubkeys")
+			return nil
+		}
+		for _, pk := range list.Pubkeys {
+			npub, _ := nip19.EncodePublicKey(pk)
+			fmt.Println(npub)
+		}
+		return nil
+	case "add", "remove":
+		if len(opts.args) < 2 {
+			return fmt.Errorf("usage: ndm trust %s <npub>", action)
+		}
+		pubkey, _, err := decodePubkeyInput(opts.args[1])
+		if err != nil {
+			return fmt.Errorf("invalid pubkey: %w", err)
+		}
+		i := slices.Index(list.Pubkeys, pubkey)
+		if action == "add" {
+			if i >= 0 {
+				fmt.Println("Already trusted")
+				return nil
+			}
+			list.Pubkeys = append(list.Pubkeys, pubkey)
+		} else {
+			if i < 0 {
+				return fmt.Errorf("not in trust list: %s", opts.args[1])
+			}
+			list.Pubkeys = slices.Delete(list.Pubkeys, i, i+1)
+		}
+		if err := saveTrustList(path, list); err != nil {
+			return fmt.Errorf("failed to save trust list: %w", err)
+		}
+		if action == "add" {
+			fmt.Println("Trusted")
+		} else {
+			fmt.Println("Removed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown trust command: %s (want add, remove or list)", action)
+	}
+}
+
+// filterTrusted keeps events from trusted pubkeys and from the pubkeys they
+// follow, found through their latest kind-3 contact lists.
+func filterTrusted(ctx context.Context, opts *options, relays []string, events []*nostr.Event) ([]*nostr.Event, error) {
+	list, err := loadTrustList(trustPath(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	trusted := make(map[string]bool)
+	for _, pk := range list.Pubkeys {
+		trusted[pk] = true
+	}
+	if len(list.Pubkeys) > 0 {
+		for _, pk := range fetchFollows(ctx, opts, relays, list.Pubkeys) {
+			trusted[pk] = true
+		}
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Trusting %d pubkeys (%d listed)\n", len(trusted), len(list.Pubkeys))
+	}
+
+	var kept []*nostr.Event
+	for _, e := range events {
+		if trusted[e.PubKey] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// fetchFollows returns the pubkeys in the newest contact list of each author.
+func fetchFollows(ctx context.Context, opts *options, relays []string, authors []string) []string {
+	var follows []string
+	for _, evt := range fetchContactLists(ctx, opts, relays, authors) {
+		for tag := range evt.Tags.FindAll("p") {
+			follows = append(follows, tag[1])
+		}
+	}
+	return follows
+}
+
+// fetchContactLists returns the newest kind-3 contact list of each author
+// that has one, keyed by pubkey.
+func fetchContactLists(ctx context.Context, opts *options, relays []string, authors []string) map[string]*nostr.Event {
+	filter := nostr.Filter{Kinds: []int{nostr.KindFollowList}, Authors: authors}
+	latest := make(map[string]*nostr.Event)
+	for _, relay := range relays {
+		rc, err := connectRelay(ctx, opts, relay)
+		if err != nil {
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
+			}
+			continue
+		}
+		readCtx, cancel := withReadTimeout(ctx, opts)
+		eventsCh, err := rc.QueryEvents(readCtx, filter)
+		if err == nil {
+			for evt := range eventsCh {
+				if prev, ok := latest[evt.PubKey]; !ok || evt.CreatedAt > prev.CreatedAt {
+					latest[evt.PubKey] = evt
+				}
+			}
+		}
+		cancel()
+		rc.Close()
+	}
+	return latest
+}
+
+// filterFollows keeps the events sent by pubkeys in the follow list of
+// pubkey, for --limit-to-follows, plus those from --include-unfollowed-from.
+func filterFollows(ctx context.Context, opts *options, relays []string, pubkey string, events []*nostr.Event) ([]*nostr.Event, error) {
+	list, ok := fetchContactLists(ctx, opts, relays, []string{pubkey})[pubkey]
+	if !ok {
+		npub, _ := nip19.EncodePublicKey(pubkey)
+		return nil, fmt.Errorf("no follow list (kind 3) found for %s, --limit-to-follows needs one", npub)
+	}
+
+	followed := make(map[string]bool)
+	for tag := range list.Tags.FindAll("p") {
+		followed[tag[1]] = true
+	}
+	for _, extra := range opts.unfollowed {
+		pk, _, err := decodePubkeyInput(extra)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --include-unfollowed-from: %w", err)
+		}
+		followed[pk] = true
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Showing messages from %d followed pubkeys\n", len(followed))
+	}
+
+	var kept []*nostr.Event
+	for _, e := range events {
+		if followed[e.PubKey] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestTrustCommands(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(pubkey)
+
+	trust := func(args ...string) string {
+		t.Helper()
+		opts, err := parseArgs(append([]string{"trust"}, append(args, "--config", configFile)...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return captureStdout(t, func() {
+			if err := trustCommand(opts); err != nil {
+				t.Fatalf("trust %v: %v", args, err)
+			}
+		})
+	}
+
+	if out := trust("list"); !strings.Contains(out, "No trusted pubkeys") {
+		t.Errorf("expected empty list, got %q", out)
+	}
+	trust("add", npub)
+	if out := trust("list"); strings.TrimSpace(out) != npub {
+		t.Errorf("expected %s, got %q", npub, out)
+	}
+	trust("remove", npub)
+	if out := trust("list"); !strings.Contains(out, "No trusted pubkeys") {
+		t.Errorf("expected empty list after remove, got %q", out)
+	}
+
+	// A hex pubkey is also a valid private key, but it must be kept as is.
+	trust("add", pubkey)
+	if out := trust("list"); strings.TrimSpace(out) != npub {
+		t.Errorf("expected the hex pubkey to be trusted as %s, got %q", npub, out)
+	}
+	trust("remove", pubkey)
+	if out := trust("list"); !strings.Contains(out, "No trusted pubkeys") {
+		t.Errorf("expected empty list after removing the hex pubkey, got %q", out)
+	}
+}
+
+func TestTrustedOnly(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	trustedKey := nostr.GeneratePrivateKey()
+	trustedPub, _ := nostr.GetPublicKey(trustedKey)
+	friendKey := nostr.GeneratePrivateKey()
+	friendPub, _ := nostr.GetPublicKey(friendKey)
+
+	contacts := &nostr.Event{
+		Kind:      nostr.KindFollowList,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", friendPub}},
+	}
+	if err := contacts.Sign(trustedKey); err != nil {
+		t.Fatal(err)
+	}
+	relay := newMockRelay(t,
+		contacts,
+		newTestDM(t, trustedKey, recipientPub, "from the trusted key"),
+		newTestDM(t, friendKey, recipientPub, "from a followed key"),
+		newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "from a stranger"),
+	)
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	if err := saveTrustList(trustPath(&options{configFile: configFile}), &trustList{Pubkeys: []string{trustedPub}}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseArgs([]string{
+		"read", "-k", recipient,
+		"--allow-insecure-relays", "--relays", relay.URL,
+		"--config", configFile,
+		"--trusted-only",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := readMessages(opts); err != nil {
+			t.Fatalf("readMessages: %v", err)
+		}
+	})
+
+	for _, want := range []string{"from the trusted key", "from a followed key"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "from a stranger") {
+		t.Errorf("expected untrusted message to be hidden, got:\n%s", out)
+	}
+}
+
+func TestLimitToFollows(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	friendKey := nostr.GeneratePrivateKey()
+	friendPub, _ := nostr.GetPublicKey(friendKey)
+	stranger := nostr.GeneratePrivateKey()
+	strangerPub, _ := nostr.GetPublicKey(stranger)
+
+	contacts := &nostr.Event{
+		Kind:      nostr.KindFollowList,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", friendPub}},
+	}
+	if err := contacts.Sign(recipient); err != nil {
+		t.Fatal(err)
+	}
+	inbox := []*nostr.Event{
+		newTestDM(t, friendKey, recipientPub, "from a followed key"),
+		newTestDM(t, stranger, recipientPub, "from a stranger"),
+	}
+
+	read := func(relay *mockRelay, extra ...string) (string, error) {
+		t.Helper()
+		opts, err := parseArgs(append([]string{
+			"read", "-k", recipient,
+			"--allow-insecure-relays", "--relays", relay.URL,
+			"--limit-to-follows",
+		}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var readErr error
+		out := captureStdout(t, func() { readErr = readMessages(opts) })
+		return out, readErr
+	}
+
+	relay := newMockRelay(t, append([]*nostr.Event{contacts}, inbox...)...)
+	out, err := read(relay)
+	if err != nil {
+		t.Fatalf("readMessages: %v", err)
+	}
+	if !strings.Contains(out, "from a followed key") || strings.Contains(out, "from a stranger") {
+		t.Errorf("expected only the followed key's message, got:\n%s", out)
+	}
+
+	strangerNpub, _ := nip19.EncodePublicKey(strangerPub)
+	if out, err := read(relay, "--include-unfollowed-from", strangerNpub); err != nil || !strings.Contains(out, "from a stranger") {
+		t.Errorf("expected the exception to be shown, got %v:\n%s", err, out)
+	}
+	// A hex pubkey is also a valid private key, but it must be kept as is.
+	if out, err := read(relay, "--include-unfollowed-from", strangerPub); err != nil || !strings.Contains(out, "from a stranger") {
+		t.Errorf("expected the hex exception to be shown, got %v:\n%s", err, out)
+	}
+
+	if _, err := read(newMockRelay(t, inbox...)); err == nil || !strings.Contains(err.Error(), "no follow list") {
+		t.Errorf("expected an error without a follow list, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// releasesURL is the GitHub API endpoint for the latest ndm release.
+var releasesURL = "https://api.github.com/repos/joelklabo/ndm/releases/latest"
+
+func versionCommand(opts *options) error {
+	if len(opts.args) == 0 {
+		fmt.Printf("ndm version %s\n", version)
+		return nil
+	}
+	if opts.args[0] == "check" {
+		return checkVersion(opts)
+	}
+	return fmt.Errorf("unknown version subcommand: %s", opts.args[0])
+}
+
+func checkVersion(opts *options) error {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.checkTimeout)
+	defer cancel()
+
+	latest, err := fetchLatestVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check latest version: %w", err)
+	}
+
+	cmp, err := compareVersions(version, latest)
+	if err != nil {
+		return err
+	}
+
+	current := strings.TrimPrefix(version, "v")
+	latest = strings.TrimPrefix(latest, "v")
+
+	if opts.jsonOutput {
+		out, _ := marshalJSON(map[string]any{
+			"current":          current,
+			"latest":           latest,
+			"update_available": cmp < 0,
+		}, opts)
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if cmp < 0 {
+		fmt.Printf("Update available: v%s → v%s\n", current, latest)
+	} else {
+		fmt.Println("Up to date")
+	}
+	return nil
+}
+
+func fetchLatestVersion(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releasesURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("invalid release response: %w", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("release has no tag_name")
+	}
+	return release.TagName, nil
+}
+
+// parseSemver parses "vMAJOR.MINOR.PATCH", ignoring any pre-release or build
+// suffix.
+func parseSemver(v string) ([3]int, error) {
+	var parts [3]int
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	fields := strings.Split(s, ".")
+	if len(fields) != 3 {
+		return parts, fmt.Errorf("invalid version: %s", v)
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, fmt.Errorf("invalid version: %s", v)
+		}
+		parts[i] = n
+	}
+	return parts, nil
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, equal to or newer
+// than b.
+func compareVersions(a, b string) (int, error) {
+	va, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va {
+		if va[i] < vb[i] {
+			return -1, nil
+		}
+		if va[i] > vb[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
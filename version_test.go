@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		latest  string
+		want    string
+		updated bool
+	}{
+		{"up to date", "v0.3.0", "Up to date", false},
+		{"patch update", "v0.3.1", "Update available: v0.3.0 → v0.3.1", true},
+		{"minor update", "v0.4.0", "Update available: v0.3.0 → v0.4.0", true},
+	}
+
+	origURL, origVersion := releasesURL, version
+	t.Cleanup(func() { releasesURL, version = origURL, origVersion })
+	version = "0.3.0"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"tag_name":%q,"name":"ndm"}`, tt.latest)
+			}))
+			defer server.Close()
+			releasesURL = server.URL
+
+			opts := &options{checkTimeout: time.Second}
+			out := captureStdout(t, func() {
+				if err := checkVersion(opts); err != nil {
+					t.Fatalf("checkVersion: %v", err)
+				}
+			})
+			if strings.TrimSpace(out) != tt.want {
+				t.Errorf("got %q, want %q", strings.TrimSpace(out), tt.want)
+			}
+
+			opts.jsonOutput = true
+			out = captureStdout(t, func() {
+				if err := checkVersion(opts); err != nil {
+					t.Fatalf("checkVersion: %v", err)
+				}
+			})
+			var result struct {
+				Current         string `json:"current"`
+				Latest          string `json:"latest"`
+				UpdateAvailable bool   `json:"update_available"`
+			}
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("invalid JSON %q: %v", out, err)
+			}
+			if result.UpdateAvailable != tt.updated {
+				t.Errorf("update_available = %v, want %v", result.UpdateAvailable, tt.updated)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.3.0", "v0.3.0", 0},
+		{"0.3.0", "v0.3.1", -1},
+		{"0.3.0", "v0.4.0", -1},
+		{"1.0.0", "v0.9.9", 1},
+		{"v1.2.3-rc1", "1.2.3", 0},
+	}
+	for _, tt := range tests {
+		got, err := compareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("compareVersions(%q, %q) error = %v", tt.a, tt.b, err)
+		}
+		if got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if _, err := compareVersions("1.2", "1.2.3"); err == nil {
+		t.Error("expected error for malformed version")
+	}
+}
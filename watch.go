@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// defaultPoolSize caps how many relays watch keeps open at once.
+const defaultPoolSize = 10
+
+// defaultMaxPendingHooks caps how many --on-receive commands run at once.
+const defaultMaxPendingHooks = 10
+
+func watchMessages(opts *options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return watch(ctx, opts)
+}
+
+// watch subscribes to every relay and prints incoming messages until ctx is
+// canceled.
+func watch(ctx context.Context, opts *options) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	privkey, err := resolvePrivateKey(opts.key)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	pubkey, err := derivePublicKeyFromPrivate(privkey, opts.directDerive)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	relays := relayList(opts)
+
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Pubkey: %s\n", pubkey)
+		fmt.Fprintf(os.Stderr, "[ndm] Watching: %v\n", relays)
+	}
+
+	since := nostr.Now()
+	wrappedSince := since - nostr.Timestamp(giftWrapWindow.Seconds())
+	filters := nostr.Filters{{
+		Kinds: []int{nostr.KindEncryptedDirectMessage},
+		Tags:  nostr.TagMap{"p": []string{pubkey}},
+		Since: &since,
+	}, {
+		// Gift wraps are backdated at random, so ask for older ones and
+		// check the time of the message inside.
+		Kinds: []int{nostr.KindGiftWrap},
+		Tags:  nostr.TagMap{"p": []string{pubkey}},
+		Since: &wrappedSince,
+	}}
+
+	// With --event-ttl, also follow deletions by the senders shown so
+	// messages deleted after they were shown can be marked.
+	var deletions *deletionTracker
+	var deletionsIn chan *nostr.Event
+	var follower *deletionFollower
+	if opts.eventTTL > 0 {
+		deletions = newDeletionTracker(opts.eventTTL)
+		follower = newDeletionFollower(ctx, opts, relays, since)
+		defer follower.close()
+		deletionsIn = follower.out
+	}
+
+	// Each subscription holds a pool slot until its relay closes, so at most
+	// --relay-pool-size websockets are open at once. 0 means no limit.
+	var pool chan struct{}
+	if opts.poolSize > 0 {
+		pool = make(chan struct{}, opts.poolSize)
+	}
+
+	// --output-template-file is reloaded on SIGHUP. The handler is installed
+	// before subscribing so no signal sent after that kills the process.
+	var hup chan os.Signal
+	if opts.templateFile != "" {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+
+	incoming := make(chan *nostr.Event)
+	var subs sync.WaitGroup
+	for _, relay := range relays {
+		subs.Add(1)
+		go func(relay string) {
+			defer subs.Done()
+			if pool != nil {
+				if !acquireSlot(ctx, opts, pool, relay) {
+					return
+				}
+				defer func() { <-pool }()
+			}
+			followRelay(ctx, opts, relay, filters, incoming)
+		}(relay)
+	}
+	go func() {
+		subs.Wait()
+		close(incoming)
+	}()
+
+	var forwards, hooks sync.WaitGroup
+	defer forwards.Wait()
+	defer hooks.Wait()
+
+	// --on-receive commands hold a slot while they run. When all slots are
+	// taken, a hook waits for one with --queue-hooks and is dropped otherwise.
+	var hookSlots chan struct{}
+	if opts.maxPendingHooks > 0 {
+		hookSlots = make(chan struct{}, opts.maxPendingHooks)
+	}
+
+	// Several relays usually deliver the same event; show it once unless
+	// --allow-duplicates is given.
+	var seen *seenEvents
+	if opts.suppressDups {
+		seen = newSeenEvents(opts.dupWindow, maxSeenEvents)
+	}
+
+	// --heartbeat reports quiet periods; the ticker restarts on every event.
+	var beats <-chan time.Time
+	var heartbeat *time.Ticker
+	if opts.heartbeat > 0 {
+		heartbeat = time.NewTicker(opts.heartbeat)
+		defer heartbeat.Stop()
+		beats = heartbeat.C
+	}
+	quiet := 0
+
+	n := 0
+	for {
+		var evt *nostr.Event
+		select {
+		case e, ok := <-incoming:
+			if !ok {
+				return nil
+			}
+			evt = e
+		case e := <-deletionsIn:
+			evt = e
+		case <-beats:
+			quiet++
+			printHeartbeat(opts)
+			if opts.heartbeatMax > 0 && quiet >= opts.heartbeatMax {
+				return fmt.Errorf("no events in %d heartbeat intervals of %v, relays appear dead", quiet, opts.heartbeat)
+			}
+			continue
+		case <-hup:
+			reloadTemplate(opts)
+			continue
+		}
+		if heartbeat != nil {
+			quiet = 0
+			heartbeat.Reset(opts.heartbeat)
+		}
+
+		if seen != nil && !seen.firstSeen(evt.ID, time.Now()) {
+			if opts.verbose {
+				fmt.Fprintf(os.Stderr, "[ndm] Skipping duplicate %s\n", evt.ID)
+			}
+			continue
+		}
+		if evt.Kind == nostr.KindDeletion {
+			if deletions != nil {
+				for _, m := range deletions.deleted(evt, time.Now()) {
+					printDeleted(m, privkey, opts)
+				}
+			}
+			continue
+		}
+
+		raw := evt
+		if evt.Kind == nostr.KindGiftWrap {
+			if rumor, ok := openGiftWrap(privkey, evt, opts); ok {
+				if rumor.CreatedAt < since {
+					continue
+				}
+				evt = rumor
+			}
+		}
+
+		n++
+		if deletions != nil {
+			deletions.remember(n, evt, time.Now())
+			follower.follow(evt.PubKey)
+		}
+		if opts.jsonOutput {
+			out, _ := json.Marshal(omitFields(newJSONMessage(evt, privkey, opts), opts))
+			fmt.Println(string(out))
+		} else if opts.tmpl != nil {
+			if err := fprintTemplate(os.Stdout, evt, privkey, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "[ndm] Warning: %v\n", err)
+			}
+		} else {
+			printMessage(n, evt, privkey, opts)
+		}
+
+		if opts.onReceive != "" {
+			if content, err := messageContent(privkey, evt); err == nil {
+				startReceiveHook(opts, hookSlots, &hooks, evt, content)
+			}
+		}
+
+		if opts.forwardTo != "" {
+			forwards.Add(1)
+			go func(evt nostr.Event) {
+				defer forwards.Done()
+				forwardEvent(opts, opts.forwardTo, evt)
+			}(*raw)
+		}
+	}
+}
+
+// printHeartbeat reports that --heartbeat passed without events: as a JSON
+// line on stdout with --json, otherwise on stderr.
+func printHeartbeat(opts *options) {
+	if opts.jsonOutput {
+		out, _ := json.Marshal(map[string]any{"type": "heartbeat", "timestamp": time.Now().Unix()})
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[heartbeat] No events in last %v, still watching...\n", opts.heartbeat)
+}
+
+// startReceiveHook runs the --on-receive command for evt in the background.
+// When slots is full the hook waits for a free slot with --queue-hooks and
+// is dropped with a warning otherwise.
+func startReceiveHook(opts *options, slots chan struct{}, wg *sync.WaitGroup, evt *nostr.Event, content string) {
+	acquired := false
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			acquired = true
+		default:
+			if !opts.queueHooks {
+				fmt.Fprintf(os.Stderr, "[ndm] Warning: %d --on-receive commands already running, skipping %s\n", opts.maxPendingHooks, evt.ID)
+				return
+			}
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if slots != nil {
+			if !acquired {
+				slots <- struct{}{}
+			}
+			defer func() { <-slots }()
+		}
+		from, _ := nip19.EncodePublicKey(evt.PubKey)
+		runHook(opts, "--on-receive", opts.onReceive,
+			"NDM_FROM="+from,
+			"NDM_CONTENT="+content,
+			"NDM_EVENT_ID="+evt.ID,
+			fmt.Sprintf("NDM_TIMESTAMP=%d", evt.CreatedAt),
+		)
+	}()
+}
+
+// acquireSlot takes a slot from pool for relay, waiting for one to free up
+// when the pool is full. It reports false if ctx ends first.
+func acquireSlot(ctx context.Context, opts *options, pool chan struct{}, relay string) bool {
+	select {
+	case pool <- struct{}{}:
+		return true
+	default:
+	}
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "[ndm] Relay pool full, %s waiting for a free slot\n", relay)
+	}
+	select {
+	case pool <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// followRelay subscribes to relay and, with --relay-reconnect, subscribes
+// again after --relay-reconnect-delay whenever the relay drops, starting from
+// the last event it sent.
+func followRelay(ctx context.Context, opts *options, relay string, filters nostr.Filters, out chan<- *nostr.Event) {
+	cursor := &relayCursor{}
+	for attempt := 1; ; attempt++ {
+		subscribeRelay(ctx, opts, relay, filters, out, cursor)
+		if !opts.reconnect || ctx.Err() != nil {
+			return
+		}
+		if opts.maxReconnects > 0 && attempt > opts.maxReconnects {
+			fmt.Fprintf(os.Stderr, "[ndm] Giving up on %s after %d reconnects\n", relay, opts.maxReconnects)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[ndm] Lost %s, reconnecting in %v (attempt %d)\n", relay, opts.reconnectDelay, attempt)
+		select {
+		case <-time.After(opts.reconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+		if cursor.last > 0 {
+			filters = cursor.resume(filters)
+		}
+	}
+}
+
+// relayCursor tracks the newest events a subscription delivered so a
+// reconnect can resume from them without showing any twice.
+type relayCursor struct {
+	last nostr.Timestamp
+	// ids holds the events delivered at last.
+	ids map[string]bool
+	// wraps holds every gift wrap delivered, since resume asks for wraps
+	// older than last again.
+	wraps map[string]bool
+}
+
+// advance records evt and reports whether it is new. A nil cursor accepts
+// every event.
+func (c *relayCursor) advance(evt *nostr.Event) bool {
+	if c == nil {
+		return true
+	}
+	if c.ids[evt.ID] || c.wraps[evt.ID] {
+		return false
+	}
+	if evt.Kind == nostr.KindGiftWrap {
+		if c.wraps == nil {
+			c.wraps = make(map[string]bool)
+		}
+		c.wraps[evt.ID] = true
+	}
+	if evt.CreatedAt > c.last {
+		c.last = evt.CreatedAt
+		c.ids = make(map[string]bool)
+	}
+	if evt.CreatedAt == c.last {
+		c.ids[evt.ID] = true
+	}
+	return true
+}
+
+// resume returns filters with Since moved up to the last delivered event.
+// Gift wrap filters keep looking giftWrapWindow further back, because a wrap
+// sent after the last event may be dated well before it.
+func (c *relayCursor) resume(filters nostr.Filters) nostr.Filters {
+	resumed := make(nostr.Filters, len(filters))
+	for i, f := range filters {
+		since := c.last
+		if slices.Contains(f.Kinds, nostr.KindGiftWrap) {
+			since -= nostr.Timestamp(giftWrapWindow.Seconds())
+		}
+		if f.Since != nil && *f.Since > since {
+			since = *f.Since
+		}
+		f.Since = &since
+		resumed[i] = f
+	}
+	return resumed
+}
+
+// subscribeRelay streams events matching filters from a single relay into out
+// until ctx is canceled or the relay closes the subscription. Events the
+// cursor has already seen are skipped.
+func subscribeRelay(ctx context.Context, opts *options, relay string, filters nostr.Filters, out chan<- *nostr.Event, cursor *relayCursor) {
+	// A subscription runs indefinitely, so --relay-response-limit applies
+	// to each message rather than to the whole stream.
+	rc, err := connectRelayWithBudget(ctx, opts, relay, newMessageBudget(opts, relay))
+	if err != nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Failed to connect to %s: %v\n", relay, err)
+		}
+		return
+	}
+	defer rc.Close()
+
+	sub, err := rc.Subscribe(ctx, filters)
+	if err != nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "[ndm] Failed to subscribe to %s: %v\n", relay, err)
+		}
+		return
+	}
+	defer sub.Unsub()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rc.Context().Done():
+			return
+		case evt, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if !cursor.advance(evt) {
+				continue
+			}
+			select {
+			case out <- evt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// forwardEvent republishes an already-signed event to target unchanged.
+func forwardEvent(opts *options, target string, evt nostr.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.wait)
+	defer cancel()
+
+	rc, err := connectRelay(ctx, opts, target)
+	if err == nil {
+		err = rc.Publish(ctx, evt)
+		rc.Close()
+	}
+
+	if opts.verbose {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ndm] Failed to forward %s to %s: %v\n", evt.ID, target, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "[ndm] Forwarded %s to %s\n", evt.ID, target)
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws "github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+	"github.com/nbd-wtf/go-nostr/nip59"
+)
+
+// waitFor polls cond until it returns true or timeout elapses.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestWatchSubscribeAndForward(t *testing.T) {
+	source := newMockRelay(t)
+	target := newMockRelay(t)
+
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "forward me")
+
+	opts := &options{
+		command:       "watch",
+		key:           recipient,
+		relays:        source.URL,
+		wait:          5 * time.Second,
+		forwardTo:     target.URL,
+		allowInsecure: true,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	captureStdout(t, func() {
+		go func() { done <- watch(ctx, opts) }()
+
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+			t.Fatal("watch never subscribed to the source relay")
+		}
+		source.Deliver(evt)
+
+		if !waitFor(2*time.Second, func() bool { return len(target.Published()) > 0 }) {
+			t.Error("target relay never received the forwarded event")
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+	})
+
+	published := target.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 forwarded event, got %d", len(published))
+	}
+	want, _ := json.Marshal(evt)
+	got, _ := json.Marshal(published[0])
+	if string(got) != string(want) {
+		t.Errorf("forwarded event differs:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestWatchRelayPoolSize(t *testing.T) {
+	var active, peak, total atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := ws.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		total.Add(1)
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// Hold the connection briefly, then hang up to free the slot.
+		time.Sleep(50 * time.Millisecond)
+		active.Add(-1)
+		conn.Close(ws.StatusNormalClosure, "")
+	}))
+	t.Cleanup(server.Close)
+
+	base := "ws" + strings.TrimPrefix(server.URL, "http")
+	var relays []string
+	for i := range 15 {
+		relays = append(relays, fmt.Sprintf("%s/%d", base, i))
+	}
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", nostr.GeneratePrivateKey(),
+		"--allow-insecure-relays", "--relays", strings.Join(relays, ","),
+		"--relay-pool-size", "5",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := watch(ctx, opts); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	if got := total.Load(); got != 15 {
+		t.Errorf("expected all 15 relays to be tried, got %d", got)
+	}
+	if got := peak.Load(); got > 5 {
+		t.Errorf("expected at most 5 concurrent connections, saw %d", got)
+	}
+}
+
+func TestWatchOnReceive(t *testing.T) {
+	source := newMockRelay(t)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "ping")
+	out := filepath.Join(t.TempDir(), "received.txt")
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", recipient,
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--on-receive", `echo "$NDM_EVENT_ID $NDM_TIMESTAMP $NDM_CONTENT" > ` + out,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	captureStdout(t, func() {
+		go func() { done <- watch(ctx, opts) }()
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+			t.Fatal("watch never subscribed")
+		}
+		source.Deliver(evt)
+		waitFor(2*time.Second, func() bool {
+			_, err := os.Stat(out)
+			return err == nil
+		})
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+	})
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	want := fmt.Sprintf("%s %d ping", evt.ID, evt.CreatedAt)
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("hook wrote %q, want %q", got, want)
+	}
+}
+
+func TestWatchMaxPendingHooks(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	// run delivers 5 messages and watches until want hooks have finished.
+	run := func(want int, extra ...string) (dir string, peak int, stderr string) {
+		t.Helper()
+		source := newMockRelay(t)
+		dir = t.TempDir()
+		opts, err := parseArgs(append([]string{
+			"watch", "-k", recipient,
+			"--allow-insecure-relays", "--relays", source.URL,
+			"--on-receive", `touch "$DIR/$NDM_EVENT_ID.start"; sleep 0.2; touch "$DIR/$NDM_EVENT_ID.end"`,
+			"--max-pending-hooks", "2",
+		}, extra...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Setenv("DIR", dir)
+
+		count := func(suffix string) int {
+			matches, _ := filepath.Glob(filepath.Join(dir, "*"+suffix))
+			return len(matches)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		stderr = captureStderr(t, func() {
+			captureStdout(t, func() {
+				go func() { done <- watch(ctx, opts) }()
+				if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+					t.Fatal("watch never subscribed")
+				}
+				for i := range 5 {
+					source.Deliver(newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, fmt.Sprint("msg ", i)))
+				}
+				waitFor(3*time.Second, func() bool {
+					peak = max(peak, count(".start")-count(".end"))
+					return count(".end") >= want
+				})
+				cancel()
+				if err := <-done; err != nil {
+					t.Errorf("watch: %v", err)
+				}
+			})
+		})
+		return dir, peak, stderr
+	}
+
+	dir, peak, stderr := run(2)
+	if peak > 2 {
+		t.Errorf("expected at most 2 hooks at once, saw %d", peak)
+	}
+	if ends, _ := filepath.Glob(filepath.Join(dir, "*.end")); len(ends) != 2 {
+		t.Errorf("expected 2 hooks to run and the rest to be skipped, got %d", len(ends))
+	}
+	if strings.Count(stderr, "skipping") != 3 {
+		t.Errorf("expected 3 skip warnings, got:\n%s", stderr)
+	}
+
+	dir, peak, _ = run(5, "--queue-hooks")
+	if peak > 2 {
+		t.Errorf("expected at most 2 queued hooks at once, saw %d", peak)
+	}
+	if ends, _ := filepath.Glob(filepath.Join(dir, "*.end")); len(ends) != 5 {
+		t.Errorf("expected all 5 queued hooks to run, got %d", len(ends))
+	}
+}
+
+func TestWatchEventTTL(t *testing.T) {
+	source := newMockRelay(t)
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	senderPub, _ := nostr.GetPublicKey(sender)
+	var evt *nostr.Event
+
+	deletion := func(priv string) *nostr.Event {
+		d := &nostr.Event{
+			Kind:      nostr.KindDeletion,
+			CreatedAt: nostr.Now(),
+			Tags:      nostr.Tags{{"e", evt.ID}},
+		}
+		if err := d.Sign(priv); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", recipient,
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--event-ttl", "1h",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	out := captureStdout(t, func() {
+		go func() { done <- watch(ctx, opts) }()
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+			t.Fatal("watch never subscribed")
+		}
+		// Made after watch starts, so it is never older than its Since.
+		evt = newTestDM(t, sender, recipientPub, "oops, wrong chat")
+		source.Deliver(evt)
+		if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 1 }) {
+			t.Fatal("watch never subscribed to the sender's deletions")
+		}
+		// A deletion by someone else must be ignored.
+		source.Deliver(deletion(nostr.GeneratePrivateKey()))
+		source.Deliver(deletion(sender))
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+	})
+
+	// Only deletions by senders already shown are asked for, not every
+	// deletion on the relay.
+	for _, filters := range source.Requests() {
+		for _, f := range filters {
+			if slices.Contains(f.Kinds, nostr.KindDeletion) && !slices.Equal(f.Authors, []string{senderPub}) {
+				t.Errorf("expected deletions to be limited to the sender, got %v", f)
+			}
+		}
+	}
+	if strings.Count(out, "[DELETED]") != 1 {
+		t.Fatalf("expected one deletion notice, got:\n%s", out)
+	}
+	_, after, _ := strings.Cut(out, "[DELETED]")
+	if !strings.Contains(after, "oops, wrong chat") {
+		t.Errorf("expected the deleted message to be reprinted, got:\n%s", out)
+	}
+}
+
+func TestWatchDuplicates(t *testing.T) {
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	for _, tt := range []struct {
+		flags []string
+		want  int
+	}{
+		{nil, 1},
+		{[]string{"--allow-duplicates"}, 2},
+	} {
+		first, second := newMockRelay(t), newMockRelay(t)
+		opts, err := parseArgs(append([]string{
+			"watch", "-k", recipient,
+			"--allow-insecure-relays", "--relays", first.URL + "," + second.URL,
+		}, tt.flags...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		out := captureStdout(t, func() {
+			go func() { done <- watch(ctx, opts) }()
+			if !waitFor(2*time.Second, func() bool { return first.Subscriptions() > 0 && second.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed")
+			}
+			// Made after watch starts, so it is never older than its Since.
+			evt := newTestDM(t, nostr.GeneratePrivateKey(), recipientPub, "seen twice")
+			first.Deliver(evt)
+			second.Deliver(evt)
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("watch: %v", err)
+			}
+		})
+
+		if n := strings.Count(out, "seen twice"); n != tt.want {
+			t.Errorf("%v: expected the event to be shown %d times, got %d:\n%s", tt.flags, tt.want, n, out)
+		}
+	}
+}
+
+func TestSeenEvents(t *testing.T) {
+	now := time.Now()
+	seen := newSeenEvents(time.Minute, 2)
+	if !seen.firstSeen("a", now) || seen.firstSeen("a", now) {
+		t.Error("expected only the first delivery of a to be new")
+	}
+	if !seen.firstSeen("a", now.Add(2*time.Minute)) {
+		t.Error("expected a to be forgotten after the window")
+	}
+	seen.firstSeen("b", now.Add(2*time.Minute))
+	seen.firstSeen("c", now.Add(2*time.Minute))
+	if !seen.firstSeen("a", now.Add(2*time.Minute)) {
+		t.Error("expected the oldest ID to be forgotten beyond max")
+	}
+}
+
+func TestWatchHeartbeat(t *testing.T) {
+	source := newMockRelay(t)
+	args := []string{
+		"watch", "-k", nostr.GeneratePrivateKey(),
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--heartbeat", "50ms",
+	}
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	logs := captureStderr(t, func() {
+		go func() { done <- watch(ctx, opts) }()
+		time.Sleep(150 * time.Millisecond)
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+	})
+	if !strings.Contains(logs, "[heartbeat] No events in last 50ms, still watching...") {
+		t.Errorf("expected a heartbeat within 150ms, got:\n%s", logs)
+	}
+
+	opts, err = parseArgs(append(args, "--heartbeat-exit-after", "2", "--json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var watchErr error
+	out := captureStdout(t, func() {
+		watchErr = watch(context.Background(), opts)
+	})
+	if watchErr == nil || !strings.Contains(watchErr.Error(), "2 heartbeat intervals") {
+		t.Errorf("expected watch to give up after two quiet intervals, got %v", watchErr)
+	}
+	if n := strings.Count(out, `"type":"heartbeat"`); n != 2 {
+		t.Errorf("expected two JSON heartbeats, got:\n%s", out)
+	}
+}
+
+func TestWatchRelayReconnect(t *testing.T) {
+	source := newMockRelay(t)
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+	sender := nostr.GeneratePrivateKey()
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", recipient,
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--relay-reconnect", "--relay-reconnect-delay", "50ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	var stderr string
+	out := captureStdout(t, func() {
+		stderr = captureStderr(t, func() {
+			go func() { done <- watch(ctx, opts) }()
+			if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed")
+			}
+			source.Deliver(newTestDM(t, sender, recipientPub, "message one"))
+			source.Deliver(newTestDM(t, sender, recipientPub, "message two"))
+			time.Sleep(100 * time.Millisecond)
+
+			source.Drop()
+			if !waitFor(2*time.Second, func() bool { return len(source.Requests()) == 2 && source.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed again")
+			}
+			source.Deliver(newTestDM(t, sender, recipientPub, "message three"))
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("watch: %v", err)
+			}
+		})
+	})
+
+	for _, msg := range []string{"message one", "message two", "message three"} {
+		if n := strings.Count(out, msg); n != 1 {
+			t.Errorf("expected %q once, got %d times:\n%s", msg, n, out)
+		}
+	}
+	if !strings.Contains(stderr, "reconnecting in 50ms") {
+		t.Errorf("expected the reconnect to be logged, got:\n%s", stderr)
+	}
+	if since := source.Requests()[1][0].Since; since == nil || *since == 0 {
+		t.Errorf("expected the new subscription to start at the last event, got %v", since)
+	}
+}
+
+func TestWatchRelayReconnectGiftWrap(t *testing.T) {
+	source := newMockRelay(t)
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", recipient,
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--relay-reconnect", "--relay-reconnect-delay", "50ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A wrap sent while the relay was away, dated hours before the kind-4
+	// message that moved the cursor.
+	wrap, err := buildDMEvent(&options{message: "backdated wrap", nip: 17}, sender, recipientPub)
+	if err != nil {
+		t.Fatalf("buildDMEvent: %v", err)
+	}
+	rumor, err := unwrapGiftWrap(recipient, &wrap)
+	if err != nil {
+		t.Fatalf("unwrapGiftWrap: %v", err)
+	}
+	wrap, err = nip59.GiftWrap(*rumor, recipientPub,
+		func(plaintext string) (string, error) {
+			key, err := nip44.GenerateConversationKey(recipientPub, sender)
+			if err != nil {
+				return "", err
+			}
+			return nip44.Encrypt(plaintext, key)
+		},
+		func(seal *nostr.Event) error { return seal.Sign(sender) },
+		func(gw *nostr.Event) { gw.CreatedAt = nostr.Now() - 3*60*60 },
+	)
+	if err != nil {
+		t.Fatalf("GiftWrap: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	out := captureStdout(t, func() {
+		captureStderr(t, func() {
+			go func() { done <- watch(ctx, opts) }()
+			if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed")
+			}
+			source.Deliver(newTestDM(t, sender, recipientPub, "kind-4 message"))
+			time.Sleep(100 * time.Millisecond)
+
+			source.Drop()
+			source.Deliver(&wrap)
+			if !waitFor(2*time.Second, func() bool { return len(source.Requests()) == 2 && source.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed again")
+			}
+			time.Sleep(100 * time.Millisecond)
+			source.Drop()
+			if !waitFor(2*time.Second, func() bool { return len(source.Requests()) == 3 && source.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed a third time")
+			}
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("watch: %v", err)
+			}
+		})
+	})
+
+	if n := strings.Count(out, "backdated wrap"); n != 1 {
+		t.Errorf("expected the backdated wrap once after reconnecting, got %d times:\n%s", n, out)
+	}
+}
+
+func TestWatchRelayResponseLimit(t *testing.T) {
+	source := newMockRelay(t)
+	sender := nostr.GeneratePrivateKey()
+	recipient := nostr.GeneratePrivateKey()
+	recipientPub, _ := nostr.GetPublicKey(recipient)
+
+	opts, err := parseArgs([]string{
+		"watch", "-k", recipient,
+		"--allow-insecure-relays", "--relays", source.URL,
+		"--relay-response-limit", "2048",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	var logs string
+	var huge *nostr.Event
+	out := captureStdout(t, func() {
+		logs = captureStderr(t, func() {
+			go func() { done <- watch(ctx, opts) }()
+			if !waitFor(2*time.Second, func() bool { return source.Subscriptions() > 0 }) {
+				t.Fatal("watch never subscribed")
+			}
+			// Together these pass the limit; each one is well under it.
+			for i := range 8 {
+				source.Deliver(newTestDM(t, sender, recipientPub, fmt.Sprintf("small message %d", i)))
+			}
+			time.Sleep(100 * time.Millisecond)
+			// Made after watch starts, so it is never older than its Since.
+			huge = newHugeEvent(t, recipientPub, 24<<20)
+			source.Deliver(huge)
+			if !waitFor(2*time.Second, func() bool { return source.Subscriptions() == 0 }) {
+				t.Error("expected the oversized event to close the connection")
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("watch: %v", err)
+			}
+		})
+	})
+
+	if n := strings.Count(out, "small message"); n != 8 {
+		t.Errorf("expected all 8 small messages, got %d:\n%s", n, out)
+	}
+	if strings.Contains(out, huge.ID[:16]) {
+		t.Error("expected the oversized event to be dropped")
+	}
+	if sent := source.sent.Load(); sent >= int64(len(huge.Content)) {
+		t.Errorf("expected the connection to close before the oversized event was read, but %d bytes were sent", sent)
+	}
+	if !strings.Contains(logs, "--relay-response-limit") {
+		t.Errorf("expected a warning about the response limit, got:\n%s", logs)
+	}
+}
+
+func TestRelayCursor(t *testing.T) {
+	c := &relayCursor{}
+	a := &nostr.Event{ID: "a", CreatedAt: 10}
+	b := &nostr.Event{ID: "b", CreatedAt: 10}
+	if !c.advance(a) || !c.advance(b) || c.advance(a) {
+		t.Error("expected each event to be new exactly once")
+	}
+	if !c.advance(&nostr.Event{ID: "c", CreatedAt: 11}) || c.ids["a"] {
+		t.Error("expected a newer event to reset the IDs kept")
+	}
+	since := nostr.Timestamp(5)
+	resumed := c.resume(nostr.Filters{{Kinds: []int{4}, Since: &since}})
+	if *resumed[0].Since != 11 || since != 5 {
+		t.Errorf("expected Since 11 without changing the original filter, got %d and %d", *resumed[0].Since, since)
+	}
+	wrapped := c.resume(nostr.Filters{{Kinds: []int{nostr.KindGiftWrap}}})
+	if want := 11 - nostr.Timestamp(giftWrapWindow.Seconds()); *wrapped[0].Since != want {
+		t.Errorf("expected gift wraps to be asked for from %d, got %d", want, *wrapped[0].Since)
+	}
+	wrap := &nostr.Event{ID: "w", Kind: nostr.KindGiftWrap, CreatedAt: 3}
+	if !c.advance(wrap) || c.advance(wrap) {
+		t.Error("expected an older gift wrap to be new exactly once")
+	}
+}